@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type APIHandler struct {
@@ -55,12 +57,14 @@ func AuthMiddleware(db *Database, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		logger := requestLogger(r.Context()).With("token_id", apiToken.ID)
 		if err := db.UpdateApiTokenLastUsed(apiToken.ID); err != nil {
-			log.Printf("Failed to update token last_used: %v", err)
+			logger.Warn("failed to update token last used", "error", err)
 		}
 
-		// add token to request context
+		// add token and logger carrying request and token IDs to request context
 		ctx := context.WithValue(r.Context(), TokenContextKey, apiToken)
+		ctx = context.WithValue(ctx, LoggerContextKey, logger)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -71,15 +75,29 @@ func SetupRoutes(app *App, db *Database) http.Handler {
 
 	mux.HandleFunc("GET /api/entries", AuthMiddleware(db, handler.getUnimportedEntries))
 	mux.HandleFunc("POST /api/entries/mark", AuthMiddleware(db, handler.markEntriesAsImported))
+	mux.HandleFunc("GET /api/exports/{format}", AuthMiddleware(db, handler.exportEntries))
+	mux.HandleFunc("GET /api/audit", AuthMiddleware(db, handler.getAuditLog))
+	mux.HandleFunc("GET /api/timesheets", AuthMiddleware(db, handler.getTimesheets))
+	mux.HandleFunc("GET /api/timesheets/{user}/{week}", AuthMiddleware(db, handler.getTimesheetEntries))
+
+	// probes of orchestrators do not carry tokens
+	mux.HandleFunc("GET /healthz", handler.getHealth)
+	mux.HandleFunc("GET /readyz", handler.getReady)
+
+	// metrics are served only when their own token is configured
+	metrics := app.bot.metrics
+	if app.cfg.MetricsToken != "" {
+		mux.HandleFunc("GET /metrics", MetricsHandler(metrics, db, app.cfg.MetricsToken))
+	}
 
-	return mux
+	return RequestLogMiddleware(metrics.Middleware(mux))
 }
 
 func StartAPIServer(app *App, db *Database, port int) error {
 	handler := SetupRoutes(app, db)
 	addr := fmt.Sprintf(":%d", port)
 
-	log.Printf("Starting API server on %s\n", addr)
+	slog.Info("starting API server", "addr", addr)
 	return http.ListenAndServe(addr, handler)
 }
 
@@ -97,6 +115,19 @@ const (
 	FAILED_FETCH         ErrorCode = "FAILED_FETCH"
 	ENTRY_NOT_FOUND      ErrorCode = "ENTRY_NOT_FOUND"
 	IMPORT_FAILED        ErrorCode = "IMPORT_FAILED"
+
+	// Export related error codes
+	UNKNOWN_FORMAT ErrorCode = "UNKNOWN_FORMAT"
+	INVALID_RANGE  ErrorCode = "INVALID_RANGE"
+	EXPORT_FAILED  ErrorCode = "EXPORT_FAILED"
+
+	// Timesheet related error codes
+	INVALID_STATE          ErrorCode = "INVALID_STATE"
+	TIMESHEET_NOT_FOUND    ErrorCode = "TIMESHEET_NOT_FOUND"
+	TIMESHEET_NOT_APPROVED ErrorCode = "TIMESHEET_NOT_APPROVED"
+
+	// Health related error codes
+	NOT_READY ErrorCode = "NOT_READY"
 )
 
 type Response struct {
@@ -140,7 +171,7 @@ func RespondWithMessage(w http.ResponseWriter, statusCode int, message string, s
 func (h *APIHandler) getUnimportedEntries(w http.ResponseWriter, r *http.Request) {
 	entries, err := h.db.GetUnimportedEntries()
 	if err != nil {
-		log.Println(fmt.Sprintf("Failed to retrieve entries: %v", err))
+		requestLogger(r.Context()).Error("failed to retrieve entries", "error", err)
 		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch unimported entries.")
 		return
 	}
@@ -150,15 +181,39 @@ func (h *APIHandler) getUnimportedEntries(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	rounding, err := h.db.GetRoundingRules(h.app.cfg.Rounding)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve rounding rules", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch unimported entries.")
+		return
+	}
+
+	now := time.Now()
+	payload := make([]EntryPayload, 0, len(entries))
+	for _, entry := range entries {
+		payload = append(payload, EntryPayload{
+			Entry:                  entry,
+			DurationSeconds:        int64(entry.Duration(now).Seconds()),
+			RoundedDurationSeconds: int64(rounding.Duration(entry, now).Seconds()),
+		})
+	}
+
 	RespondWithJSON(w, http.StatusOK, struct {
-		Total   int     `json:"total"`
-		Entries []Entry `json:"entries"`
+		Total   int            `json:"total"`
+		Entries []EntryPayload `json:"entries"`
 	}{
 		Total:   len(entries),
-		Entries: entries,
+		Entries: payload,
 	})
 }
 
+// Entry as returned by the API, with exact and rounded duration
+type EntryPayload struct {
+	Entry
+	DurationSeconds        int64 `json:"duration_seconds"`
+	RoundedDurationSeconds int64 `json:"rounded_duration_seconds"`
+}
+
 func (h *APIHandler) markEntriesAsImported(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		EntryIDs []int64 `json:"entry_ids"`
@@ -171,7 +226,7 @@ func (h *APIHandler) markEntriesAsImported(w http.ResponseWriter, r *http.Reques
 
 	// Validate request
 	if len(req.EntryIDs) == 0 {
-		log.Println("User tried to submit request without 'entry_ids' parameter.")
+		requestLogger(r.Context()).Info("request without entry_ids parameter")
 		RespondWithError(w, http.StatusBadRequest, MISSING_PARAMS, "You must provide 'entry_ids' into body.")
 		return
 	}
@@ -179,40 +234,45 @@ func (h *APIHandler) markEntriesAsImported(w http.ResponseWriter, r *http.Reques
 	// get unimported count
 	entries, err := h.db.GetUnimportedEntries()
 	if err != nil {
-		log.Println(fmt.Sprintf("Failed to retrieve unimported entries: %v", err))
+		requestLogger(r.Context()).Error("failed to retrieve unimported entries", "error", err)
 		return
 	}
 	remainingUnimportedCount := len(entries)
 
 	if remainingUnimportedCount == 0 {
-		log.Println("There are no entries to import.")
+		requestLogger(r.Context()).Debug("no entries to import")
 		RespondWithError(w, http.StatusNotFound, NO_ENTRIES_TO_IMPORT, "There are no entries to import.")
 		return
 	}
 
+	actor := ActorSystem
+	if token, ok := r.Context().Value(TokenContextKey).(*ApiToken); ok {
+		actor = tokenActor(token.ID)
+	}
+
 	// Update import status for each entry
 	var importedCount int
 	for _, entryID := range req.EntryIDs {
 		exists, isUnimported, err := h.db.CheckEntry(int(entryID))
 		if err != nil {
-			log.Println(fmt.Sprintf("Error checking entry %d import status: %v", entryID, err))
+			requestLogger(r.Context()).Error("failed to check entry import status", "entry_id", entryID, "error", err)
 			continue
 		}
 
 		// Skips if entry doesn't exist or is already imported
 		if !exists {
-			log.Println(fmt.Sprintf("Entry %d not found!", entryID))
+			requestLogger(r.Context()).Info("entry to mark not found", "entry_id", entryID)
 			continue
 		}
 
 		// Skips if entry with this id is already imported
 		if !isUnimported {
-			log.Println(fmt.Sprintf("Entry %d is already imported, skipping.", entryID))
+			requestLogger(r.Context()).Info("entry already imported, skipping", "entry_id", entryID)
 			continue
 		}
 
-		if err := h.db.UpdateEntryImportStatus(int(entryID)); err != nil {
-			log.Printf("Failed to mark entry %d as imported: %v", entryID, err)
+		if err := h.db.UpdateEntryImportStatus(actor, int(entryID)); err != nil {
+			requestLogger(r.Context()).Error("failed to mark entry as imported", "entry_id", entryID, "error", err)
 			continue
 		}
 		importedCount++
@@ -226,3 +286,255 @@ func (h *APIHandler) markEntriesAsImported(w http.ResponseWriter, r *http.Reques
 		RemainingCount: remainingUnimportedCount,
 	})
 }
+
+// Exports entries as file in requested format.
+//
+// Query parameters: user, period or from/to (YYYY-MM-DD), tz, email, name
+func (h *APIHandler) exportEntries(w http.ResponseWriter, r *http.Request) {
+	exporter, ok := getExporter(r.PathValue("format"))
+	if !ok {
+		RespondWithError(w, http.StatusNotFound, UNKNOWN_FORMAT, "Unknown export format. Available formats: "+strings.Join(exporterNames(), ", "))
+		return
+	}
+
+	query := r.URL.Query()
+	now := time.Now()
+
+	if requiresEmail(exporter) && query.Get("email") == "" {
+		RespondWithError(w, http.StatusBadRequest, MISSING_PARAMS, "Export to "+exporter.Name()+" requires email parameter.")
+		return
+	}
+
+	from, to, loc, err := resolveRange(h.app.cfg, now, query.Get("period"), query.Get("from"), query.Get("to"), query.Get("tz"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, INVALID_RANGE, err.Error())
+		return
+	}
+
+	var entries []Entry
+	if userID := query.Get("user"); userID != "" {
+		entries, err = h.db.GetEntriesBetween(userID, from, to)
+	} else {
+		entries, err = h.db.GetAllEntriesBetween(from, to)
+	}
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve entries for export", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch entries.")
+		return
+	}
+
+	clients, err := h.db.GetProjectClients()
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve project clients", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch projects.")
+		return
+	}
+
+	rounding, err := h.db.GetRoundingRules(h.app.cfg.Rounding)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve rounding rules", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch projects.")
+		return
+	}
+
+	data, err := exportToBytes(exporter, entries, ExportOptions{
+		Location: loc,
+		Now:      now,
+		Clients:  clients,
+		Email:    query.Get("email"),
+		Name:     query.Get("name"),
+		Rounding: rounding,
+	})
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to export entries", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, EXPORT_FAILED, "Failed to export entries.")
+		return
+	}
+
+	name := exportFileName(exporter.Name(), from, to, exporter.Extension())
+	w.Header().Set("Content-Type", exporter.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Timesheet as returned by the API, with totals and optionally its entries
+type TimesheetPayload struct {
+	Timesheet
+	SubmittedAt    *time.Time     `json:"submitted_at,omitempty"`
+	ReviewedAt     *time.Time     `json:"reviewed_at,omitempty"`
+	TotalSeconds   int64          `json:"total_seconds"`
+	RoundedSeconds int64          `json:"rounded_seconds"`
+	Entries        []EntryPayload `json:"entries,omitempty"`
+}
+
+// Builds API payload of timesheet from entries of its week
+func newTimesheetPayload(ts Timesheet, entries []Entry, rounding RoundingRules, now time.Time, withEntries bool) TimesheetPayload {
+	payload := TimesheetPayload{Timesheet: ts}
+	if ts.SubmittedAt.Valid {
+		payload.SubmittedAt = &ts.SubmittedAt.Time
+	}
+	if ts.ReviewedAt.Valid {
+		payload.ReviewedAt = &ts.ReviewedAt.Time
+	}
+
+	for _, entry := range entries {
+		duration := int64(entry.Duration(now).Seconds())
+		rounded := int64(rounding.Duration(entry, now).Seconds())
+		payload.TotalSeconds += duration
+		payload.RoundedSeconds += rounded
+		if withEntries {
+			payload.Entries = append(payload.Entries, EntryPayload{Entry: entry, DurationSeconds: duration, RoundedDurationSeconds: rounded})
+		}
+	}
+	return payload
+}
+
+// Lists timesheets with their totals, only approved ones unless state is given.
+//
+// Query parameters: state (open, submitted, approved, rejected or all), user,
+// from and to (weeks as YYYY-MM-DD, inclusive)
+func (h *APIHandler) getTimesheets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	state := query.Get("state")
+	switch state {
+	case "":
+		state = TimesheetApproved
+	case "all":
+		state = ""
+	case TimesheetOpen, TimesheetSubmitted, TimesheetApproved, TimesheetRejected:
+	default:
+		RespondWithError(w, http.StatusBadRequest, INVALID_STATE, "Unknown state. Use open, submitted, approved, rejected or all.")
+		return
+	}
+
+	timesheets, err := h.db.GetTimesheets(state, query.Get("user"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve timesheets", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheets.")
+		return
+	}
+
+	rounding, err := h.db.GetRoundingRules(h.app.cfg.Rounding)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve rounding rules", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheets.")
+		return
+	}
+
+	now := time.Now()
+	payload := make([]TimesheetPayload, 0, len(timesheets))
+	for _, ts := range timesheets {
+		entries, err := h.db.GetEntriesBetween(ts.UserID, ts.PeriodStart, ts.PeriodEnd)
+		if err != nil {
+			requestLogger(r.Context()).Error("failed to retrieve entries of timesheet", "error", err)
+			RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheets.")
+			return
+		}
+		payload = append(payload, newTimesheetPayload(ts, entries, rounding, now, false))
+	}
+
+	RespondWithJSON(w, http.StatusOK, struct {
+		Total      int                `json:"total"`
+		Timesheets []TimesheetPayload `json:"timesheets"`
+	}{
+		Total:      len(payload),
+		Timesheets: payload,
+	})
+}
+
+// Gets approved timesheet of user with its entries. Week is date of its Monday.
+func (h *APIHandler) getTimesheetEntries(w http.ResponseWriter, r *http.Request) {
+	ts, err := h.db.GetTimesheet(r.PathValue("user"), r.PathValue("week"))
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve timesheet", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheet.")
+		return
+	}
+	if ts.State == TimesheetOpen && ts.PeriodStart.IsZero() {
+		RespondWithError(w, http.StatusNotFound, TIMESHEET_NOT_FOUND, "Timesheet was not submitted.")
+		return
+	}
+	if ts.State != TimesheetApproved {
+		RespondWithError(w, http.StatusConflict, TIMESHEET_NOT_APPROVED, "Timesheet is "+ts.State+", only approved timesheets can be pulled.")
+		return
+	}
+
+	entries, err := h.db.GetEntriesBetween(ts.UserID, ts.PeriodStart, ts.PeriodEnd)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve entries of timesheet", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheet.")
+		return
+	}
+
+	rounding, err := h.db.GetRoundingRules(h.app.cfg.Rounding)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve rounding rules", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch timesheet.")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, newTimesheetPayload(ts, entries, rounding, time.Now(), true))
+}
+
+// Lists audit records, newest first.
+//
+// Query parameters: entity (entry, import or token), entity_id, actor
+// (e.g. user:123 or token:1), from and to (RFC 3339 or YYYY-MM-DD), limit
+func (h *APIHandler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Entity:   query.Get("entity"),
+		EntityID: query.Get("entity_id"),
+		Actor:    query.Get("actor"),
+		Limit:    100,
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.ParseInLocation(time.DateOnly, value, h.app.cfg.Timezone)
+		}
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, INVALID_RANGE, fmt.Sprintf("Invalid %s, use RFC 3339 time or YYYY-MM-DD.", bound.name))
+			return
+		}
+		*bound.value = t
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			RespondWithError(w, http.StatusBadRequest, INVALID_REQUEST, "Limit must be a positive number.")
+			return
+		}
+		filter.Limit = min(limit, maxAuditLimit)
+	}
+
+	records, err := h.db.GetAuditLog(filter)
+	if err != nil {
+		requestLogger(r.Context()).Error("failed to retrieve audit log", "error", err)
+		RespondWithError(w, http.StatusInternalServerError, FAILED_FETCH, "Failed to fetch audit log.")
+		return
+	}
+	if records == nil {
+		records = []AuditRecord{}
+	}
+	h.db.decryptAuditNotes(records)
+
+	RespondWithJSON(w, http.StatusOK, struct {
+		Total   int           `json:"total"`
+		Records []AuditRecord `json:"records"`
+	}{
+		Total:   len(records),
+		Records: records,
+	})
+}
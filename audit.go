@@ -0,0 +1,282 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Actors of changes which were not made by a user or an API token
+const (
+	ActorSystem = "system"
+	ActorCLI    = "cli"
+)
+
+// Entities recorded in audit log
+const (
+	AuditEntry  = "entry"
+	AuditImport = "import"
+	AuditToken  = "token"
+	AuditNotes  = "notes"
+)
+
+// Maximum number of audit records returned at once
+const maxAuditLimit = 1000
+
+// Single change recorded in the append-only audit log
+type AuditRecord struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	// ID of record reverted by this one, set on undo records
+	UndoneID int64 `json:"undone_id,omitempty"`
+}
+
+// Filters of audit log query, empty values match everything
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+const (
+	insertAuditSQL = `INSERT INTO audit_log (created_at, actor, action, entity, entity_id, before, after, undone_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	getAuditSQL    = `SELECT id, created_at, actor, action, entity, entity_id, before, after, undone_id FROM audit_log
+  WHERE (? = '' OR entity = ?) AND (? = '' OR entity_id = ?) AND (? = '' OR actor = ?)
+  AND (? = 0 OR unixepoch(created_at) >= ?) AND (? = 0 OR unixepoch(created_at) < ?)
+  ORDER BY id DESC LIMIT ?`
+	getEntryByIDSQL    = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable, deleted_at FROM entries WHERE id = ?`
+	getBatchEntriesSQL = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable FROM entries WHERE import_batch = ? AND deleted_at IS NULL`
+)
+
+// Gets actor name of Telegram user
+func userActor(userID string) string {
+	return "user:" + userID
+}
+
+// Gets actor name of API token
+func tokenActor(tokenID int) string {
+	return "token:" + strconv.Itoa(tokenID)
+}
+
+// Records change in the transaction making it. Nil before or after is
+// stored as NULL, e.g. for created or deleted entities.
+func writeAudit(tx *sql.Tx, actor string, action string, entity string, entityID any, before any, after any) error {
+	return insertAudit(tx, actor, action, entity, entityID, before, after, nil)
+}
+
+// Records undo of audit record with given ID
+func writeUndoAudit(tx *sql.Tx, actor string, undoneID int64, entity string, entityID any, before any, after any) error {
+	return insertAudit(tx, actor, "undo", entity, entityID, before, after, undoneID)
+}
+
+func insertAudit(tx *sql.Tx, actor string, action string, entity string, entityID any, before any, after any, undoneID any) error {
+	var values [2]any
+	for i, state := range []any{before, after} {
+		if state == nil {
+			continue
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit record: %w", err)
+		}
+		values[i] = string(data)
+	}
+
+	if _, err := tx.Exec(insertAuditSQL, time.Now(), actor, action, entity, fmt.Sprint(entityID), values[0], values[1], undoneID); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Scans single row selected with full entry column list, including deletion time
+func scanEntry(row rowScanner) (Entry, error) {
+	var entry Entry
+	err := row.Scan(&entry.ID, &entry.UserID, &entry.StartTime, &entry.EndTime, &entry.Note, &entry.Project, &entry.Active, &entry.ImportedAt, &entry.Billable, &entry.DeletedAt)
+	return entry, err
+}
+
+// Gets entry by ID, in transaction or outside of it
+func getEntryByID(q rowQuerier, entryID int64) (Entry, error) {
+	entry, err := scanEntry(q.QueryRow(getEntryByIDSQL, entryID))
+	if err == sql.ErrNoRows {
+		return Entry{}, fmt.Errorf("Entry %d was not found.", entryID)
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to get entry %d: %w", entryID, err)
+	}
+	return entry, nil
+}
+
+// Gets audit records matching filter, newest first
+func (db *Database) GetAuditLog(filter AuditFilter) ([]AuditRecord, error) {
+	var from, to int64
+	if !filter.From.IsZero() {
+		from = filter.From.Unix()
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.Unix()
+	}
+	if filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	rows, err := db.conn.Query(getAuditSQL,
+		filter.Entity, filter.Entity, filter.EntityID, filter.EntityID, filter.Actor, filter.Actor,
+		from, from, to, to, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var records []AuditRecord
+	for rows.Next() {
+		var record AuditRecord
+		var before, after sql.NullString
+		var undoneID sql.NullInt64
+		if err := rows.Scan(&record.ID, &record.CreatedAt, &record.Actor, &record.Action, &record.Entity, &record.EntityID, &before, &after, &undoneID); err != nil {
+			return nil, fmt.Errorf("failed to scan audit record: %w", err)
+		}
+		if before.Valid {
+			record.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			record.After = json.RawMessage(after.String)
+		}
+		record.UndoneID = undoneID.Int64
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Describes fields which differ between before and after state,
+// e.g. "billable: true → false"
+func describeAuditChange(before json.RawMessage, after json.RawMessage) string {
+	var old, new map[string]any
+	json.Unmarshal(before, &old)
+	json.Unmarshal(after, &new)
+
+	keys := make(map[string]bool)
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range new {
+		keys[key] = true
+	}
+
+	var changes []string
+	for key := range keys {
+		from, to := auditValue(old[key]), auditValue(new[key])
+		if from == to {
+			continue
+		}
+		// created and deleted entities show only their content
+		if (old == nil || new == nil) && (key == "id" || key == "user_id" || from == "-" && to == "-") {
+			continue
+		}
+		switch {
+		case old == nil:
+			changes = append(changes, key+": "+to)
+		case new == nil:
+			changes = append(changes, key+" was "+from)
+		default:
+			changes = append(changes, key+": "+from+" → "+to)
+		}
+	}
+	sort.Strings(changes)
+	return strings.Join(changes, ", ")
+}
+
+// Formats value of decoded JSON field. Nullable times are shown as
+// their time or "-".
+func auditValue(value any) string {
+	if nullable, ok := value.(map[string]any); ok {
+		if valid, _ := nullable["Valid"].(bool); !valid {
+			return "-"
+		}
+		value = nullable["Time"]
+	}
+	if value == nil {
+		return "-"
+	}
+	if text, ok := value.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+			return t.Format("2006-01-02 15:04:05")
+		}
+		return strconv.Quote(text)
+	}
+	return fmt.Sprint(value)
+}
+
+// Shows recorded changes of entry. Members can see only their own entries.
+//
+// Usage:
+//
+//	/history <entry-id>
+func (b *Bot) handleHistoryCommand(message *tgbotapi.Message, userID string, args string) {
+	entryID, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, "Usage: /history <entry-id>", message.MessageID)
+		return
+	}
+
+	records, err := b.db.GetAuditLog(AuditFilter{Entity: AuditEntry, EntityID: strconv.FormatInt(entryID, 10), Limit: 50})
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if len(records) == 0 {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("There is no history of entry %d.", entryID), message.MessageID)
+		return
+	}
+	b.db.decryptAuditNotes(records)
+
+	// owner is taken from the latest state, which also covers deleted entries
+	var owner struct {
+		UserID string `json:"user_id"`
+	}
+	latest := records[0].After
+	if latest == nil {
+		latest = records[0].Before
+	}
+	json.Unmarshal(latest, &owner)
+
+	role, _ := b.userRole(message.From.ID)
+	if owner.UserID != userID && !roleAllows(role, RoleManager) {
+		b.sendMessage(message.Chat.ID, "You can see history only of your own entries.", message.MessageID)
+		return
+	}
+
+	lines := []string{fmt.Sprintf("📜 History of entry %d:", entryID)}
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		line := fmt.Sprintf("• %s %s by %s", record.CreatedAt.In(b.cfg.Timezone).Format("2006-01-02 15:04"), record.Action, b.describeActor(record.Actor))
+		if change := describeAuditChange(record.Before, record.After); change != "" {
+			line += ": " + change
+		}
+		lines = append(lines, line)
+	}
+	b.sendMessage(message.Chat.ID, strings.Join(lines, "\n"), message.MessageID)
+}
+
+// Shows user actors by name when it is known
+func (b *Bot) describeActor(actor string) string {
+	if userID, ok := strings.CutPrefix(actor, "user:"); ok {
+		return b.userName(userID)
+	}
+	return actor
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMutationsWriteAudit(t *testing.T) {
+	db := newTestDatabase(t)
+
+	entry, err := db.StartTracking("1", "note", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mutate     func() error
+		entity     string
+		entityID   string
+		actor      string
+		action     string
+		wantBefore bool
+		wantAfter  bool
+	}{
+		{"start", func() error { return nil }, AuditEntry, "1", "user:1", "start", false, true},
+		{"stop", func() error {
+			_, err := db.StopTracking("1")
+			return err
+		}, AuditEntry, "1", "user:1", "stop", true, true},
+		{"billable", func() error {
+			_, err := db.SetEntryBillable("1", entry.ID, false)
+			return err
+		}, AuditEntry, "1", "user:1", "billable", true, true},
+		{"mark imported", func() error {
+			return db.UpdateEntryImportStatus(tokenActor(7), int(entry.ID))
+		}, AuditEntry, "1", "token:7", "mark_imported", true, true},
+		{"create token", func() error {
+			return db.CreateApiToken(ActorCLI, "secret")
+		}, AuditToken, "1", ActorCLI, "create", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mutate(); err != nil {
+				t.Fatalf("mutation error = %v", err)
+			}
+
+			records, err := db.GetAuditLog(AuditFilter{Entity: tt.entity, EntityID: tt.entityID, Limit: 1})
+			if err != nil {
+				t.Fatalf("GetAuditLog() error = %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("GetAuditLog() returned %d records, want 1", len(records))
+			}
+			record := records[0]
+			if record.Action != tt.action || record.Actor != tt.actor {
+				t.Errorf("record = %s by %s, want %s by %s", record.Action, record.Actor, tt.action, tt.actor)
+			}
+			if (record.Before != nil) != tt.wantBefore || (record.After != nil) != tt.wantAfter {
+				t.Errorf("record before = %s, after = %s", record.Before, record.After)
+			}
+		})
+	}
+}
+
+func TestAuditSharesTransactionWithMutation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(db *Database) error
+	}{
+		{"start", func(db *Database) error {
+			_, err := db.StartTracking("2", "", "")
+			return err
+		}},
+		{"stop", func(db *Database) error {
+			_, err := db.StopTracking("1")
+			return err
+		}},
+		{"stop at", func(db *Database) error {
+			_, err := db.StopEntryAt(userActor("1"), "1", 1, time.Now())
+			return err
+		}},
+		{"billable", func(db *Database) error {
+			_, err := db.SetEntryBillable("1", 1, false)
+			return err
+		}},
+		{"mark imported", func(db *Database) error {
+			return db.UpdateEntryImportStatus(ActorCLI, 1)
+		}},
+		{"delete", func(db *Database) error {
+			_, err := db.DeleteEntry("1", 1)
+			return err
+		}},
+		{"import", func(db *Database) error {
+			_, err := db.ImportEntries(userActor("1"), "1", "csv", "file.csv", []ImportedEntry{{
+				Start: time.Now().Add(-48 * time.Hour),
+				End:   time.Now().Add(-47 * time.Hour),
+			}})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			before, err := db.StartTracking("1", "note", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// audit log which refuses writes must make the whole change fail
+			if _, err := db.conn.Exec(`CREATE TRIGGER audit_log_down BEFORE INSERT ON audit_log
+  BEGIN SELECT RAISE(ABORT, 'audit log is down'); END`); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.mutate(db); err == nil {
+				t.Fatal("mutation without audit record succeeded")
+			}
+
+			var entries int
+			if err := db.conn.QueryRow(`SELECT COUNT(*) FROM entries`).Scan(&entries); err != nil {
+				t.Fatal(err)
+			}
+			after, err := getEntryByID(db.conn, before.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries != 1 || after != before {
+				t.Errorf("entries changed without audit record: %d entries, %+v, want %+v", entries, after, before)
+			}
+		})
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.StartTracking("1", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{`UPDATE audit_log SET actor = 'someone'`, `DELETE FROM audit_log`} {
+		if _, err := db.conn.Exec(query); err == nil {
+			t.Errorf("%s succeeded", query)
+		}
+	}
+}
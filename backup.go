@@ -0,0 +1,345 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backups are named by time they were made, so they sort chronologically
+const (
+	backupPrefix     = "timetick-"
+	backupTimeFormat = "20060102-150405"
+)
+
+// Where and how scheduled and CLI backups are written
+type BackupOptions struct {
+	Dir  string
+	Gzip bool
+	// Number of newest backups kept in Dir, zero keeps all
+	Keep int
+}
+
+// Result of checking backup file
+type BackupInfo struct {
+	SchemaVersion int
+	Entries       int
+}
+
+// Copies database into a new SQLite file at path using SQLite's online
+// backup API, which gives a consistent snapshot while the bot keeps writing.
+func (db *Database) BackupTo(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	return copyDatabase(db.conn, path, true)
+}
+
+// Makes timestamped backup in options' directory, compresses it when
+// requested and removes the oldest backups over the kept number.
+// Returns path of the new backup.
+func (db *Database) CreateBackup(opts BackupOptions, now time.Time) (string, error) {
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(opts.Dir, backupPrefix+now.Format(backupTimeFormat)+".db")
+	if err := db.BackupTo(path); err != nil {
+		return "", err
+	}
+
+	if opts.Gzip {
+		if err := gzipFile(path, path+".gz"); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		os.Remove(path)
+		path += ".gz"
+	}
+
+	if _, err := rotateBackups(opts.Dir, opts.Keep); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Copies all pages of the main database of src into a database file at
+// path. When create is false, path must be an existing database which is
+// overwritten.
+func copyDatabase(src *sql.DB, path string, create bool) error {
+	mode := "rw"
+	if create {
+		mode = "rwc"
+	}
+	dest, err := sql.Open("sqlite3", "file:"+path+"?mode="+mode)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer srcConn.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// single step copies everything while holding the read lock once
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy database to %s: %w", path, err)
+	}
+	return nil
+}
+
+// Opens backup and checks its integrity. Gzipped backups are checked
+// after decompressing them to a temporary file.
+func VerifyBackup(path string) (BackupInfo, error) {
+	plain, cleanup, err := uncompressedBackup(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	defer cleanup()
+
+	return verifyDatabaseFile(plain)
+}
+
+func verifyDatabaseFile(path string) (BackupInfo, error) {
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to check backup: %w", err)
+	}
+	if result != "ok" {
+		return BackupInfo{}, fmt.Errorf("backup is corrupted: %s", result)
+	}
+
+	var info BackupInfo
+	if err := conn.QueryRow(`PRAGMA user_version`).Scan(&info.SchemaVersion); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if info.SchemaVersion == 0 {
+		return BackupInfo{}, fmt.Errorf("%s is not a database of this bot", path)
+	}
+	if info.SchemaVersion > len(migrations) {
+		return BackupInfo{}, fmt.Errorf("backup has schema version %d, newer than %d supported by this build", info.SchemaVersion, len(migrations))
+	}
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM entries`).Scan(&info.Entries); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to count entries: %w", err)
+	}
+	return info, nil
+}
+
+// Replaces database at dbPath with verified backup. The replaced database
+// is kept next to it with ".before-restore" suffix. The bot must not be
+// running while restoring.
+func RestoreBackup(path string, dbPath string, now time.Time) (BackupInfo, error) {
+	plain, cleanup, err := uncompressedBackup(path)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	defer cleanup()
+
+	info, err := verifyDatabaseFile(plain)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+plain+"?mode=ro")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	if _, err := os.Stat(dbPath); err == nil {
+		current, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			return BackupInfo{}, fmt.Errorf("failed to open database: %w", err)
+		}
+		saved := dbPath + ".before-restore-" + now.Format(backupTimeFormat)
+		err = copyDatabase(current, saved, true)
+		current.Close()
+		if err != nil {
+			return BackupInfo{}, err
+		}
+		return info, copyDatabase(src, dbPath, false)
+	}
+
+	return info, copyDatabase(src, dbPath, true)
+}
+
+// Gets path of plain database file of backup, decompressing gzipped
+// backups into a temporary file removed by the returned cleanup.
+func uncompressedBackup(path string) (string, func(), error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return path, func() {}, nil
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer in.Close()
+
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "timetick-backup-*.db")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// Compresses file at src into dst
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	return nil
+}
+
+// Gets names of backups in dir, oldest first. Other files are skipped.
+func listBackups(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []string
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasPrefix(name, backupPrefix) && (strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.gz")) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Gets time the newest backup in dir was made, zero time if there is none.
+// Backup times are written in local time of the process which made them.
+func lastBackupTime(dir string) (time.Time, error) {
+	backups, err := listBackups(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(backups[i], backupPrefix), ".gz"), ".db")
+		if at, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local); err == nil {
+			return at, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// Makes backup like CreateBackup when the newest backup in options'
+// directory is at least interval old. Last backup time is read from the
+// backups themselves, so restarts of the bot do not postpone backups.
+// Returns empty path when no backup was due.
+func (db *Database) BackupIfDue(opts BackupOptions, interval time.Duration, now time.Time) (string, error) {
+	last, err := lastBackupTime(opts.Dir)
+	if err != nil {
+		return "", err
+	}
+	if !last.IsZero() && now.Sub(last) < interval {
+		return "", nil
+	}
+	return db.CreateBackup(opts, now)
+}
+
+// Removes the oldest backups in dir so that only keep newest remain.
+// Other files in dir are left alone. Returns paths of removed backups.
+func rotateBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	backups, err := listBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for len(backups) > keep {
+		path := filepath.Join(dir, backups[0])
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		removed = append(removed, path)
+		backups = backups[1:]
+	}
+	return removed, nil
+}
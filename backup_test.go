@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRotateBackups(t *testing.T) {
+	backups := []string{
+		"timetick-20240101-000000.db",
+		"timetick-20240102-000000.db.gz",
+		"timetick-20240103-000000.db",
+		"timetick-20240104-000000.db.gz",
+	}
+	others := []string{
+		"notes.txt",
+		"timetick-20230101-000000.db-journal",
+		"other-20230101-000000.db",
+	}
+
+	tests := []struct {
+		name        string
+		keep        int
+		wantRemoved []string
+	}{
+		{"keep all", 0, nil},
+		{"negative keeps all", -1, nil},
+		{"keep more than existing", 10, nil},
+		{"keep as many as existing", 4, nil},
+		{"keep two", 2, backups[:2]},
+		{"keep one", 1, backups[:3]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range append(slices.Clone(backups), others...) {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Mkdir(filepath.Join(dir, "timetick-20230101-000000.db.d"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := rotateBackups(dir, tt.keep)
+			if err != nil {
+				t.Fatalf("rotateBackups() error = %v", err)
+			}
+
+			var wantRemoved []string
+			for _, name := range tt.wantRemoved {
+				wantRemoved = append(wantRemoved, filepath.Join(dir, name))
+			}
+			if !slices.Equal(removed, wantRemoved) {
+				t.Errorf("rotateBackups() removed %v, want %v", removed, wantRemoved)
+			}
+
+			for _, name := range append(slices.Clone(backups), others...) {
+				_, err := os.Stat(filepath.Join(dir, name))
+				gone, wantGone := os.IsNotExist(err), slices.Contains(tt.wantRemoved, name)
+				if gone != wantGone {
+					t.Errorf("%s removed = %v, want %v", name, gone, wantGone)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateBackupGzip(t *testing.T) {
+	db := newTestDatabase(t)
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	var paths []string
+	for i := range 3 {
+		path, err := db.CreateBackup(BackupOptions{Dir: dir, Gzip: true, Keep: 2}, now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("CreateBackup() error = %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("oldest backup %s was not rotated away", paths[0])
+	}
+	for _, path := range paths[1:] {
+		if filepath.Ext(path) != ".gz" {
+			t.Errorf("backup %s is not gzipped", path)
+		}
+		info, err := VerifyBackup(path)
+		if err != nil {
+			t.Fatalf("VerifyBackup(%s) error = %v", path, err)
+		}
+		if info.SchemaVersion != len(migrations) {
+			t.Errorf("VerifyBackup(%s) schema version = %d, want %d", path, info.SchemaVersion, len(migrations))
+		}
+	}
+}
+
+func TestBackupIfDue(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		existing []string
+		want     bool
+	}{
+		{"no backups yet", nil, true},
+		{"newest is recent", []string{"timetick-20240302-120000.db.gz", "timetick-20240304-020000.db.gz"}, false},
+		{"newest is overdue", []string{"timetick-20240303-115959.db.gz"}, true},
+		{"only other files", []string{"notes.txt", "timetick-20240304-020000.db-journal"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			dir := filepath.Join(t.TempDir(), "backups")
+			if len(tt.existing) > 0 {
+				if err := os.Mkdir(dir, 0o700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path, err := db.BackupIfDue(BackupOptions{Dir: dir, Gzip: true}, 24*time.Hour, now)
+			if err != nil {
+				t.Fatalf("BackupIfDue() error = %v", err)
+			}
+			if got := path != ""; got != tt.want {
+				t.Errorf("BackupIfDue() made backup %q, want backup %v", path, tt.want)
+			}
+
+			// the backup just made counts as the last one
+			if tt.want {
+				again, err := db.BackupIfDue(BackupOptions{Dir: dir, Gzip: true}, 24*time.Hour, now.Add(time.Hour))
+				if err != nil || again != "" {
+					t.Errorf("BackupIfDue() an hour later = %q, %v, want no backup", again, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Hourly rate valid from a date until the next rate with the same scope.
+// Empty user, project or client matches any value, so a rate with all
+// three empty is the default rate.
+type Rate struct {
+	ID          int64
+	UserID      string
+	Project     string
+	Client      string
+	HourlyCents int64
+	// Local date in YYYY-MM-DD format
+	EffectiveFrom string
+}
+
+// All rates, used to find rate of each entry
+type RateTable []Rate
+
+const (
+	getRatesSQL   = `SELECT id, user_id, project, client, hourly_cents, effective_from FROM rates ORDER BY effective_from, id`
+	upsertRateSQL = `
+  INSERT INTO rates (user_id, project, client, hourly_cents, effective_from) VALUES (?, ?, ?, ?, ?)
+  ON CONFLICT(user_id, project, client, effective_from) DO UPDATE SET hourly_cents = excluded.hourly_cents`
+	deleteRateSQL          = `DELETE FROM rates WHERE id = ?`
+	getLastEntrySQL        = `SELECT id FROM entries WHERE user_id = ? AND deleted_at IS NULL ORDER BY unixepoch(start_time) DESC LIMIT 1`
+	updateEntryBillableSQL = `UPDATE entries SET billable = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+)
+
+// Checks if rate applies to entry of user on project belonging to client
+func (r Rate) matches(userID string, project string, client string) bool {
+	return (r.UserID == "" || r.UserID == userID) &&
+		(r.Project == "" || r.Project == project) &&
+		(r.Client == "" || r.Client == client)
+}
+
+// Gets how specific the rate is. Project rates win over client rates,
+// which win over user rates.
+func (r Rate) specificity() int {
+	score := 0
+	if r.Project != "" {
+		score += 4
+	}
+	if r.Client != "" {
+		score += 2
+	}
+	if r.UserID != "" {
+		score++
+	}
+	return score
+}
+
+// Describes scope of the rate, e.g. "project acme, user 123"
+func (r Rate) Scope() string {
+	var parts []string
+	if r.Project != "" {
+		parts = append(parts, "project "+r.Project)
+	}
+	if r.Client != "" {
+		parts = append(parts, "client "+r.Client)
+	}
+	if r.UserID != "" {
+		parts = append(parts, "user "+r.UserID)
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Finds the most specific rate effective on day (YYYY-MM-DD). Among rates
+// of the same scope the latest effective one is used.
+func (t RateTable) Find(userID string, project string, client string, day string) (Rate, bool) {
+	var found Rate
+	ok := false
+	for _, rate := range t {
+		if rate.EffectiveFrom > day || !rate.matches(userID, project, client) {
+			continue
+		}
+		if !ok || rate.specificity() > found.specificity() ||
+			(rate.specificity() == found.specificity() && rate.EffectiveFrom >= found.EffectiveFrom) {
+			found = rate
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// Gets all rates ordered by effective date
+func (db *Database) GetRates() (RateTable, error) {
+	rows, err := db.conn.Query(getRatesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates RateTable
+	for rows.Next() {
+		var rate Rate
+		if err := rows.Scan(&rate.ID, &rate.UserID, &rate.Project, &rate.Client, &rate.HourlyCents, &rate.EffectiveFrom); err != nil {
+			return nil, fmt.Errorf("failed to scan rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// Adds rate, replacing rate of the same scope effective on the same date
+func (db *Database) SetRate(rate Rate) error {
+	if _, err := db.conn.Exec(upsertRateSQL, rate.UserID, rate.Project, rate.Client, rate.HourlyCents, rate.EffectiveFrom); err != nil {
+		return fmt.Errorf("failed to save rate: %w", err)
+	}
+	return nil
+}
+
+// Deletes rate by ID. Returns true if it existed.
+func (db *Database) DeleteRate(id int64) (bool, error) {
+	res, err := db.conn.Exec(deleteRateSQL, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete rate: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// Marks entry of user as billable or not. Zero entry ID selects the
+// running or most recently started entry. Returns ID of updated entry.
+func (db *Database) SetEntryBillable(userID string, entryID int64, billable bool) (int64, error) {
+	if entryID == 0 {
+		err := db.conn.QueryRow(getLastEntrySQL, userID).Scan(&entryID)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("You have no entries yet.")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to get last entry: %w", err)
+		}
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to update entry %d: %w", entryID, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkUnlocked(tx, lockedEntrySQL, entryID); err != nil {
+		return 0, err
+	}
+
+	before, err := getEntryByID(tx, entryID)
+	if err != nil || before.UserID != userID || before.DeletedAt.Valid {
+		return 0, fmt.Errorf("Entry %d was not found.", entryID)
+	}
+
+	if _, err := tx.Exec(updateEntryBillableSQL, billable, entryID, userID); err != nil {
+		return 0, fmt.Errorf("failed to update entry %d: %w", entryID, err)
+	}
+
+	after, err := getEntryByID(tx, entryID)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeAudit(tx, userActor(userID), "billable", AuditEntry, entryID, before, after); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to update entry %d: %w", entryID, err)
+	}
+	return entryID, nil
+}
+
+// Parses amount like "80" or "80.50" into cents
+func parseMoney(value string) (int64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", "."), 64)
+	if err != nil || amount < 0 || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid amount %q, use e.g. 80 or 80.50", value)
+	}
+	return int64(math.Round(amount * 100)), nil
+}
+
+// Formats cents with currency code, e.g. "1234.50 EUR"
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
+
+// Parses scope and effective date of a rate from arguments like
+// "project acme client Acme Inc user 123 from 2024-01-01". Values of
+// client and project may contain spaces.
+func parseRateScope(fields []string, userID string, loc *time.Location) (Rate, error) {
+	rate := Rate{EffectiveFrom: time.Now().In(loc).Format(time.DateOnly)}
+
+	var key string
+	values := make(map[string][]string)
+	for _, field := range fields {
+		switch lower := strings.ToLower(field); lower {
+		case "project", "client", "user", "from":
+			key = lower
+			values[key] = []string{}
+			continue
+		}
+		if key == "" {
+			return rate, fmt.Errorf("unexpected %q, expected project, client, user or from", field)
+		}
+		values[key] = append(values[key], field)
+	}
+
+	rate.Project = strings.Join(values["project"], " ")
+	rate.Client = strings.Join(values["client"], " ")
+	rate.UserID = strings.Join(values["user"], " ")
+	if rate.UserID == "me" {
+		rate.UserID = userID
+	}
+
+	if from, ok := values["from"]; ok {
+		date := strings.Join(from, "")
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return rate, fmt.Errorf("invalid date %q, use YYYY-MM-DD", date)
+		}
+		rate.EffectiveFrom = date
+	}
+
+	return rate, nil
+}
+
+// Manages hourly rates.
+//
+// Usage:
+//
+//	/rate
+//	/rate set <amount> [project <name>] [client <name>] [user <id|me>] [from YYYY-MM-DD]
+//	/rate remove <id>
+func (b *Bot) handleRateCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+
+	switch {
+	case len(fields) == 0:
+		b.sendMessage(message.Chat.ID, b.describeRates(), message.MessageID)
+	case len(fields) >= 2 && strings.ToLower(fields[0]) == "set":
+		cents, err := parseMoney(fields[1])
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+
+		rate, err := parseRateScope(fields[2:], userID, settings.Location(b.cfg.Timezone))
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s\n\n%s", err, rateUsage), message.MessageID)
+			return
+		}
+		rate.HourlyCents = cents
+
+		if err := b.db.SetRate(rate); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("💰 Rate %s/h for %s from %s.", formatMoney(cents, b.cfg.Currency), rate.Scope(), rate.EffectiveFrom), message.MessageID)
+	case len(fields) == 2 && strings.ToLower(fields[0]) == "remove":
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, rateUsage, message.MessageID)
+			return
+		}
+		deleted, err := b.db.DeleteRate(id)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if !deleted {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("Rate %d was not found.", id), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("💰 Rate %d removed.", id), message.MessageID)
+	default:
+		b.sendMessage(message.Chat.ID, rateUsage, message.MessageID)
+	}
+}
+
+const rateUsage = "Usage:\n" +
+	"/rate - List rates\n" +
+	"/rate set <amount> [project <name>] [client <name>] [user <id|me>] [from YYYY-MM-DD] - Set hourly rate\n" +
+	"/rate remove <id> - Remove rate"
+
+// Lists all rates with their IDs
+func (b *Bot) describeRates() string {
+	rates, err := b.db.GetRates()
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	if len(rates) == 0 {
+		return "There are no rates yet.\n\n" + rateUsage
+	}
+
+	lines := []string{"💰 Rates:"}
+	for _, rate := range rates {
+		lines = append(lines, fmt.Sprintf("%d. %s/h, %s, from %s", rate.ID, formatMoney(rate.HourlyCents, b.cfg.Currency), rate.Scope(), rate.EffectiveFrom))
+	}
+	return strings.Join(lines, "\n") + "\n\n" + rateUsage
+}
+
+// Marks entry as billable or not billable.
+//
+// Usage:
+//
+//	/billable [entry-id] on|off
+func (b *Bot) handleBillableCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		b.sendMessage(message.Chat.ID, billableUsage, message.MessageID)
+		return
+	}
+
+	var entryID int64
+	if len(fields) == 2 {
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, billableUsage, message.MessageID)
+			return
+		}
+		entryID = id
+	}
+
+	var billable bool
+	switch strings.ToLower(fields[len(fields)-1]) {
+	case "on", "yes":
+		billable = true
+	case "off", "no":
+		billable = false
+	default:
+		b.sendMessage(message.Chat.ID, billableUsage, message.MessageID)
+		return
+	}
+
+	id, err := b.db.SetEntryBillable(userID, entryID, billable)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	if billable {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("💰 Entry %d is billable.", id), message.MessageID)
+	} else {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("💰 Entry %d is not billable.", id), message.MessageID)
+	}
+}
+
+const billableUsage = "Usage:\n" +
+	"/billable on|off - Marks your running or last entry\n" +
+	"/billable <entry-id> on|off - Marks specific entry"
@@ -2,17 +2,27 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type Bot struct {
-	api             *tgbotapi.BotAPI
-	authorizedUsers map[int64]bool
-	db              *Database
-	pendingNotes    map[int64]bool
+	cfg        *Config
+	api        *tgbotapi.BotAPI
+	db         *Database
+	dispatcher *Dispatcher
+	metrics    *Metrics
+	telegram   *telegramClient
+
+	// guards users, updates are handled by several workers
+	mu sync.RWMutex
+	// roles of users keyed by Telegram ID, loaded from database
+	users map[int64]string
 }
 
 type Sender struct {
@@ -20,107 +30,137 @@ type Sender struct {
 	Username string
 }
 
-func NewTelegramBot(token string, users []int64, db *Database) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(token)
+func NewTelegramBot(cfg *Config, db *Database) (*Bot, error) {
+	telegram := &telegramClient{client: &http.Client{}}
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.BotToken, tgbotapi.APIEndpoint, telegram)
 	if err != nil {
 		return nil, err
 	}
 
-	authorizedUsers := make(map[int64]bool)
-	for _, id := range users {
-		authorizedUsers[id] = true
+	// users from environment bootstrap the database as admins
+	if err := db.EnsureUsers(cfg.AuthorizedUsers, RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	bot := &Bot{
+		cfg:      cfg,
+		api:      api,
+		db:       db,
+		metrics:  NewMetrics(),
+		telegram: telegram,
+	}
+	if err := bot.loadUsers(); err != nil {
+		return nil, err
 	}
+	if len(bot.users) == 0 && !cfg.OpenAccess {
+		slog.Warn("no users are authorized, set AUTHORIZED_USERS to add admins or OPEN_ACCESS=true to allow everyone")
+	}
+	bot.dispatcher = NewDispatcher(cfg.BotWorkers, cfg.BotQueueSize, bot.handleUpdate)
 
-	return &Bot{
-		api:             api,
-		authorizedUsers: authorizedUsers,
-		db:              db,
-		pendingNotes:    make(map[int64]bool),
-	}, nil
+	return bot, nil
 }
 
 func (b *Bot) Start() {
-	fmt.Printf("Authorized as %s\n", b.api.Self.UserName)
+	slog.Info("authorized", "bot", b.api.Self.UserName)
 
 	updateConfig := tgbotapi.NewUpdate(0)
 	updateConfig.Timeout = 60
 
 	updates := b.api.GetUpdatesChan(updateConfig)
 
+	b.dispatcher.Start()
+	defer b.dispatcher.Stop()
+
 	for update := range updates {
-		if update.Message == nil {
-			continue
-		}
+		b.dispatcher.Dispatch(update)
+	}
+}
 
-		sender := &Sender{
-			Id:       update.Message.From.ID,
-			Username: update.Message.From.UserName,
-		}
+// Handles single update. Called concurrently from dispatcher workers,
+// but never concurrently for the same user.
+func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	logger := updateLogger(update)
 
-		if !b.isAuthorized(sender.Id) {
-			text := fmt.Sprintf("You are not authorized to use this bot. \nYour Telegram ID is: %d", sender.Id)
-			b.sendMessage(update.Message.Chat.ID, text, update.Message.MessageID)
-			continue
+	if update.CallbackQuery != nil {
+		action, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		logger.Info("received callback", "action", action)
+		role, ok := b.userRole(update.CallbackQuery.From.ID)
+		if !ok {
+			b.answerCallback(update.CallbackQuery, "You are not authorized to use this bot.")
+			return
 		}
-
-		// check if user has active request for starting a timer without note
-		if b.hasPendingNote(sender.Id) {
-			b.processPendingNote(update.Message.Chat.ID, update.Message.MessageID, update.Message.Text, sender.Id)
-			continue
+		if !roleAllows(role, RoleMember) {
+			b.answerCallback(update.CallbackQuery, "Viewers can not change anything.")
+			return
 		}
+		b.handleCallback(update.CallbackQuery, logger)
+		return
+	}
 
-		if update.Message.IsCommand() {
-			log.Printf("Received command from %s (ID: %d)\n", sender.Username, sender.Id)
-			b.handleCommand(update.Message)
-			continue
-		}
+	if update.Message == nil {
+		return
 	}
-}
 
-// Check if user has a pending note request
-func (b *Bot) hasPendingNote(userId int64) bool {
-	_, exists := b.pendingNotes[userId]
-	return exists
-}
+	if update.Message.From == nil || update.Message.From.IsBot {
+		return
+	}
 
-// Process pending note request
-func (b *Bot) processPendingNote(chatId int64, messageId int, note string, userId int64) {
-	// convert "x" to empty string
-	if note == "x" {
-		note = ""
+	sender := &Sender{
+		Id:       update.Message.From.ID,
+		Username: update.Message.From.UserName,
 	}
 
-	err := b.db.StartTracking(strconv.FormatInt(userId, 10), note)
-	if err != nil {
-		b.sendMessage(chatId, fmt.Sprintf("%s", err), messageId)
-		delete(b.pendingNotes, userId)
+	// in groups commands may be addressed to other bots with /command@otherbot
+	group := isGroupChat(update.Message.Chat)
+	if update.Message.IsCommand() && !b.addressedToMe(update.Message) {
+		return
+	}
+
+	// /start <code> registers new users, also when deep link is used
+	if b.redeemInvite(update.Message, logger) {
+		return
+	}
+
+	if !b.isAuthorized(sender.Id) {
+		// groups are not flooded with replies to every unauthorized member
+		if group && !b.mentionsMe(update.Message) {
+			return
+		}
+		text := fmt.Sprintf("You are not authorized to use this bot. Ask an admin for an invite code and send /start <code>.\nYour Telegram ID is: %d", sender.Id)
+		b.sendMessage(update.Message.Chat.ID, text, update.Message.MessageID)
 		return
 	}
 
-	message := "⏲️ Timer is started."
-	if note != "" {
-		message += " Note is: " + note
+	b.rememberMember(update.Message, logger)
+
+	if update.Message.IsCommand() {
+		logger.Info("received command",
+			"command", update.Message.Command(),
+			b.loggedArgs(update.Message.CommandArguments()),
+		)
+		b.handleCommand(update.Message, logger)
+		return
 	}
-	message += "\nUse /stop for stopping timer."
 
-	b.sendMessage(chatId, message, messageId)
-	delete(b.pendingNotes, userId)
+	// text of plain messages is not logged, it may be a note
+	if update.Message.Document != nil {
+		logger.Info("received document", "file_size", update.Message.Document.FileSize)
+	} else {
+		logger.Info("received message")
+	}
+
+	// plain messages are answers to a pending prompt, if there is one
+	b.continueConversation(update.Message, logger)
 }
 
 // Checks if user has permission to interact with the bot.
 //
 // Returns true if:
-// 1. No authorized users are configured (open access mode)
-// 2. The user's ID exists in the authorized users map with a value of true
+// 1. The user's ID is stored in the users table with any role
+// 2. Open access mode is enabled with OPEN_ACCESS
 func (b *Bot) isAuthorized(userID int64) bool {
-	// If the authorized users list is empty, allow access to everyone
-	if len(b.authorizedUsers) == 0 {
-		return true
-	}
-
-	// Check if the user exists in the map and is authorized
-	isAllowed, exists := b.authorizedUsers[userID]
-	return exists && isAllowed
+	_, ok := b.userRole(userID)
+	return ok
 }
 
 // Sends message to specific Telegram chat with an option to reply to another message.
@@ -137,32 +177,166 @@ func (b *Bot) sendMessage(chatID int64, text string, replyToID int) {
 	}
 
 	if _, err := b.api.Send(msg); err != nil {
-		log.Printf("Failed to send message: %v", err)
+		b.metrics.SendFailed("send_message")
+		slog.Error("failed to send message", "chat_id", chatID, "error", err)
 	}
 }
 
+// Sends message with inline keyboard attached
+func (b *Bot) sendMessageWithKeyboard(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+
+	if _, err := b.api.Send(msg); err != nil {
+		b.metrics.SendFailed("send_message")
+		slog.Error("failed to send message", "chat_id", chatID, "error", err)
+	}
+}
+
+// Sends file with optional caption as a reply to another message
+func (b *Bot) sendDocument(chatID int64, name string, data []byte, caption string, replyToID int) {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	if replyToID > 0 {
+		doc.ReplyToMessageID = replyToID
+	}
+
+	if _, err := b.api.Send(doc); err != nil {
+		b.metrics.SendFailed("send_document")
+		slog.Error("failed to send document", "chat_id", chatID, "error", err)
+	}
+}
+
+// Sends image with optional caption as a reply to another message
+func (b *Bot) sendPhoto(chatID int64, name string, data []byte, caption string, replyToID int) {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	photo.Caption = caption
+	if replyToID > 0 {
+		photo.ReplyToMessageID = replyToID
+	}
+
+	if _, err := b.api.Send(photo); err != nil {
+		b.metrics.SendFailed("send_photo")
+		slog.Error("failed to send photo", "chat_id", chatID, "error", err)
+	}
+}
+
+// Replaces text of previously sent message, removing its inline keyboard
+func (b *Bot) editMessage(message *tgbotapi.Message, text string) {
+	if message == nil {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	if _, err := b.api.Send(edit); err != nil {
+		b.metrics.SendFailed("edit_message")
+		slog.Error("failed to edit message", "chat_id", message.Chat.ID, "error", err)
+	}
+}
+
+// Removes inline keyboard from previously sent message
+func (b *Bot) removeKeyboard(message *tgbotapi.Message) {
+	if message == nil {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageReplyMarkup(message.Chat.ID, message.MessageID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	})
+	if _, err := b.api.Send(edit); err != nil {
+		b.metrics.SendFailed("edit_message")
+		slog.Error("failed to remove keyboard", "chat_id", message.Chat.ID, "error", err)
+	}
+}
+
+// Answers callback query so Telegram stops showing loading indicator.
+// Non-empty text is shown to the user as a notification.
+func (b *Bot) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		b.metrics.SendFailed("answer_callback")
+		slog.Error("failed to answer callback", "error", err)
+	}
+}
+
+// Handles inline keyboard button presses. Callback data has format
+// "<prefix>:<args...>" and is routed to handler registered for the prefix.
+func (b *Bot) handleCallback(query *tgbotapi.CallbackQuery, logger *slog.Logger) {
+	parts := strings.Split(query.Data, ":")
+
+	handler, ok := callbackHandlers[parts[0]]
+	if !ok {
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+
+	handler(b, query, parts[1:], logger)
+}
+
+var callbackHandlers = map[string]func(b *Bot, query *tgbotapi.CallbackQuery, args []string, logger *slog.Logger){
+	"remind":    (*Bot).handleReminderCallback,
+	"focus":     (*Bot).handleFocusCallback,
+	"meeting":   (*Bot).handleMeetingCallback,
+	"timesheet": (*Bot).handleTimesheetCallback,
+}
+
 // Processes incoming bot commands and routes them to appropriate functionalities.
-func (b *Bot) handleCommand(message *tgbotapi.Message) {
+func (b *Bot) handleCommand(message *tgbotapi.Message, logger *slog.Logger) {
 	command := message.Command()
 	args := message.CommandArguments()
-	userAjDi := message.From.ID
 	userID := strconv.FormatInt(message.From.ID, 10)
 
-	log.Printf("Handling command: %s, args: %s, userID: %s", command, args, userID)
+	logger, failed := trackFailures(logger)
+	outcome := OutcomeOK
+	defer func() {
+		// panic is counted and passed on to dispatcher, which logs it
+		if r := recover(); r != nil {
+			b.metrics.CommandHandled(command, OutcomePanic)
+			panic(r)
+		}
+		if outcome == OutcomeOK && failed.Load() {
+			outcome = OutcomeError
+		}
+		b.metrics.CommandHandled(command, outcome)
+	}()
+
+	if command == "cancel" {
+		cancelled, err := b.db.DeleteConversation(userID)
+		if err != nil {
+			logger.Error("failed to cancel conversation", "error", err)
+		}
+		if cancelled {
+			b.sendMessage(message.Chat.ID, "Cancelled.", message.MessageID)
+		} else {
+			b.sendMessage(message.Chat.ID, "There is nothing to cancel.", message.MessageID)
+		}
+		return
+	}
+
+	role, _ := b.userRole(message.From.ID)
+	if required := commandRole(command); !roleAllows(role, required) {
+		outcome = OutcomeForbidden
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("🚫 /%s requires the %s role.", command, required), message.MessageID)
+		return
+	}
+
+	// any other command interrupts pending prompt
+	b.interruptConversation(userID, logger)
 
 	switch command {
 	case "start":
-		if len(args) == 0 {
-			b.pendingNotes[userAjDi] = true
-			b.sendMessage(message.Chat.ID, "Please enter your note or type 'x' if you do not wish to provide a note.", message.MessageID)
+		// groups skip the prompts and use project of the group
+		group := isGroupChat(message.Chat)
+		if len(args) == 0 && !group {
+			b.beginConversation(message, StateAwaitingNote, ConversationData{}, "Please enter your note or type 'x' if you do not wish to provide a note.", logger)
 			return
 		}
-		err := b.db.StartTracking(userID, args)
+		project := b.chatDefaultProject(message.Chat, logger)
+		_, err := b.db.StartTracking(userID, args, project)
 		if err != nil {
 			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
 			return
 		}
-		b.sendMessage(message.Chat.ID, "⏲️ Timer is started.\nUse /stop for stopping timer.", message.MessageID)
+		b.sendMessage(message.Chat.ID, startedMessage("", project), message.MessageID)
 	case "stop":
 		_, err := b.db.StopTracking(userID)
 		if err != nil {
@@ -170,14 +344,81 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 			return
 		}
 		b.sendMessage(message.Chat.ID, "❌ Timer is stopped.", message.MessageID)
-		delete(b.pendingNotes, userAjDi)
+	case "status":
+		b.handleStatusCommand(message, userID)
+	case "who":
+		b.handleWhoCommand(message, userID)
+	case "meeting":
+		b.handleMeetingCommand(message, userID, args, logger)
+	case "focus":
+		b.handleFocusCommand(message, userID, args, logger)
+	case "report":
+		b.handleReportCommand(message, userID, args, logger)
+	case "chart":
+		b.handleChartCommand(message, userID, args)
+	case "project":
+		b.handleProjectCommand(message, userID, args)
+	case "rate":
+		b.handleRateCommand(message, userID, args)
+	case "billable":
+		b.handleBillableCommand(message, userID, args)
+	case "invoice":
+		b.handleInvoiceCommand(message, userID, args)
+	case "export":
+		b.handleExportCommand(message, userID, args)
+	case "import":
+		b.handleImportCommand(message, userID, args, logger)
+	case "digest":
+		b.handleDigestCommand(message, userID, args)
+	case "schedule":
+		b.handleScheduleCommand(message, userID, args)
+	case "settings":
+		b.handleSettingsCommand(message, userID, args)
+	case "delete":
+		b.handleDeleteCommand(message, userID, args)
+	case "undo":
+		b.handleUndoCommand(message, userID)
+	case "history":
+		b.handleHistoryCommand(message, userID, args)
+	case "submit":
+		b.handleSubmitCommand(message, userID, args, logger)
+	case "review":
+		b.handleReviewCommand(message, userID, args)
+	case "admin":
+		b.handleAdminCommand(message, userID, args, logger)
+	case "invite":
+		b.handleInviteCommand(message, userID, args)
 	case "help":
 		helpText := "Available commands:\n" +
 			"/start - Starts timer with optional note\n" +
 			"/stop - Stops timer\n" +
+			"/status - Shows running timer, today's time and project budgets\n" +
+			"/who - Shows who is tracking what\n" +
+			"/meeting [note] - Starts shared meeting timer others can join\n" +
+			"/focus [minutes] <note> - Starts focus session\n" +
+			"/cancel - Cancels pending prompt\n" +
+			"/report [period] - Shows tracked time for today, yesterday, week, lastweek, month or lastmonth\n" +
+			"/chart [period] - Sends chart of hours per day stacked by project (entries have no tags) for week, lastweek, month or lastmonth\n" +
+			"/export [period] [format] - Sends your entries as a file (csv, jsonl, ics, toggl, clockify, harvest, timewarrior)\n" +
+			"/import - Imports entries from a CSV, Toggl or Timewarrior file\n" +
+			"/project - Lists projects and assigns clients\n" +
+			"/rate - Lists or sets hourly rates (managers only)\n" +
+			"/billable [entry-id] on|off - Marks entry as billable or not\n" +
+			"/invoice <client> [period] [pdf|html] - Creates invoice for a client\n" +
+			"/digest - Manages daily and weekly digest messages\n" +
+			"/schedule - Shows or changes your working hours\n" +
+			"/settings - Shows or changes your settings\n" +
+			"/delete [entry-id] - Deletes entry, the latest one by default\n" +
+			"/undo - Reverts your last start, stop, billable change or deletion\n" +
+			"/history <entry-id> - Shows who changed entry and how\n" +
+			"/submit [week|lastweek] - Submits your week for review\n" +
+			"/review - Reviews submitted timesheets (managers only)\n" +
+			"/admin - Manages users and their roles (admins only)\n" +
+			"/invite - Creates invite codes for new users (admins only)\n" +
 			"/help - Show this help message"
 		b.sendMessage(message.Chat.ID, helpText, message.MessageID)
 	default:
+		outcome = OutcomeUnknown
 		b.sendMessage(message.Chat.ID, "Unknown command. Type /help to see available commands.", message.MessageID)
 	}
 }
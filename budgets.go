@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Kinds of project budgets
+const (
+	BudgetHours = "hours"
+	BudgetMoney = "money"
+)
+
+// Percentages of budget at which project owner is alerted
+var budgetThresholds = []int{50, 80, 100}
+
+// Hour or money budget of a project. Hour budgets are stored in seconds,
+// money budgets in cents.
+type Budget struct {
+	Project string
+	Kind    string
+	Amount  int64
+	OwnerID string
+	// Highest threshold owner was already alerted about
+	Alerted int
+}
+
+// Budget with amount consumed by entries of the project
+type BudgetUsage struct {
+	Budget
+	Used int64
+}
+
+const (
+	getBudgetsSQL        = `SELECT name, budget_kind, budget_amount, owner_id, budget_alerted FROM projects WHERE budget_kind != '' ORDER BY name`
+	upsertProjectBudget  = `INSERT INTO projects (name, budget_kind, budget_amount, budget_alerted) VALUES (?, ?, ?, 0) ON CONFLICT(name) DO UPDATE SET budget_kind = excluded.budget_kind, budget_amount = excluded.budget_amount, budget_alerted = 0`
+	upsertProjectOwner   = `INSERT INTO projects (name, owner_id) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET owner_id = excluded.owner_id`
+	setOwnerIfMissingSQL = `UPDATE projects SET owner_id = ? WHERE name = ? AND owner_id = ''`
+	updateBudgetAlerted  = `UPDATE projects SET budget_alerted = ? WHERE name = ?`
+	getProjectEntriesSQL = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable FROM entries WHERE project = ? AND deleted_at IS NULL ORDER BY start_time`
+)
+
+// Gets budgets of all projects that have one
+func (db *Database) GetBudgets() ([]Budget, error) {
+	rows, err := db.conn.Query(getBudgetsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []Budget
+	for rows.Next() {
+		var budget Budget
+		if err := rows.Scan(&budget.Project, &budget.Kind, &budget.Amount, &budget.OwnerID, &budget.Alerted); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, rows.Err()
+}
+
+// Sets budget of project and resets its alerts. Empty kind removes the budget.
+// Owner is assigned only if project has none yet.
+func (db *Database) SetProjectBudget(project string, kind string, amount int64, ownerID string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(upsertProjectBudget, project, kind, amount); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	if _, err := tx.Exec(setOwnerIfMissingSQL, ownerID, project); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+
+	return tx.Commit()
+}
+
+// Sets user receiving budget alerts of project
+func (db *Database) SetProjectOwner(project string, ownerID string) error {
+	if _, err := db.conn.Exec(upsertProjectOwner, project, ownerID); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	return nil
+}
+
+// Records highest threshold project owner was alerted about
+func (db *Database) MarkBudgetAlerted(project string, threshold int) error {
+	if _, err := db.conn.Exec(updateBudgetAlerted, threshold, project); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	return nil
+}
+
+// Gets all entries of project, ordered by start time
+func (db *Database) GetProjectEntries(project string) ([]Entry, error) {
+	entries, err := db.conn.Query(getProjectEntriesSQL, project)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying entries: %w", err)
+	}
+	defer entries.Close()
+
+	return db.decryptNotes(scanEntries(entries))
+}
+
+// Computes how much of the budget entries consumed. Hour budgets count
+// rounded time of all entries, money budgets the billed amount of billable entries.
+func (b Budget) Usage(entries []Entry, rounding RoundingRules, rates RateTable, client string, loc *time.Location, now time.Time) BudgetUsage {
+	usage := BudgetUsage{Budget: b}
+
+	for _, entry := range entries {
+		d := rounding.Duration(entry, now)
+
+		switch b.Kind {
+		case BudgetHours:
+			usage.Used += int64(d / time.Second)
+		case BudgetMoney:
+			if !entry.Billable {
+				continue
+			}
+			day := entry.StartTime.In(loc).Format(time.DateOnly)
+			if rate, ok := rates.Find(entry.UserID, entry.Project, client, day); ok {
+				usage.Used += (int64(d/time.Second)*rate.HourlyCents + 1800) / 3600
+			}
+		}
+	}
+
+	return usage
+}
+
+// Gets consumed part of budget in percent
+func (u BudgetUsage) Percent() int {
+	if u.Amount <= 0 {
+		return 0
+	}
+	return int(u.Used * 100 / u.Amount)
+}
+
+// Gets highest alert threshold the usage reached, zero if none
+func (u BudgetUsage) Threshold() int {
+	reached := 0
+	for _, threshold := range budgetThresholds {
+		if u.Percent() >= threshold {
+			reached = threshold
+		}
+	}
+	return reached
+}
+
+// Formats budget amount in its unit
+func (b Budget) format(amount int64, currency string) string {
+	if b.Kind == BudgetMoney {
+		return formatMoney(amount, currency)
+	}
+	return formatDuration(time.Duration(amount) * time.Second)
+}
+
+// Describes usage, e.g. "12h 30m of 40h 00m used (31%), 27h 30m left"
+func (u BudgetUsage) Describe(currency string) string {
+	text := fmt.Sprintf("%s of %s used (%d%%), ", u.format(u.Used, currency), u.format(u.Amount, currency), u.Percent())
+	if u.Used > u.Amount {
+		return text + "over by " + u.format(u.Used-u.Amount, currency)
+	}
+	return text + u.format(u.Amount-u.Used, currency) + " left"
+}
+
+// Parses budget like "40h" for hours or "5000" for money
+func parseBudget(value string) (string, int64, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return "", 0, fmt.Errorf("budget must be positive")
+		}
+		return BudgetHours, int64(d / time.Second), nil
+	}
+
+	cents, err := parseMoney(value)
+	if err != nil || cents == 0 {
+		return "", 0, fmt.Errorf("invalid budget %q, use hours like 40h or amount like 5000", value)
+	}
+	return BudgetMoney, cents, nil
+}
+
+// Loads usage of all project budgets, optionally only of given projects
+func (b *Bot) getBudgetUsages(projects ...string) ([]BudgetUsage, error) {
+	budgets, err := b.db.GetBudgets()
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+
+	rounding, err := b.db.GetRoundingRules(b.cfg.Rounding)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := b.db.GetRates()
+	if err != nil {
+		return nil, err
+	}
+	clients, err := b.db.GetProjectClients()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var usages []BudgetUsage
+	for _, budget := range budgets {
+		if len(projects) > 0 && !containsString(projects, budget.Project) {
+			continue
+		}
+
+		entries, err := b.db.GetProjectEntries(budget.Project)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, budget.Usage(entries, rounding, rates, clients[budget.Project], b.cfg.Timezone, now))
+	}
+	return usages, nil
+}
+
+// Formats budget usages as message lines
+func (b *Bot) describeBudgets(usages []BudgetUsage) string {
+	lines := []string{"💼 Budgets:"}
+	for _, usage := range usages {
+		lines = append(lines, fmt.Sprintf("• %s: %s", usage.Project, usage.Describe(b.cfg.Currency)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Alerts project owners about budgets reaching the next threshold
+func (b *Bot) checkBudgets(now time.Time) {
+	usages, err := b.getBudgetUsages()
+	if err != nil {
+		slog.Error("failed to check budgets", "error", err)
+		return
+	}
+
+	for _, usage := range usages {
+		threshold := usage.Threshold()
+		if threshold <= usage.Alerted {
+			continue
+		}
+
+		// alert is recorded first so a failing send does not repeat it every check
+		if err := b.db.MarkBudgetAlerted(usage.Project, threshold); err != nil {
+			slog.Error("failed to record budget alert", "project", usage.Project, "error", err)
+			continue
+		}
+
+		chatID, err := strconv.ParseInt(usage.OwnerID, 10, 64)
+		if err != nil {
+			slog.Warn("project reached budget threshold but has no owner", "project", usage.Project, "threshold", threshold)
+			continue
+		}
+
+		icon := "⚠️"
+		if threshold >= 100 {
+			icon = "🚨"
+		}
+		b.sendMessage(chatID, fmt.Sprintf("%s Project %s reached %d%% of its budget.\n%s", icon, usage.Project, threshold, usage.Describe(b.cfg.Currency)), 0)
+	}
+}
+
+// Shows running timer, today's total and project budgets.
+//
+// Usage:
+//
+//	/status
+func (b *Bot) handleStatusCommand(message *tgbotapi.Message, userID string) {
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	now := time.Now()
+	var lines []string
+
+	entry, found, err := b.db.getActiveEntry(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if found {
+		line := "⏲️ Running for " + formatDuration(entry.Duration(now))
+		if entry.Note != "" {
+			line += ": " + entry.Note
+		}
+		if entry.Project != "" {
+			line += " [" + entry.Project + "]"
+		}
+		lines = append(lines, line)
+	} else {
+		lines = append(lines, "No timer is running.")
+	}
+
+	from, to, _ := parsePeriod("today", now, settings.Location(b.cfg.Timezone))
+	report, err := b.db.GetReport(userID, from, to, b.cfg.Rounding)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	lines = append(lines, "Today: "+formatDuration(report.Total)+formatRounded(report.Total, report.Rounded))
+
+	usages, err := b.getBudgetUsages()
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if len(usages) > 0 {
+		lines = append(lines, "", b.describeBudgets(usages))
+	}
+
+	b.sendMessage(message.Chat.ID, strings.Join(lines, "\n"), message.MessageID)
+}
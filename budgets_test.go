@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantKind   string
+		wantAmount int64
+		wantErr    bool
+	}{
+		{"40h", BudgetHours, 40 * 3600, false},
+		{"1h30m", BudgetHours, 5400, false},
+		{"5000", BudgetMoney, 500000, false},
+		{"99.50", BudgetMoney, 9950, false},
+		{"0", "", 0, true},
+		{"-2h", "", 0, true},
+		{"lots", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			kind, amount, err := parseBudget(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBudget(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if kind != tt.wantKind || amount != tt.wantAmount {
+				t.Errorf("parseBudget(%q) = %s %d, want %s %d", tt.value, kind, amount, tt.wantKind, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestBudgetThresholds(t *testing.T) {
+	tests := []struct {
+		used          int64
+		wantPercent   int
+		wantThreshold int
+	}{
+		{0, 0, 0},
+		{49, 49, 0},
+		{50, 50, 50},
+		{79, 79, 50},
+		{80, 80, 80},
+		{99, 99, 80},
+		{100, 100, 100},
+		{250, 250, 100},
+	}
+
+	for _, tt := range tests {
+		usage := BudgetUsage{Budget: Budget{Kind: BudgetHours, Amount: 100}, Used: tt.used}
+		if got := usage.Percent(); got != tt.wantPercent {
+			t.Errorf("Percent() of %d/100 = %d, want %d", tt.used, got, tt.wantPercent)
+		}
+		if got := usage.Threshold(); got != tt.wantThreshold {
+			t.Errorf("Threshold() of %d/100 = %d, want %d", tt.used, got, tt.wantThreshold)
+		}
+	}
+
+	if got := (BudgetUsage{Used: 10}).Percent(); got != 0 {
+		t.Errorf("Percent() without amount = %d, want 0", got)
+	}
+}
+
+func TestBudgetUsage(t *testing.T) {
+	day := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	entry := func(minutes int, billable bool) Entry {
+		return Entry{
+			UserID:    "1",
+			StartTime: day,
+			EndTime:   sql.NullTime{Time: day.Add(time.Duration(minutes) * time.Minute), Valid: true},
+			Project:   "web",
+			Billable:  billable,
+		}
+	}
+	// rounded up to 1h and 30m
+	entries := []Entry{entry(50, true), entry(20, false)}
+	rounding := RoundingRules{Default: RoundingPolicy{Mode: RoundUp, Increment: 15 * time.Minute}}
+	rates := RateTable{{Project: "web", HourlyCents: 6000, EffectiveFrom: "2024-01-01"}}
+
+	hours := Budget{Project: "web", Kind: BudgetHours, Amount: 3600}.Usage(entries, rounding, rates, "", time.UTC, day)
+	if hours.Used != 5400 {
+		t.Errorf("hour budget used %d seconds, want 5400", hours.Used)
+	}
+	if want := "1h 30m of 1h 00m used (150%), over by 30m"; hours.Describe("EUR") != want {
+		t.Errorf("Describe() = %q, want %q", hours.Describe("EUR"), want)
+	}
+
+	// only billable entries count, at their rate
+	money := Budget{Project: "web", Kind: BudgetMoney, Amount: 10000}.Usage(entries, rounding, rates, "", time.UTC, day)
+	if money.Used != 6000 || money.Threshold() != 50 {
+		t.Errorf("money budget used %d cents at %d%%, want 6000 at 50%%", money.Used, money.Threshold())
+	}
+}
+
+func TestSetProjectBudget(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if err := db.SetProjectBudget("web", BudgetHours, 3600, "1"); err != nil {
+		t.Fatalf("SetProjectBudget() error = %v", err)
+	}
+	if err := db.MarkBudgetAlerted("web", 80); err != nil {
+		t.Fatalf("MarkBudgetAlerted() error = %v", err)
+	}
+
+	// changing the budget keeps the owner and starts alerting again
+	if err := db.SetProjectBudget("web", BudgetHours, 7200, "2"); err != nil {
+		t.Fatalf("SetProjectBudget() error = %v", err)
+	}
+	budgets, err := db.GetBudgets()
+	if err != nil {
+		t.Fatalf("GetBudgets() error = %v", err)
+	}
+	if len(budgets) != 1 || budgets[0].Amount != 7200 || budgets[0].OwnerID != "1" || budgets[0].Alerted != 0 {
+		t.Fatalf("GetBudgets() = %+v, want 2h budget owned by 1 without alerts", budgets)
+	}
+
+	if err := db.SetProjectOwner("web", "2"); err != nil {
+		t.Fatalf("SetProjectOwner() error = %v", err)
+	}
+	if err := db.SetProjectBudget("web", "", 0, "1"); err != nil {
+		t.Fatalf("SetProjectBudget() error = %v", err)
+	}
+	if budgets, _ := db.GetBudgets(); len(budgets) != 0 {
+		t.Errorf("GetBudgets() after removal = %+v, want none", budgets)
+	}
+}
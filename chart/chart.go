@@ -0,0 +1,183 @@
+// Package chart renders simple charts as PNG images without external services.
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	width        = 800
+	height       = 480
+	marginTop    = 40
+	marginBottom = 40
+	marginLeft   = 50
+	legendWidth  = 170
+	barGap       = 0.25
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	foreground = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	gridColor  = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+
+	// Colors of series, repeated when there are more series
+	Palette = []color.RGBA{
+		{0x4e, 0x79, 0xa7, 0xff},
+		{0xf2, 0x8e, 0x2b, 0xff},
+		{0x59, 0xa1, 0x4f, 0xff},
+		{0xe1, 0x57, 0x59, 0xff},
+		{0x76, 0xb7, 0xb2, 0xff},
+		{0xed, 0xc9, 0x48, 0xff},
+		{0xb0, 0x7a, 0xa1, 0xff},
+		{0xff, 0x9d, 0xa7, 0xff},
+		{0x9c, 0x75, 0x5f, 0xff},
+		{0xba, 0xb0, 0xac, 0xff},
+	}
+)
+
+// Single bar made of values of several series
+type Bar struct {
+	Label string
+	// Values keyed by series name, missing series are zero
+	Values map[string]float64
+}
+
+// Bar chart where values of each bar are stacked on top of each other.
+type StackedBars struct {
+	Title string
+	// Series in stacking order from the bottom, also used for the legend
+	Series []string
+	Bars   []Bar
+	// Unit appended to axis labels, e.g. "h"
+	Unit string
+}
+
+// Gets the largest stacked total of all bars
+func (c StackedBars) max() float64 {
+	max := 0.0
+	for _, bar := range c.Bars {
+		total := 0.0
+		for _, series := range c.Series {
+			total += bar.Values[series]
+		}
+		max = math.Max(max, total)
+	}
+	return max
+}
+
+// Picks axis step giving at most 8 grid lines
+func axisStep(max float64) float64 {
+	for _, step := range []float64{0.5, 1, 2, 4, 5, 10, 20, 25, 50, 100} {
+		if max/step <= 8 {
+			return step
+		}
+	}
+	return math.Ceil(max / 8)
+}
+
+// Draws the chart into a new image
+func (c StackedBars) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	plot := image.Rect(marginLeft, marginTop, width-legendWidth, height-marginBottom)
+
+	drawText(img, c.Title, marginLeft, marginTop/2+5, foreground)
+
+	step := axisStep(c.max())
+	top := step * math.Max(1, math.Ceil(c.max()/step))
+	scale := float64(plot.Dy()) / top
+
+	for value := 0.0; value <= top+step/2; value += step {
+		y := plot.Max.Y - int(math.Round(value*scale))
+		fill(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), gridColor)
+
+		label := fmt.Sprintf("%g%s", value, c.Unit)
+		drawText(img, label, plot.Min.X-8-textWidth(label), y+4, foreground)
+	}
+	fill(img, image.Rect(plot.Min.X, plot.Min.Y, plot.Min.X+1, plot.Max.Y+1), foreground)
+	fill(img, image.Rect(plot.Min.X, plot.Max.Y, plot.Max.X, plot.Max.Y+1), foreground)
+
+	if len(c.Bars) > 0 {
+		slot := float64(plot.Dx()) / float64(len(c.Bars))
+		barWidth := int(math.Max(1, slot*(1-barGap)))
+
+		for i, bar := range c.Bars {
+			x := plot.Min.X + int(slot*float64(i)+(slot-float64(barWidth))/2)
+
+			base := 0.0
+			for j, series := range c.Series {
+				value := bar.Values[series]
+				if value <= 0 {
+					continue
+				}
+				y0 := plot.Max.Y - int(math.Round(base*scale))
+				y1 := plot.Max.Y - int(math.Round((base+value)*scale))
+				fill(img, image.Rect(x, y1, x+barWidth, y0), Palette[j%len(Palette)])
+				base += value
+			}
+
+			center := plot.Min.X + int(slot*float64(i)+slot/2)
+			drawText(img, bar.Label, center-textWidth(bar.Label)/2, plot.Max.Y+18, foreground)
+		}
+	}
+
+	// legend lists series from the top so it matches the stacking order
+	x := width - legendWidth + 15
+	for i := len(c.Series) - 1; i >= 0; i-- {
+		y := marginTop + (len(c.Series)-1-i)*20
+		if y > height-marginBottom {
+			break
+		}
+		fill(img, image.Rect(x, y, x+12, y+12), Palette[i%len(Palette)])
+		drawText(img, truncate(c.Series[i], (legendWidth-40)/textWidth("M")), x+18, y+11, foreground)
+	}
+
+	return img
+}
+
+// Renders the chart as PNG
+func (c StackedBars) Render(w io.Writer) error {
+	return png.Encode(w, c.Image())
+}
+
+func fill(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// Draws text with its baseline at y
+func drawText(img draw.Image, text string, x int, y int, c color.Color) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+func textWidth(text string) int {
+	return font.MeasureString(basicfont.Face7x13, text).Round()
+}
+
+// Shortens text to at most n characters, marking the cut with "..."
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,109 @@
+package chart
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata")
+
+func TestStackedBarsGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		chart StackedBars
+	}{
+		{
+			name:  "empty",
+			chart: StackedBars{Title: "Hours per day, 01 Jan - 07 Jan 2024", Unit: "h"},
+		},
+		{
+			name: "single_bar",
+			chart: StackedBars{
+				Title:  "Hours per day, 01 Jan - 01 Jan 2024",
+				Series: []string{"Website", "Support"},
+				Bars:   []Bar{{Label: "Mon", Values: map[string]float64{"Website": 5.5, "Support": 2}}},
+				Unit:   "h",
+			},
+		},
+		{
+			name: "truncated_labels",
+			chart: StackedBars{
+				Title:  "Hours per day, 01 Jan - 03 Jan 2024",
+				Series: []string{"Project with a very long name", "Internal", "Another project named at length"},
+				Bars: []Bar{
+					{Label: "Mon", Values: map[string]float64{"Project with a very long name": 3, "Internal": 1}},
+					{Label: "Tue", Values: map[string]float64{"Another project named at length": 6.25}},
+					{Label: "Wed", Values: map[string]float64{}},
+				},
+				Unit: "h",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.chart.Render(&buf); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".png")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden image, run with -update to create it: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("chart differs from %s, run with -update if the change is intended", golden)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"Website", 10, "Website"},
+		{"Website", 7, "Website"},
+		{"Website redesign", 10, "Website..."},
+		{"Website", 3, "Web"},
+		{"Über Projekt", 6, "Übe..."},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.text, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAxisStep(t *testing.T) {
+	tests := []struct {
+		max  float64
+		want float64
+	}{
+		{0, 0.5},
+		{3, 0.5},
+		{8, 1},
+		{12, 2},
+		{40, 5},
+		{1000, 125},
+	}
+
+	for _, tt := range tests {
+		if got := axisStep(tt.max); got != tt.want {
+			t.Errorf("axisStep(%g) = %g, want %g", tt.max, got, tt.want)
+		}
+	}
+}
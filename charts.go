@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"timetick-telegram-bot/chart"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Projects shown separately in charts, smaller ones are grouped together
+const maxChartSeries = 8
+
+// Builds chart of hours per day in [from, to), stacked by project
+func buildDailyChart(entries []Entry, from time.Time, to time.Time, now time.Time) chart.StackedBars {
+	const noProject = "No project"
+	const other = "Other"
+
+	loc := from.Location()
+	report := BuildReport(entries, from, to, now)
+
+	// biggest projects get own series, ordered from the bottom
+	var series []string
+	shown := make(map[string]bool)
+	for i, total := range sortedTotals(report.ByProject, noProject) {
+		if i == maxChartSeries-1 && len(report.ByProject) > maxChartSeries {
+			series = append(series, other)
+			break
+		}
+		series = append(series, total.Label)
+		shown[total.Label] = true
+	}
+
+	days := make(map[string]chart.Bar)
+	var bars []chart.Bar
+	month := to.Sub(from) > 8*24*time.Hour
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		label := day.Format("Mon")
+		if month {
+			label = day.Format("02")
+		}
+		bar := chart.Bar{Label: label, Values: make(map[string]float64)}
+		days[day.Format(time.DateOnly)] = bar
+		bars = append(bars, bar)
+	}
+
+	for _, entry := range entries {
+		bar, ok := days[entry.StartTime.In(loc).Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		project := entry.Project
+		if project == "" {
+			project = noProject
+		}
+		if !shown[project] {
+			project = other
+		}
+		bar.Values[project] += entry.Duration(now).Hours()
+	}
+
+	return chart.StackedBars{
+		// chart font has only ASCII characters, so period title can not be used
+		Title:  fmt.Sprintf("Hours per day, %s - %s", from.Format("02 Jan"), to.AddDate(0, 0, -1).Format("02 Jan 2006")),
+		Series: series,
+		Bars:   bars,
+		Unit:   "h",
+	}
+}
+
+// Sends chart of tracked hours per day. Bars are stacked by project only,
+// entries do not have tags to group by.
+//
+// Usage:
+//
+//	/chart [week|lastweek|month|lastmonth]
+func (b *Bot) handleChartCommand(message *tgbotapi.Message, userID string, args string) {
+	period := strings.TrimSpace(args)
+	if period == "" {
+		period = "week"
+	}
+
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	loc := settings.Location(b.cfg.Timezone)
+
+	now := time.Now()
+	from, to, err := parsePeriod(period, now, loc)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	entries, err := b.db.GetEntriesBetween(userID, from, to)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if len(entries) == 0 {
+		b.sendMessage(message.Chat.ID, "There are no entries for "+periodTitle(from, to)+".", message.MessageID)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := buildDailyChart(entries, from, to, now).Render(&buf); err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("Failed to render chart: %s", err), message.MessageID)
+		return
+	}
+
+	report := BuildReport(entries, from, to, now)
+	lines := []string{fmt.Sprintf("📊 %s, total %s", periodTitle(from, to), formatDuration(report.Total))}
+	for _, total := range sortedTotals(report.ByProject, "No project") {
+		lines = append(lines, fmt.Sprintf("%s: %s", total.Label, formatDuration(total.Duration)))
+	}
+
+	b.sendPhoto(message.Chat.ID, "chart.png", buf.Bytes(), strings.Join(lines, "\n"), message.MessageID)
+}
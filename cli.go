@@ -0,0 +1,589 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func printUsage() {
+	fmt.Println("Usage: timetick-telegram-bot [command]")
+	fmt.Println()
+	fmt.Println("Without command, starts the Telegram bot and the API server.")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  start                      Starts the Telegram bot and the API server")
+	fmt.Println("  gen-api-token              Generates new API token")
+	fmt.Println("  export <format> [flags]    Exports entries (" + strings.Join(exporterNames(), ", ") + ")")
+	fmt.Println("  import <format> [flags]    Imports entries (auto, " + strings.Join(importerNames(), ", ") + ")")
+	fmt.Println("  import list [-user ID]     Lists imports")
+	fmt.Println("  import rollback <id>       Removes entries added by an import")
+	fmt.Println("  invoice <client> [flags]   Creates invoice for a client (pdf, html)")
+	fmt.Println("  rate list                  Lists hourly rates")
+	fmt.Println("  rate set <amount> [flags]  Sets hourly rate")
+	fmt.Println("  rate remove <id>           Removes hourly rate")
+	fmt.Println("  backup [flags]             Backs up the database, also while the bot is running")
+	fmt.Println("  verify <file>              Checks integrity of a backup")
+	fmt.Println("  restore <file>             Replaces the database with a backup, stop the bot first")
+	fmt.Println("  rekey [flags]              Re-encrypts entry notes with a new key")
+}
+
+// Opens database for commands which do not need the Telegram bot
+func openDatabase() (*Config, *Database) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("failed to load config", "error", err)
+	}
+	setupLogging(cfg)
+
+	db, err := NewDatabase(cfg.DatabasePath, cfg.NoteKeys)
+	if err != nil {
+		fatal("failed to open database", "error", err)
+	}
+
+	return cfg, db
+}
+
+// Flags selecting range of entries, shared by commands working with entries
+type rangeFlags struct {
+	period   *string
+	from     *string
+	to       *string
+	timezone *string
+}
+
+func addRangeFlags(fs *flag.FlagSet) rangeFlags {
+	return rangeFlags{
+		period:   fs.String("period", "", "period: today, yesterday, week, lastweek, month or lastmonth"),
+		from:     fs.String("from", "", "first day of range (YYYY-MM-DD), used instead of -period"),
+		to:       fs.String("to", "", "last day of range (YYYY-MM-DD), defaults to today"),
+		timezone: fs.String("tz", "", "timezone of the range, defaults to TIMEZONE"),
+	}
+}
+
+// Resolves range flags to [from, to) range
+func (f rangeFlags) resolve(cfg *Config, now time.Time) (time.Time, time.Time, *time.Location, error) {
+	return resolveRange(cfg, now, *f.period, *f.from, *f.to, *f.timezone)
+}
+
+// Resolves either named period or explicit dates to [from, to) range.
+// Explicit "to" date is inclusive, period defaults to current month.
+func resolveRange(cfg *Config, now time.Time, period string, fromDate string, toDate string, timezone string) (time.Time, time.Time, *time.Location, error) {
+	loc := cfg.Timezone
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	if fromDate == "" {
+		if period == "" {
+			period = "month"
+		}
+		from, to, err := parsePeriod(period, now, loc)
+		return from, to, loc, err
+	}
+
+	from, err := time.ParseInLocation(time.DateOnly, fromDate, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid from date: %w", err)
+	}
+
+	to := startOfDay(now.In(loc))
+	if toDate != "" {
+		if to, err = time.ParseInLocation(time.DateOnly, toDate, loc); err != nil {
+			return time.Time{}, time.Time{}, nil, fmt.Errorf("invalid to date: %w", err)
+		}
+	}
+
+	return from, to.AddDate(0, 0, 1), loc, nil
+}
+
+// Opens output file, "-" or empty path is stdout
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// Exports entries to file or stdout.
+//
+// Usage:
+//
+//	export <format> [-user ID] [-period week | -from YYYY-MM-DD -to YYYY-MM-DD] [-o file]
+func runExportCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fatal("Usage: export <format> [flags]", "formats", strings.Join(exporterNames(), ", "))
+	}
+
+	exporter, ok := getExporter(args[0])
+	if !ok {
+		fatal("Unknown export format", "format", args[0], "formats", strings.Join(exporterNames(), ", "))
+	}
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	userID := fs.String("user", "", "export only entries of this Telegram user ID")
+	email := fs.String("email", "", "email of the person, required by toggl and clockify")
+	name := fs.String("name", "", "full name of the person, used by harvest")
+	output := fs.String("o", "-", "output file, - for stdout")
+	ranges := addRangeFlags(fs)
+	fs.Parse(args[1:])
+
+	if requiresEmail(exporter) && *email == "" {
+		fatal("Export requires -email", "format", exporter.Name())
+	}
+
+	cfg, db := openDatabase()
+
+	now := time.Now()
+	from, to, loc, err := ranges.resolve(cfg, now)
+	if err != nil {
+		fatal("export failed", "error", err)
+	}
+
+	var entries []Entry
+	if *userID != "" {
+		entries, err = db.GetEntriesBetween(*userID, from, to)
+	} else {
+		entries, err = db.GetAllEntriesBetween(from, to)
+	}
+	if err != nil {
+		fatal("export failed", "error", err)
+	}
+
+	clients, err := db.GetProjectClients()
+	if err != nil {
+		fatal("export failed", "error", err)
+	}
+
+	rounding, err := db.GetRoundingRules(cfg.Rounding)
+	if err != nil {
+		fatal("export failed", "error", err)
+	}
+
+	out, err := createOutput(*output)
+	if err != nil {
+		fatal("export failed", "error", err)
+	}
+	defer out.Close()
+
+	opts := ExportOptions{
+		Location: loc,
+		Now:      now,
+		Clients:  clients,
+		Email:    *email,
+		Name:     *name,
+		Rounding: rounding,
+	}
+	if err := exporter.Export(out, entries, opts); err != nil {
+		fatal("export failed", "error", err)
+	}
+
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d entries to %s\n", len(entries), *output)
+	}
+}
+
+// Imports entries of one user from file or stdin.
+//
+// Usage:
+//
+//	import <format|auto> -user ID [-file path] [-dry-run] [-allow-overlaps] [-tz zone]
+//	import list [-user ID]
+//	import rollback <id>
+func runImportCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fatal("Usage: import <format> [flags] | import list | import rollback <id>", "formats", "auto, "+strings.Join(importerNames(), ", "))
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("import list", flag.ExitOnError)
+		userID := fs.String("user", "", "list only imports of this Telegram user ID")
+		fs.Parse(args[1:])
+
+		_, db := openDatabase()
+		batches, err := db.GetImportBatches(*userID)
+		if err != nil {
+			fatal("import failed", "error", err)
+		}
+		for _, batch := range batches {
+			fmt.Printf("%s  user %s\n", batch, batch.UserID)
+		}
+		return
+	case "rollback":
+		if len(args) != 2 {
+			fatal("Usage: import rollback <id>")
+		}
+
+		_, db := openDatabase()
+		deleted, err := db.RollbackImport(ActorCLI, args[1])
+		if err != nil {
+			fatal("import failed", "error", err)
+		}
+		fmt.Printf("Import %s rolled back, %d entries removed\n", args[1], deleted)
+		return
+	}
+
+	format := args[0]
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	userID := fs.String("user", "", "Telegram user ID the entries belong to (required)")
+	file := fs.String("file", "-", "file to import, - for stdin")
+	dryRun := fs.Bool("dry-run", false, "only show what would be imported")
+	allowOverlaps := fs.Bool("allow-overlaps", false, "import entries overlapping existing ones")
+	timezone := fs.String("tz", "", "timezone of times without zone, defaults to TIMEZONE")
+	fs.Parse(args[1:])
+
+	if *userID == "" {
+		fatal("Missing -user")
+	}
+
+	cfg, db := openDatabase()
+
+	loc := cfg.Timezone
+	if *timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(*timezone); err != nil {
+			fatal("Invalid timezone", "error", err)
+		}
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fatal("import failed", "error", err)
+	}
+
+	importer, entries, err := parseImport(format, *file, data, loc)
+	if err != nil {
+		fatal("import failed", "error", err)
+	}
+
+	plan, err := db.PlanImport(*userID, entries, *allowOverlaps, time.Now())
+	if err != nil {
+		fatal("import failed", "error", err)
+	}
+
+	fmt.Println(plan.Summary(loc, len(entries)))
+	if *dryRun || len(plan.New) == 0 {
+		return
+	}
+
+	source := *file
+	if source == "-" {
+		source = "stdin"
+	}
+	batch, err := db.ImportEntries(ActorCLI, *userID, importer.Name(), source, plan.New)
+	if err != nil {
+		fatal("import failed", "error", err)
+	}
+	fmt.Printf("Imported %d entries as %s, undo with: import rollback %s\n", batch.EntryCount, batch.ID, batch.ID)
+}
+
+// Creates invoice for billable entries of a client.
+//
+// Usage:
+//
+//	invoice <client> [-user ID] [-format pdf|html] [-period lastmonth | -from YYYY-MM-DD -to YYYY-MM-DD] [-o file]
+func runInvoiceCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fatal("Usage: invoice <client> [flags]")
+	}
+
+	fs := flag.NewFlagSet("invoice", flag.ExitOnError)
+	userID := fs.String("user", "", "invoice only entries of this Telegram user ID")
+	format := fs.String("format", "pdf", "invoice format: pdf or html")
+	output := fs.String("o", "-", "output file, - for stdout")
+	ranges := addRangeFlags(fs)
+	fs.Parse(args[1:])
+
+	render, ok := invoiceRenderers[strings.ToLower(*format)]
+	if !ok {
+		fatal("Unknown invoice format, use pdf or html", "format", *format)
+	}
+
+	cfg, db := openDatabase()
+
+	// invoices are usually made for the previous month
+	if *ranges.period == "" && *ranges.from == "" {
+		*ranges.period = "lastmonth"
+	}
+	now := time.Now()
+	from, to, _, err := ranges.resolve(cfg, now)
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+
+	clients, err := db.GetProjectClients()
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+	client, ok := findClient(clients, args[0])
+	if !ok {
+		fatal("No project belongs to client", "client", args[0])
+	}
+
+	var entries []Entry
+	if *userID != "" {
+		entries, err = db.GetEntriesBetween(*userID, from, to)
+	} else {
+		entries, err = db.GetAllEntriesBetween(from, to)
+	}
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+
+	rates, err := db.GetRates()
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+
+	rounding, err := db.GetRoundingRules(cfg.Rounding)
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+
+	invoice := BuildInvoice(client, entries, clients, rates, from, to, InvoiceOptions{
+		Currency: cfg.Currency,
+		Rounding: rounding,
+		Now:      now,
+	})
+
+	out, err := createOutput(*output)
+	if err != nil {
+		fatal("invoice failed", "error", err)
+	}
+	defer out.Close()
+
+	if err := render(out, invoice); err != nil {
+		fatal("invoice failed", "error", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Invoice %s: %d entries, %s h, %s\n", invoice.Number, len(invoice.Lines), formatHours(invoice.Billed), formatMoney(invoice.TotalCents, invoice.Currency))
+	if invoice.MissingRates > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d entries have no rate\n", invoice.MissingRates)
+	}
+}
+
+// Manages hourly rates.
+//
+// Usage:
+//
+//	rate list
+//	rate set <amount> [-user ID] [-project name] [-client name] [-from YYYY-MM-DD]
+//	rate remove <id>
+func runRateCommand(args []string) {
+	if len(args) == 0 {
+		fatal("Usage: rate list | rate set <amount> [flags] | rate remove <id>")
+	}
+
+	switch args[0] {
+	case "list":
+		cfg, db := openDatabase()
+		rates, err := db.GetRates()
+		if err != nil {
+			fatal("rate failed", "error", err)
+		}
+		for _, rate := range rates {
+			fmt.Printf("%d  %s/h  %s  from %s\n", rate.ID, formatMoney(rate.HourlyCents, cfg.Currency), rate.Scope(), rate.EffectiveFrom)
+		}
+	case "set":
+		if len(args) < 2 {
+			fatal("Usage: rate set <amount> [flags]")
+		}
+		cents, err := parseMoney(args[1])
+		if err != nil {
+			fatal("rate failed", "error", err)
+		}
+
+		fs := flag.NewFlagSet("rate set", flag.ExitOnError)
+		userID := fs.String("user", "", "Telegram user ID the rate applies to")
+		project := fs.String("project", "", "project the rate applies to")
+		client := fs.String("client", "", "client the rate applies to")
+		from := fs.String("from", "", "date the rate is effective from (YYYY-MM-DD), defaults to today")
+		fs.Parse(args[2:])
+
+		cfg, db := openDatabase()
+
+		rate := Rate{UserID: *userID, Project: *project, Client: *client, HourlyCents: cents, EffectiveFrom: *from}
+		if rate.EffectiveFrom == "" {
+			rate.EffectiveFrom = time.Now().In(cfg.Timezone).Format(time.DateOnly)
+		} else if _, err := time.Parse(time.DateOnly, rate.EffectiveFrom); err != nil {
+			fatal("Invalid date", "error", err)
+		}
+
+		if err := db.SetRate(rate); err != nil {
+			fatal("rate failed", "error", err)
+		}
+		fmt.Printf("Rate %s/h for %s from %s\n", formatMoney(cents, cfg.Currency), rate.Scope(), rate.EffectiveFrom)
+	case "remove":
+		if len(args) != 2 {
+			fatal("Usage: rate remove <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fatal("Invalid rate ID", "id", args[1])
+		}
+
+		_, db := openDatabase()
+		deleted, err := db.DeleteRate(id)
+		if err != nil {
+			fatal("rate failed", "error", err)
+		}
+		if !deleted {
+			fatal("Rate was not found", "id", id)
+		}
+		fmt.Printf("Rate %d removed\n", id)
+	default:
+		fatal("Usage: rate list | rate set <amount> [flags] | rate remove <id>")
+	}
+}
+
+// Backs up database while the bot may be running.
+//
+// Usage:
+//
+//	backup [-dir path] [-gzip] [-keep N]
+//	backup -o file
+func runBackupCommand(args []string) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("backup failed", "error", err)
+	}
+
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := fs.String("dir", cfg.BackupDir, "directory of timestamped backups")
+	compress := fs.Bool("gzip", cfg.BackupGzip, "compress backup with gzip")
+	keep := fs.Int("keep", cfg.BackupKeep, "number of newest backups kept in the directory, 0 keeps all")
+	output := fs.String("o", "", "write backup to this file instead, compressed if it ends with .gz")
+	fs.Parse(args)
+
+	db, err := NewDatabase(cfg.DatabasePath, cfg.NoteKeys)
+	if err != nil {
+		fatal("backup failed", "error", err)
+	}
+
+	path := *output
+	if path == "" {
+		path, err = db.CreateBackup(BackupOptions{Dir: *dir, Gzip: *compress, Keep: *keep}, time.Now())
+	} else if plain, ok := strings.CutSuffix(path, ".gz"); ok {
+		if err = db.BackupTo(plain); err == nil {
+			err = gzipFile(plain, path)
+			os.Remove(plain)
+		}
+	} else {
+		err = db.BackupTo(path)
+	}
+	if err != nil {
+		fatal("backup failed", "error", err)
+	}
+
+	info, err := VerifyBackup(path)
+	if err != nil {
+		fatal("Backup failed verification", "path", path, "error", err)
+	}
+	fmt.Printf("Backup written to %s (schema version %d, %d entries)\n", path, info.SchemaVersion, info.Entries)
+}
+
+// Checks integrity of backup file.
+//
+// Usage:
+//
+//	verify <file>
+func runVerifyCommand(args []string) {
+	if len(args) != 1 {
+		fatal("Usage: verify <file>")
+	}
+
+	info, err := VerifyBackup(args[0])
+	if err != nil {
+		fatal("verify failed", "error", err)
+	}
+	fmt.Printf("Backup %s is ok (schema version %d, %d entries)\n", args[0], info.SchemaVersion, info.Entries)
+}
+
+// Replaces database with backup. The bot must be stopped first.
+//
+// Usage:
+//
+//	restore <file>
+func runRestoreCommand(args []string) {
+	if len(args) != 1 {
+		fatal("Usage: restore <file>")
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("restore failed", "error", err)
+	}
+
+	info, err := RestoreBackup(args[0], cfg.DatabasePath, time.Now())
+	if err != nil {
+		fatal("restore failed", "error", err)
+	}
+	fmt.Printf("Restored %s from %s (schema version %d, %d entries)\n", cfg.DatabasePath, args[0], info.SchemaVersion, info.Entries)
+}
+
+// Re-encrypts entry notes, which are read with the configured key. The bot
+// must be stopped and restarted with the new key afterwards, and the old key
+// added to retired keys.
+//
+// Usage:
+//
+//	rekey -new-key-file path | -new-key base64 | -decrypt
+func runRekeyCommand(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	keyFile := fs.String("new-key-file", "", "file with base64 encoded 32 byte key")
+	keyValue := fs.String("new-key", "", "base64 encoded 32 byte key")
+	decrypt := fs.Bool("decrypt", false, "store notes in plain text and disable encryption")
+	fs.Parse(args)
+
+	var key []byte
+	var err error
+	switch {
+	case *decrypt && *keyFile == "" && *keyValue == "":
+	case *keyFile != "" && *keyValue == "" && !*decrypt:
+		key, err = readNoteKeyFile(*keyFile)
+	case *keyValue != "" && *keyFile == "" && !*decrypt:
+		key, err = parseNoteKey(*keyValue)
+	default:
+		fatal("Usage: rekey -new-key-file path | -new-key base64 | -decrypt")
+	}
+	if err != nil {
+		fatal("rekey failed", "error", err)
+	}
+
+	var next *NoteCipher
+	if key != nil {
+		if next, err = NewNoteCipher(NoteKeys{Current: key}); err != nil {
+			fatal("rekey failed", "error", err)
+		}
+	}
+
+	_, db := openDatabase()
+	previous := db.notes.KeyID()
+	count, err := db.RekeyNotes(ActorCLI, next)
+	if err != nil {
+		fatal("rekey failed", "error", err)
+	}
+
+	if next == nil {
+		fmt.Printf("Decrypted %d notes. Unset NOTE_ENCRYPTION_KEY and NOTE_ENCRYPTION_KEY_FILE before starting the bot.\n", count)
+	} else {
+		fmt.Printf("Encrypted %d notes with key %s. Configure the new key before starting the bot.\n", count, next.KeyID())
+	}
+	if previous != "" {
+		fmt.Printf("The audit log keeps notes encrypted with key %s, add the old key to NOTE_RETIRED_KEYS to keep them readable.\n", previous)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Application settings read from environment variables.
+type Config struct {
+	BotToken string
+	// Users added as admins on startup, further users are managed with /admin
+	AuthorizedUsers []int64
+	// Allows everyone to use the bot as member, not only stored users
+	OpenAccess bool
+
+	DatabasePath string
+	APIPort      int
+
+	// Number of workers processing Telegram updates concurrently
+	BotWorkers int
+	// Size of the per-worker update queue
+	BotQueueSize int
+
+	// Default running time after which user is reminded about active timer
+	ReminderAfter time.Duration
+	// How often active timers are checked for reminders and auto-stop
+	ReminderCheckInterval time.Duration
+
+	// Default timezone for users who did not set their own
+	Timezone *time.Location
+	// Default local time (HH:MM) when digests are sent
+	DigestTime string
+	// Day of the week when weekly digest is sent
+	WeeklyDigestDay time.Weekday
+	// Whether users receive daily digest before opting in or out
+	DigestEnabledByDefault bool
+
+	// Default delay after scheduled start before user is nudged to start timer
+	NudgeAfter time.Duration
+
+	// Default length of focus session and break after it
+	FocusDuration time.Duration
+	FocusBreak    time.Duration
+	// How often focus sessions are checked for completion
+	FocusCheckInterval time.Duration
+
+	// Currency code printed on invoices, rates are entered in this currency
+	Currency string
+
+	// Rounding of projects without own policy, applied in reports, exports and invoices
+	Rounding RoundingPolicy
+
+	// How often project budgets are checked for alert thresholds
+	BudgetCheckInterval time.Duration
+
+	// How long after a change /undo can still revert it
+	UndoWindow time.Duration
+	// How long deleted entries are kept before they are purged
+	DeletedRetention time.Duration
+
+	// Directory of backups and how often they are made. Backups are made
+	// every 24h by default, zero disables them.
+	BackupDir      string
+	BackupInterval time.Duration
+	// Number of newest backups kept, zero keeps all
+	BackupKeep int
+	BackupGzip bool
+
+	// AES-256 keys of entry notes, without current key notes are kept in plain text
+	NoteKeys NoteKeys
+
+	// Level and format ("json" or "text") of logs
+	LogLevel  slog.Level
+	LogFormat string
+	// Whether command arguments are left out of logs, they contain notes
+	LogRedact bool
+
+	// How long /readyz accepts no response from Telegram, long polling
+	// gets one at least every minute
+	ReadyTelegramMaxAge time.Duration
+
+	// Bearer token of /metrics, which is disabled when it is empty
+	MetricsToken string
+}
+
+// Reads configuration from environment, applying defaults for optional values
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		BotToken:     os.Getenv("TELEGRAM_BOT_TOKEN"),
+		DatabasePath: getEnv("DATABASE_PATH", "database.db"),
+		APIPort:      getEnvInt("API_PORT", 3000),
+		BotWorkers:   getEnvInt("BOT_WORKERS", 4),
+		BotQueueSize: getEnvInt("BOT_QUEUE_SIZE", 64),
+
+		ReminderAfter:         getEnvDuration("REMINDER_AFTER", 8*time.Hour),
+		ReminderCheckInterval: getEnvDuration("REMINDER_CHECK_INTERVAL", time.Minute),
+
+		Timezone:               time.Local,
+		DigestTime:             getEnv("DIGEST_TIME", "08:00"),
+		DigestEnabledByDefault: getEnv("DIGEST_ENABLED", "false") == "true",
+
+		NudgeAfter: getEnvDuration("NUDGE_AFTER", 15*time.Minute),
+
+		FocusDuration:      getEnvDuration("FOCUS_DURATION", 25*time.Minute),
+		FocusBreak:         getEnvDuration("FOCUS_BREAK", 5*time.Minute),
+		FocusCheckInterval: getEnvDuration("FOCUS_CHECK_INTERVAL", 15*time.Second),
+
+		Currency: strings.ToUpper(getEnv("CURRENCY", "EUR")),
+
+		BudgetCheckInterval: getEnvDuration("BUDGET_CHECK_INTERVAL", 5*time.Minute),
+
+		UndoWindow:       getEnvDuration("UNDO_WINDOW", 10*time.Minute),
+		DeletedRetention: getEnvDuration("DELETED_RETENTION", 30*24*time.Hour),
+
+		BackupDir:      getEnv("BACKUP_DIR", "backups"),
+		BackupInterval: getEnvDuration("BACKUP_INTERVAL", 24*time.Hour),
+		BackupKeep:     getEnvInt("BACKUP_KEEP", 7),
+		BackupGzip:     getEnv("BACKUP_GZIP", "true") == "true",
+
+		LogFormat: strings.ToLower(getEnv("LOG_FORMAT", "json")),
+		LogRedact: getEnv("LOG_REDACT", "true") == "true",
+
+		ReadyTelegramMaxAge: getEnvDuration("READY_TELEGRAM_MAX_AGE", 3*time.Minute),
+
+		MetricsToken: getEnv("METRICS_TOKEN", ""),
+	}
+
+	cfg.OpenAccess = getEnv("OPEN_ACCESS", "false") == "true"
+
+	if users := os.Getenv("AUTHORIZED_USERS"); users != "" {
+		cfg.AuthorizedUsers = convertStringToIntArray(users)
+	}
+
+	if cfg.BotWorkers < 1 {
+		return nil, fmt.Errorf("BOT_WORKERS must be at least 1")
+	}
+	if cfg.BotQueueSize < 0 {
+		return nil, fmt.Errorf("BOT_QUEUE_SIZE must not be negative")
+	}
+
+	if cfg.ReminderCheckInterval <= 0 {
+		return nil, fmt.Errorf("REMINDER_CHECK_INTERVAL must be positive")
+	}
+
+	if cfg.BudgetCheckInterval <= 0 {
+		return nil, fmt.Errorf("BUDGET_CHECK_INTERVAL must be positive")
+	}
+
+	if cfg.BackupInterval < 0 || cfg.BackupKeep < 0 {
+		return nil, fmt.Errorf("BACKUP_INTERVAL and BACKUP_KEEP can not be negative")
+	}
+
+	if cfg.DeletedRetention <= 0 {
+		return nil, fmt.Errorf("DELETED_RETENTION must be positive")
+	}
+
+	if cfg.FocusCheckInterval <= 0 {
+		return nil, fmt.Errorf("FOCUS_CHECK_INTERVAL must be positive")
+	}
+
+	rounding, err := parseRoundingPolicy(getEnv("ROUNDING", RoundNone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ROUNDING: %w", err)
+	}
+	cfg.Rounding = rounding
+
+	if key := os.Getenv("NOTE_ENCRYPTION_KEY"); key != "" {
+		if cfg.NoteKeys.Current, err = parseNoteKey(key); err != nil {
+			return nil, fmt.Errorf("invalid NOTE_ENCRYPTION_KEY: %w", err)
+		}
+	} else if path := os.Getenv("NOTE_ENCRYPTION_KEY_FILE"); path != "" {
+		if cfg.NoteKeys.Current, err = readNoteKeyFile(path); err != nil {
+			return nil, fmt.Errorf("invalid NOTE_ENCRYPTION_KEY_FILE: %w", err)
+		}
+	}
+
+	if keys := os.Getenv("NOTE_RETIRED_KEYS"); keys != "" {
+		if cfg.NoteKeys.Retired, err = parseNoteKeys(keys); err != nil {
+			return nil, fmt.Errorf("invalid NOTE_RETIRED_KEYS: %w", err)
+		}
+	} else if path := os.Getenv("NOTE_RETIRED_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NOTE_RETIRED_KEYS_FILE: %w", err)
+		}
+		if cfg.NoteKeys.Retired, err = parseNoteKeys(string(data)); err != nil {
+			return nil, fmt.Errorf("invalid NOTE_RETIRED_KEYS_FILE: %w", err)
+		}
+	}
+
+	if cfg.LogLevel, err = parseLogLevel(getEnv("LOG_LEVEL", "info")); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return nil, fmt.Errorf("invalid LOG_FORMAT: %q, use json or text", cfg.LogFormat)
+	}
+
+	if tz := getEnv("TIMEZONE", ""); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIMEZONE: %w", err)
+		}
+		cfg.Timezone = loc
+	}
+
+	if _, err := parseClock(cfg.DigestTime); err != nil {
+		return nil, fmt.Errorf("invalid DIGEST_TIME: %w", err)
+	}
+
+	weekday, err := parseWeekday(getEnv("DIGEST_WEEKLY_DAY", "monday"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DIGEST_WEEKLY_DAY: %w", err)
+	}
+	cfg.WeeklyDigestDay = weekday
+
+	return cfg, nil
+}
+
+// Gets environment variable or fallback value if it is not set
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+// Gets integer environment variable, invalid values are logged and ignored
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("invalid config value, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Gets duration environment variable (e.g. "90m", "8h"), invalid values are logged and ignored
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("invalid config value, using default", "key", key, "value", value, "default", fallback.String())
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestLoadConfigValidatesDispatcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   string
+		queueSize string
+		wantErr   bool
+	}{
+		{"defaults", "", "", false},
+		{"unbuffered queue", "2", "0", false},
+		{"no workers", "0", "", true},
+		{"negative queue", "", "-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+			t.Setenv("BOT_WORKERS", tt.workers)
+			t.Setenv("BOT_QUEUE_SIZE", tt.queueSize)
+
+			_, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigNoteKeys(t *testing.T) {
+	key := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+
+	tests := []struct {
+		name        string
+		current     string
+		retired     string
+		wantRetired int
+		wantErr     bool
+	}{
+		{"no keys", "", "", 0, false},
+		{"current key", key, "", 0, false},
+		{"retired keys", key, key + "," + key, 2, false},
+		{"invalid retired key", key, "short", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+			t.Setenv("NOTE_ENCRYPTION_KEY", tt.current)
+			t.Setenv("NOTE_RETIRED_KEYS", tt.retired)
+
+			cfg, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(cfg.NoteKeys.Retired) != tt.wantRetired {
+				t.Errorf("LoadConfig() retired keys = %d, want %d", len(cfg.NoteKeys.Retired), tt.wantRetired)
+			}
+		})
+	}
+}
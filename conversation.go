@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// How long the bot waits for a reply before pending prompt is discarded.
+const conversationTimeout = 5 * time.Minute
+
+type ConversationState string
+
+const (
+	StateAwaitingNote    ConversationState = "awaiting_note"
+	StateAwaitingProject ConversationState = "awaiting_project"
+	StateAwaitingConfirm ConversationState = "awaiting_confirm"
+
+	StateAwaitingImportFile    ConversationState = "awaiting_import_file"
+	StateAwaitingImportConfirm ConversationState = "awaiting_import_confirm"
+
+	StateAwaitingReviewComment ConversationState = "awaiting_review_comment"
+)
+
+// Values collected from the user during a multi-step dialog.
+type ConversationData struct {
+	Note    string `json:"note,omitempty"`
+	Project string `json:"project,omitempty"`
+
+	ImportFileID   string `json:"import_file_id,omitempty"`
+	ImportFileName string `json:"import_file_name,omitempty"`
+	ImportFormat   string `json:"import_format,omitempty"`
+
+	TimesheetUser string `json:"timesheet_user,omitempty"`
+	TimesheetWeek string `json:"timesheet_week,omitempty"`
+}
+
+type Conversation struct {
+	UserID    string
+	ChatID    int64
+	State     ConversationState
+	Data      ConversationData
+	ExpiresAt time.Time
+}
+
+// Checks if user took too long to answer the pending prompt
+func (c *Conversation) Expired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+// Handles a reply for a single conversation state. It returns the next
+// state and the message sent back to the user. An empty next state ends
+// the conversation.
+type conversationStep func(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string)
+
+var conversationSteps = map[ConversationState]conversationStep{
+	StateAwaitingNote:    stepAwaitingNote,
+	StateAwaitingProject: stepAwaitingProject,
+	StateAwaitingConfirm: stepAwaitingConfirm,
+
+	StateAwaitingImportFile:    stepAwaitingImportFile,
+	StateAwaitingImportConfirm: stepAwaitingImportConfirm,
+
+	StateAwaitingReviewComment: stepAwaitingReviewComment,
+}
+
+const (
+	upsertConversationSQL = `
+  INSERT INTO conversations (user_id, chat_id, state, data, expires_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+  ON CONFLICT(user_id) DO UPDATE SET chat_id = excluded.chat_id, state = excluded.state, data = excluded.data,
+  expires_at = excluded.expires_at, updated_at = excluded.updated_at`
+	getConversationSQL            = `SELECT user_id, chat_id, state, data, expires_at FROM conversations WHERE user_id = ?`
+	deleteConversationSQL         = `DELETE FROM conversations WHERE user_id = ?`
+	deleteExpiredConversationsSQL = `DELETE FROM conversations WHERE expires_at < ?`
+)
+
+// Saves conversation for user, replacing any previous one
+func (db *Database) SaveConversation(conv *Conversation) error {
+	stored := conv.Data
+	var err error
+	if stored.Note, err = db.notes.Encrypt(stored.Note); err != nil {
+		return err
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation data: %w", err)
+	}
+
+	_, err = db.conn.Exec(upsertConversationSQL, conv.UserID, conv.ChatID, conv.State, string(data), conv.ExpiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+// Gets pending conversation for user, returns nil if there is none
+func (db *Database) GetConversation(userID string) (*Conversation, error) {
+	var conv Conversation
+	var data string
+
+	err := db.conn.QueryRow(getConversationSQL, userID).Scan(&conv.UserID, &conv.ChatID, &conv.State, &data, &conv.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &conv.Data); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation data: %w", err)
+	}
+	if conv.Data.Note, err = db.notes.Decrypt(conv.Data.Note); err != nil {
+		return nil, fmt.Errorf("conversation of user %s: %w", userID, err)
+	}
+
+	return &conv, nil
+}
+
+// Deletes pending conversation for user. Returns true if one existed.
+func (db *Database) DeleteConversation(userID string) (bool, error) {
+	res, err := db.conn.Exec(deleteConversationSQL, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// Deletes conversations that were left unanswered past their timeout
+func (db *Database) DeleteExpiredConversations() (int64, error) {
+	res, err := db.conn.Exec(deleteExpiredConversationsSQL, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired conversations: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Starts new conversation with user and sends the first prompt
+func (b *Bot) beginConversation(message *tgbotapi.Message, state ConversationState, data ConversationData, prompt string, logger *slog.Logger) {
+	conv := &Conversation{
+		UserID:    strconv.FormatInt(message.From.ID, 10),
+		ChatID:    message.Chat.ID,
+		State:     state,
+		Data:      data,
+		ExpiresAt: time.Now().Add(conversationTimeout),
+	}
+
+	if err := b.db.SaveConversation(conv); err != nil {
+		logger.Error("failed to start conversation", "error", err)
+		b.sendMessage(message.Chat.ID, "Something went wrong, please try again.", message.MessageID)
+		return
+	}
+
+	b.sendMessage(message.Chat.ID, prompt, message.MessageID)
+}
+
+// Passes non-command message to the step handler of user's pending
+// conversation. Returns false if user has no pending conversation.
+func (b *Bot) continueConversation(message *tgbotapi.Message, logger *slog.Logger) bool {
+	userID := strconv.FormatInt(message.From.ID, 10)
+
+	conv, err := b.db.GetConversation(userID)
+	if err != nil {
+		logger.Error("failed to load conversation", "error", err)
+		return false
+	}
+	if conv == nil {
+		return false
+	}
+
+	// answers count only in the chat where the prompt was asked, so group
+	// chatter does not end up in a private prompt
+	if conv.ChatID != message.Chat.ID {
+		return false
+	}
+
+	if conv.Expired() {
+		b.db.DeleteConversation(userID)
+		b.sendMessage(message.Chat.ID, "⌛ Your previous prompt has expired. Please run the command again.", message.MessageID)
+		return true
+	}
+
+	step, ok := conversationSteps[conv.State]
+	if !ok {
+		logger.Warn("unknown conversation state, discarding", "state", conv.State)
+		b.db.DeleteConversation(userID)
+		return false
+	}
+
+	next, reply := step(b, message, conv)
+	if next == "" {
+		b.db.DeleteConversation(userID)
+	} else {
+		conv.State = next
+		conv.ExpiresAt = time.Now().Add(conversationTimeout)
+		if err := b.db.SaveConversation(conv); err != nil {
+			logger.Error("failed to save conversation", "error", err)
+		}
+	}
+
+	if reply != "" {
+		b.sendMessage(message.Chat.ID, reply, message.MessageID)
+	}
+	return true
+}
+
+// Discards pending conversation when user runs another command
+func (b *Bot) interruptConversation(userID string, logger *slog.Logger) {
+	if _, err := b.db.DeleteConversation(userID); err != nil {
+		logger.Error("failed to interrupt conversation", "error", err)
+	}
+}
+
+// Converts optional answer, where 'x' means the user skipped the question
+func optionalAnswer(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, "x") {
+		return ""
+	}
+	return text
+}
+
+func stepAwaitingNote(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	conv.Data.Note = optionalAnswer(message.Text)
+	return StateAwaitingProject, "Please enter project name or type 'x' to track without project."
+}
+
+func stepAwaitingProject(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	conv.Data.Project = optionalAnswer(message.Text)
+
+	note := conv.Data.Note
+	if note == "" {
+		note = "-"
+	}
+	project := conv.Data.Project
+	if project == "" {
+		project = "-"
+	}
+
+	return StateAwaitingConfirm, fmt.Sprintf("Start timer?\nNote: %s\nProject: %s\n\nReply 'yes' or 'no'.", note, project)
+}
+
+func stepAwaitingConfirm(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	switch strings.ToLower(strings.TrimSpace(message.Text)) {
+	case "yes", "y":
+		if _, err := b.db.StartTracking(conv.UserID, conv.Data.Note, conv.Data.Project); err != nil {
+			return "", fmt.Sprintf("%s", err)
+		}
+		return "", startedMessage(conv.Data.Note, conv.Data.Project)
+	case "no", "n":
+		return "", "Timer was not started."
+	default:
+		return StateAwaitingConfirm, "Please reply 'yes' or 'no', or use /cancel."
+	}
+}
+
+// Builds confirmation message for started timer
+func startedMessage(note string, project string) string {
+	message := "⏲️ Timer is started."
+	if note != "" {
+		message += " Note is: " + note
+	}
+	if project != "" {
+		message += "\nProject: " + project
+	}
+	message += "\nUse /stop for stopping timer."
+	return message
+}
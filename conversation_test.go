@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestConversationSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     ConversationState
+		data      ConversationData
+		text      string
+		wantState ConversationState
+		wantData  ConversationData
+		wantReply string
+		wantEntry bool
+	}{
+		{
+			name:      "note",
+			state:     StateAwaitingNote,
+			text:      " fix login ",
+			wantState: StateAwaitingProject,
+			wantData:  ConversationData{Note: "fix login"},
+			wantReply: "project name",
+		},
+		{
+			name:      "skipped note",
+			state:     StateAwaitingNote,
+			text:      "X",
+			wantState: StateAwaitingProject,
+			wantReply: "project name",
+		},
+		{
+			name:      "project",
+			state:     StateAwaitingProject,
+			data:      ConversationData{Note: "fix login"},
+			text:      "web",
+			wantState: StateAwaitingConfirm,
+			wantData:  ConversationData{Note: "fix login", Project: "web"},
+			wantReply: "Note: fix login\nProject: web",
+		},
+		{
+			name:      "skipped project",
+			state:     StateAwaitingProject,
+			text:      "x",
+			wantState: StateAwaitingConfirm,
+			wantReply: "Note: -\nProject: -",
+		},
+		{
+			name:      "confirmed",
+			state:     StateAwaitingConfirm,
+			data:      ConversationData{Note: "fix login", Project: "web"},
+			text:      "Yes",
+			wantData:  ConversationData{Note: "fix login", Project: "web"},
+			wantReply: "Timer is started.",
+			wantEntry: true,
+		},
+		{
+			name:      "declined",
+			state:     StateAwaitingConfirm,
+			text:      "n",
+			wantReply: "not started",
+		},
+		{
+			name:      "unclear confirmation",
+			state:     StateAwaitingConfirm,
+			text:      "maybe",
+			wantState: StateAwaitingConfirm,
+			wantReply: "reply 'yes' or 'no'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{db: newTestDatabase(t)}
+			conv := &Conversation{UserID: "1", ChatID: 1, State: tt.state, Data: tt.data}
+
+			next, reply := conversationSteps[tt.state](b, &tgbotapi.Message{Text: tt.text}, conv)
+			if next != tt.wantState {
+				t.Errorf("next state = %q, want %q", next, tt.wantState)
+			}
+			if conv.Data != tt.wantData {
+				t.Errorf("data = %+v, want %+v", conv.Data, tt.wantData)
+			}
+			if !strings.Contains(reply, tt.wantReply) {
+				t.Errorf("reply = %q, want it to contain %q", reply, tt.wantReply)
+			}
+
+			_, running, err := b.db.getActiveEntry("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if running != tt.wantEntry {
+				t.Errorf("timer running = %v, want %v", running, tt.wantEntry)
+			}
+		})
+	}
+}
+
+func TestConversationPersistence(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if conv, err := db.GetConversation("1"); err != nil || conv != nil {
+		t.Fatalf("GetConversation() of new user = %v, %v, want nil", conv, err)
+	}
+
+	conv := &Conversation{
+		UserID:    "1",
+		ChatID:    42,
+		State:     StateAwaitingProject,
+		Data:      ConversationData{Note: "review"},
+		ExpiresAt: time.Now().Add(conversationTimeout),
+	}
+	if err := db.SaveConversation(conv); err != nil {
+		t.Fatal(err)
+	}
+	conv.State = StateAwaitingConfirm
+	conv.Data.Project = "web"
+	if err := db.SaveConversation(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetConversation("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ChatID != 42 || got.State != StateAwaitingConfirm || got.Data != conv.Data || got.Expired() {
+		t.Fatalf("GetConversation() = %+v, want %+v", got, conv)
+	}
+
+	deleted, err := db.DeleteConversation("1")
+	if err != nil || !deleted {
+		t.Fatalf("DeleteConversation() = %v, %v, want true", deleted, err)
+	}
+	if deleted, _ := db.DeleteConversation("1"); deleted {
+		t.Error("DeleteConversation() of deleted conversation = true, want false")
+	}
+}
+
+func TestConversationTimeout(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now()
+
+	for userID, expiresAt := range map[string]time.Time{
+		"1": now.Add(-time.Second),
+		"2": now.Add(-conversationTimeout),
+		"3": now.Add(conversationTimeout),
+	} {
+		conv := &Conversation{UserID: userID, State: StateAwaitingNote, ExpiresAt: expiresAt}
+		if conv.Expired() != expiresAt.Before(now) {
+			t.Errorf("Expired() of conversation expiring at %v = %v", expiresAt, conv.Expired())
+		}
+		if err := db.SaveConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := db.DeleteExpiredConversations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteExpiredConversations() = %d, want 2", deleted)
+	}
+	if conv, _ := db.GetConversation("3"); conv == nil {
+		t.Error("pending conversation was deleted")
+	}
+}
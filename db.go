@@ -14,8 +14,12 @@ type Entry struct {
 	StartTime  time.Time    `json:"start_time"`
 	EndTime    sql.NullTime `json:"end_time"`
 	Note       string       `json:"note"`
+	Project    string       `json:"project"`
 	Active     bool         `json:"active"`
 	ImportedAt sql.NullTime `json:"imported_at"`
+	Billable   bool         `json:"billable"`
+	RemindedAt sql.NullTime `json:"-"`
+	DeletedAt  sql.NullTime `json:"-"`
 }
 
 type ApiToken struct {
@@ -27,9 +31,29 @@ type ApiToken struct {
 }
 
 type Database struct {
-	conn *sql.DB
+	conn  *sql.DB
+	stmts preparedStatements
+	// Encrypts entry notes, nil stores them in plain text
+	notes *NoteCipher
 }
 
+// Statements of the most frequent queries, prepared once when database is opened
+type preparedStatements struct {
+	unimportedEntries *sql.Stmt
+	entriesBetween    *sql.Stmt
+	allEntriesBetween *sql.Stmt
+	activeEntry       *sql.Stmt
+	hasActiveEntry    *sql.Stmt
+	activeEntries     *sql.Stmt
+	userSettings      *sql.Stmt
+	apiTokenByHash    *sql.Stmt
+	apiTokenLastUsed  *sql.Stmt
+}
+
+// How long SQLite waits for locks held by other connections before
+// failing with "database is locked"
+const busyTimeout = 5 * time.Second
+
 const (
 	createEntriesTableSQL = `
 	CREATE TABLE IF NOT EXISTS entries (
@@ -52,26 +76,45 @@ const (
   is_active BOOLEAN NOT NULL DEFAULT 1
   )`
 
-	createEntrySQL             = `INSERT INTO entries (user_id, start_time, note, active) VALUES (?, ?, ?, 1)`
-	getUnimportedEntriesSQL    = `SELECT id, user_id, start_time, end_time, note, active, imported_at FROM entries WHERE imported_at IS NULL`
+	createEntrySQL             = `INSERT INTO entries (user_id, start_time, note, project, active) VALUES (?, ?, ?, ?, 1)`
+	getUnimportedEntriesSQL    = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable FROM entries WHERE imported_at IS NULL AND deleted_at IS NULL`
 	updateEntryImportStatusSQL = `UPDATE entries SET imported_at = CURRENT_TIMESTAMP WHERE id = ?`
-	checkEntrySQL              = `SELECT COUNT(*), CASE WHEN imported_at IS NULL THEN 1 ELSE 0 END FROM entries WHERE id = ?`
-	getActiveEntrySQL          = `SELECT id, user_id, start_time, end_time, active FROM entries WHERE user_id = ? AND active = 1 LIMIT 1`
-	updateEntrySQL             = `UPDATE entries SET end_time = ?, active = 0 WHERE id = ?`
-	hasActiveEntrySQL          = `SELECT COUNT(*) FROM entries WHERE user_id = ? AND active = 1`
+	checkEntrySQL              = `SELECT COUNT(*), CASE WHEN imported_at IS NULL THEN 1 ELSE 0 END FROM entries WHERE id = ? AND deleted_at IS NULL`
+	getActiveEntrySQL          = `SELECT id, user_id, start_time, end_time, note, project, active, reminded_at FROM entries WHERE user_id = ? AND active = 1 AND deleted_at IS NULL LIMIT 1`
+	hasActiveEntrySQL          = `SELECT COUNT(*) FROM entries WHERE user_id = ? AND active = 1 AND deleted_at IS NULL`
+	getEntriesBetweenSQL       = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable FROM entries WHERE user_id = ? AND unixepoch(start_time) >= ? AND unixepoch(start_time) < ? AND deleted_at IS NULL ORDER BY start_time`
+	getAllEntriesBetweenSQL    = `SELECT id, user_id, start_time, end_time, note, project, active, imported_at, billable FROM entries WHERE unixepoch(start_time) >= ? AND unixepoch(start_time) < ? AND deleted_at IS NULL ORDER BY start_time`
+	getKnownUserIDsSQL         = `SELECT user_id FROM entries UNION SELECT user_id FROM user_settings UNION SELECT user_id FROM work_schedules`
+	getActiveEntriesSQL        = `SELECT id, user_id, start_time, note, project, reminded_at FROM entries WHERE active = 1 AND deleted_at IS NULL`
+	stopEntrySQL               = `UPDATE entries SET end_time = ?, active = 0 WHERE id = ? AND user_id = ? AND active = 1 AND deleted_at IS NULL`
+	updateEntryRemindedAtSQL   = `UPDATE entries SET reminded_at = ? WHERE id = ?`
 
 	createApiTokenSQL         = `INSERT INTO api_tokens (token_hash, created_at, is_active) VALUES (?, ?, ?)`
 	getApiTokenByTokenHashSQL = `SELECT id, token_hash, created_at, last_used, is_active FROM api_tokens WHERE token_hash = ?`
 	updateApiTokenLastUsed    = `UPDATE api_tokens SET last_used = ? WHERE id = ?`
 )
 
-func NewDatabase(dbPath string) (*Database, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+// Builds DSN of database file. WAL lets the API and the bot read while
+// another connection writes, and immediate transactions take the write lock
+// when they begin, so they wait for busy timeout instead of failing when a
+// reading transaction starts to write.
+func databaseDSN(dbPath string) string {
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate", dbPath, busyTimeout.Milliseconds())
+}
+
+// Opens database, without current note key new notes are left unencrypted
+func NewDatabase(dbPath string, noteKeys NoteKeys) (*Database, error) {
+	conn, err := sql.Open("sqlite3", databaseDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to open database: %w", err)
 	}
 
 	db := &Database{conn: conn}
+	if db.notes, err = NewNoteCipher(noteKeys); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	if err := db.initDB(); err != nil {
 		db.conn.Close()
 		return nil, err
@@ -81,24 +124,100 @@ func NewDatabase(dbPath string) (*Database, error) {
 }
 
 func (db *Database) initDB() error {
-	_, err := db.conn.Exec(createEntriesTableSQL)
-	_, err = db.conn.Exec(createApiTokensTableSQL)
+	if err := db.migrate(); err != nil {
+		return fmt.Errorf("Failed to initialize database: %w", err)
+	}
 
-	if err != nil {
+	if err := db.prepareStatements(); err != nil {
+		return fmt.Errorf("Failed to initialize database: %w", err)
+	}
+
+	if err := db.checkNoteKey(); err != nil {
 		return fmt.Errorf("Failed to initialize database: %w", err)
 	}
 
 	return nil
 }
 
+// Prepares hot statements, tables must already exist
+func (db *Database) prepareStatements() error {
+	statements := map[**sql.Stmt]string{
+		&db.stmts.unimportedEntries: getUnimportedEntriesSQL,
+		&db.stmts.entriesBetween:    getEntriesBetweenSQL,
+		&db.stmts.allEntriesBetween: getAllEntriesBetweenSQL,
+		&db.stmts.activeEntry:       getActiveEntrySQL,
+		&db.stmts.hasActiveEntry:    hasActiveEntrySQL,
+		&db.stmts.activeEntries:     getActiveEntriesSQL,
+		&db.stmts.userSettings:      getUserSettingsSQL,
+		&db.stmts.apiTokenByHash:    getApiTokenByTokenHashSQL,
+		&db.stmts.apiTokenLastUsed:  updateApiTokenLastUsed,
+	}
+
+	for stmt, query := range statements {
+		prepared, err := db.conn.Prepare(query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		*stmt = prepared
+	}
+	return nil
+}
+
 // Gets list of unimported entries
 func (db *Database) GetUnimportedEntries() ([]Entry, error) {
-	entries, err := db.conn.Query(getUnimportedEntriesSQL)
+	entries, err := db.stmts.unimportedEntries.Query()
+	if err != nil {
+		return nil, fmt.Errorf("Error querying entries: %w", err)
+	}
+	defer entries.Close()
+
+	return db.decryptNotes(scanEntries(entries))
+}
+
+// Gets entries of user started in [from, to) range, ordered by start time
+func (db *Database) GetEntriesBetween(userID string, from time.Time, to time.Time) ([]Entry, error) {
+	entries, err := db.stmts.entriesBetween.Query(userID, from.Unix(), to.Unix())
 	if err != nil {
 		return nil, fmt.Errorf("Error querying entries: %w", err)
 	}
 	defer entries.Close()
 
+	return db.decryptNotes(scanEntries(entries))
+}
+
+// Gets entries of all users started in [from, to) range, ordered by start time
+func (db *Database) GetAllEntriesBetween(from time.Time, to time.Time) ([]Entry, error) {
+	entries, err := db.stmts.allEntriesBetween.Query(from.Unix(), to.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("Error querying entries: %w", err)
+	}
+	defer entries.Close()
+
+	return db.decryptNotes(scanEntries(entries))
+}
+
+// Gets IDs of all users that tracked time or changed their settings
+func (db *Database) GetKnownUserIDs() ([]string, error) {
+	rows, err := db.conn.Query(getKnownUserIDsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("Error scanning user: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// Scans rows selected with full entry column list
+func scanEntries(entries *sql.Rows) ([]Entry, error) {
 	var results []Entry
 	for entries.Next() {
 		var entry Entry
@@ -108,8 +227,10 @@ func (db *Database) GetUnimportedEntries() ([]Entry, error) {
 			&entry.StartTime,
 			&entry.EndTime,
 			&entry.Note,
+			&entry.Project,
 			&entry.Active,
 			&entry.ImportedAt,
+			&entry.Billable,
 		); err != nil {
 			return nil, fmt.Errorf("Error scanning entry: %w", err)
 		}
@@ -124,12 +245,31 @@ func (db *Database) GetUnimportedEntries() ([]Entry, error) {
 }
 
 // Updates imported status for entry
-func (db *Database) UpdateEntryImportStatus(entryID int) error {
-	_, err := db.conn.Exec(updateEntryImportStatusSQL, entryID)
+func (db *Database) UpdateEntryImportStatus(actor string, entryID int) error {
+	tx, err := db.conn.Begin()
 	if err != nil {
 		return fmt.Errorf("Error updating import status for entry %d: %w", entryID, err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	before, err := getEntryByID(tx, int64(entryID))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(updateEntryImportStatusSQL, entryID); err != nil {
+		return fmt.Errorf("Error updating import status for entry %d: %w", entryID, err)
+	}
+
+	after, err := getEntryByID(tx, int64(entryID))
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(tx, actor, "mark_imported", AuditEntry, entryID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Checks if entry exists and their import status
@@ -143,25 +283,69 @@ func (db *Database) CheckEntry(entryID int) (exists bool, isImported bool, err e
 	return count > 0, unimported == 1, nil
 }
 
-// Starts entry tracking for user
-func (db *Database) StartTracking(userID string, note string) error {
-	// Check if user already has an active entry
-	active, err := db.hasActiveEntry(userID)
+// Starts entry tracking for user with optional note and project
+func (db *Database) StartTracking(userID string, note string, project string) (Entry, error) {
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return err
+		return Entry{}, fmt.Errorf("failed to create entry: %w", err)
+	}
+	defer tx.Rollback()
+
+	entry, err := db.startEntry(tx, userID, note, project)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Entry{}, fmt.Errorf("failed to create entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Creates active entry for user in transaction, so callers can store
+// records referring to the entry together with it
+func (db *Database) startEntry(tx *sql.Tx, userID string, note string, project string) (Entry, error) {
+	// Check if user already has an active entry
+	var count int
+	if err := tx.QueryRow(hasActiveEntrySQL, userID).Scan(&count); err != nil {
+		return Entry{}, fmt.Errorf("Failed to check active entry: %w", err)
+	}
+
+	if count > 0 {
+		return Entry{}, fmt.Errorf("User already have started tracking.")
+	}
+
+	now := time.Now()
+	if err := checkUnlocked(tx, lockedAtSQL, userID, now, now); err != nil {
+		return Entry{}, err
 	}
 
-	if active {
-		return fmt.Errorf("User already have started tracking.")
+	stored, err := db.notes.Encrypt(note)
+	if err != nil {
+		return Entry{}, err
 	}
 
 	// Create new entry
-	_, err = db.conn.Exec(createEntrySQL, userID, time.Now(), note)
+	res, err := tx.Exec(createEntrySQL, userID, now, stored, project)
 	if err != nil {
-		return fmt.Errorf("failed to create entry: %w", err)
+		return Entry{}, fmt.Errorf("failed to create entry: %w", err)
 	}
 
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to create entry: %w", err)
+	}
+
+	entry, err := getEntryByID(tx, id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := writeAudit(tx, userActor(userID), "start", AuditEntry, entry.ID, nil, entry); err != nil {
+		return Entry{}, err
+	}
+
+	entry.Note = note
+	return entry, nil
 }
 
 // Completes active entry tracking for user
@@ -175,12 +359,62 @@ func (db *Database) StopTracking(userID string) (Entry, error) {
 		return Entry{}, fmt.Errorf("There is no active entry currently.")
 	}
 
-	// End the entry
-	endTime := time.Now()
-	_, err = db.conn.Exec(updateEntrySQL, endTime, entry.ID)
+	return db.stopEntry(userActor(userID), entry, time.Now())
+}
+
+// Completes specific active entry of user with given end time. Actor is
+// recorded in audit log, e.g. user who ended a meeting.
+func (db *Database) StopEntryAt(actor string, userID string, entryID int64, endTime time.Time) (Entry, error) {
+	entry, found, err := db.getActiveEntry(userID)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !found || entry.ID != entryID {
+		return Entry{}, fmt.Errorf("This timer is not running anymore.")
+	}
+	if endTime.Before(entry.StartTime) {
+		return Entry{}, fmt.Errorf("End time can not be before start time.")
+	}
+	if endTime.After(time.Now()) {
+		return Entry{}, fmt.Errorf("End time can not be in the future.")
+	}
+
+	return db.stopEntry(actor, entry, endTime)
+}
+
+// Ends active entry and returns its updated copy. Focus session running
+// on the entry is marked as interrupted.
+func (db *Database) stopEntry(actor string, entry Entry, endTime time.Time) (Entry, error) {
+	tx, err := db.conn.Begin()
 	if err != nil {
 		return Entry{}, fmt.Errorf("Failed to end entry: %w", err)
 	}
+	defer tx.Rollback()
+
+	before, err := getEntryByID(tx, entry.ID)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if _, err := tx.Exec(stopEntrySQL, endTime, entry.ID, entry.UserID); err != nil {
+		return Entry{}, fmt.Errorf("Failed to end entry: %w", err)
+	}
+
+	after, err := getEntryByID(tx, entry.ID)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := writeAudit(tx, actor, "stop", AuditEntry, entry.ID, before, after); err != nil {
+		return Entry{}, err
+	}
+
+	if _, err := tx.Exec(interruptFocusSessionSQL, entry.ID); err != nil {
+		return Entry{}, fmt.Errorf("Failed to end focus session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Entry{}, fmt.Errorf("Failed to end entry: %w", err)
+	}
 
 	// Update the entry object
 	entry.EndTime = sql.NullTime{Time: endTime, Valid: true}
@@ -189,11 +423,47 @@ func (db *Database) StopTracking(userID string) (Entry, error) {
 	return entry, nil
 }
 
+// Gets active entries of all users
+func (db *Database) GetActiveEntries() ([]Entry, error) {
+	rows, err := db.stmts.activeEntries.Query()
+	if err != nil {
+		return nil, fmt.Errorf("Error querying active entries: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Entry
+	for rows.Next() {
+		entry := Entry{Active: true}
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.StartTime, &entry.Note, &entry.Project, &entry.RemindedAt); err != nil {
+			return nil, fmt.Errorf("Error scanning active entry: %w", err)
+		}
+		if err := db.decryptNote(&entry); err != nil {
+			return nil, err
+		}
+		results = append(results, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error iterating active entries: %w", err)
+	}
+
+	return results, nil
+}
+
+// Records when user was last reminded about running entry
+func (db *Database) MarkEntryReminded(entryID int64, at time.Time) error {
+	_, err := db.conn.Exec(updateEntryRemindedAtSQL, at, entryID)
+	if err != nil {
+		return fmt.Errorf("Failed to update reminder for entry %d: %w", entryID, err)
+	}
+	return nil
+}
+
 // Checks if user has active (currently tracking) entry
 // TODO: Make seperate log and bot messages
 func (db *Database) hasActiveEntry(userID string) (bool, error) {
 	var count int
-	err := db.conn.QueryRow(hasActiveEntrySQL, userID).Scan(&count)
+	err := db.stmts.hasActiveEntry.QueryRow(userID).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("Failed to check active entry: %w", err)
 	}
@@ -203,12 +473,12 @@ func (db *Database) hasActiveEntry(userID string) (bool, error) {
 // Get currently active tracking entry for user
 // TODO: Make seperate log and bot messages
 func (db *Database) getActiveEntry(userID string) (Entry, bool, error) {
-	row := db.conn.QueryRow(getActiveEntrySQL, userID)
+	row := db.stmts.activeEntry.QueryRow(userID)
 
 	var entry Entry
 	var endTime sql.NullTime
 
-	err := row.Scan(&entry.ID, &entry.UserID, &entry.StartTime, &endTime, &entry.Active)
+	err := row.Scan(&entry.ID, &entry.UserID, &entry.StartTime, &endTime, &entry.Note, &entry.Project, &entry.Active, &entry.RemindedAt)
 	if err == sql.ErrNoRows {
 		return Entry{}, false, nil
 	}
@@ -217,11 +487,14 @@ func (db *Database) getActiveEntry(userID string) (Entry, bool, error) {
 	}
 
 	entry.EndTime = endTime
+	if err := db.decryptNote(&entry); err != nil {
+		return Entry{}, false, err
+	}
 	return entry, true, nil
 }
 
 // Creates API token
-func (db *Database) CreateApiToken(token string) error {
+func (db *Database) CreateApiToken(actor string, token string) error {
 	tokenHash := Hash(token)
 
 	now := time.Now()
@@ -232,19 +505,35 @@ func (db *Database) CreateApiToken(token string) error {
 		IsActive:  true,
 	}
 
-	_, err := db.conn.Exec(createApiTokenSQL, apiToken.TokenHash, apiToken.CreatedAt, apiToken.IsActive)
+	tx, err := db.conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to insert token: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
+	res, err := tx.Exec(createApiTokenSQL, apiToken.TokenHash, apiToken.CreatedAt, apiToken.IsActive)
+	if err != nil {
+		return fmt.Errorf("failed to insert token: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert token: %w", err)
+	}
+
+	// hash is left out, it is enough to know which token changed
+	after := map[string]any{"id": id, "created_at": apiToken.CreatedAt, "is_active": apiToken.IsActive}
+	if err := writeAudit(tx, actor, "create", AuditToken, id, nil, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Gets api token by using its hash
 func (db *Database) GetApiTokenByHash(tokenHash string) (*ApiToken, error) {
 	var token ApiToken
 
-	err := db.conn.QueryRow(getApiTokenByTokenHashSQL, tokenHash).Scan(&token.ID, &token.TokenHash, &token.CreatedAt, &token.LastUsed, &token.IsActive)
+	err := db.stmts.apiTokenByHash.QueryRow(tokenHash).Scan(&token.ID, &token.TokenHash, &token.CreatedAt, &token.LastUsed, &token.IsActive)
 	if err != nil {
 		return nil, fmt.Errorf("token not found: %w", err)
 	}
@@ -255,7 +544,7 @@ func (db *Database) GetApiTokenByHash(tokenHash string) (*ApiToken, error) {
 // Updates api token last used at property
 func (db *Database) UpdateApiTokenLastUsed(tokenID int) error {
 	now := time.Now()
-	_, err := db.conn.Exec(updateApiTokenLastUsed, now, tokenID)
+	_, err := db.stmts.apiTokenLastUsed.Exec(now, tokenID)
 	if err != nil {
 		return fmt.Errorf("failed to update token last used: %w", err)
 	}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Opens migrated database in temporary directory of the test
+func newTestDatabase(t testing.TB) *Database {
+	t.Helper()
+	return newTestDatabaseWithKeys(t, NoteKeys{})
+}
+
+// Opens migrated database encrypting notes with keys
+func newTestDatabaseWithKeys(t testing.TB, keys NoteKeys) *Database {
+	t.Helper()
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"), keys)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.conn.Close() })
+	return db
+}
+
+// Size of benchmark dataset and its shape
+const (
+	benchEntries    = 100_000
+	benchUsers      = 50
+	benchUnimported = 2_000
+)
+
+var benchStart = time.Date(2022, 1, 3, 8, 0, 0, 0, time.UTC)
+
+// Fills database with finished entries of several users spread over two years,
+// the newest of them not imported, and one running timer per user.
+func seedEntries(t testing.TB, db *Database) {
+	t.Helper()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO entries (user_id, start_time, end_time, note, project, active, imported_at) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	importedAt := benchStart
+	for i := 0; i < benchEntries; i++ {
+		userID := fmt.Sprint(i%benchUsers + 1)
+		start := benchStart.Add(time.Duration(i/benchUsers) * 8 * time.Hour)
+		var imported any = importedAt
+		if i >= benchEntries-benchUnimported {
+			imported = nil
+		}
+		if _, err := stmt.Exec(userID, start, start.Add(45*time.Minute), "Work on ticket", fmt.Sprintf("project-%d", i%7), false, imported); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last := benchStart.Add(time.Duration(benchEntries/benchUsers) * 8 * time.Hour)
+	for user := 1; user <= benchUsers; user++ {
+		if _, err := stmt.Exec(fmt.Sprint(user), last, nil, "Running", "", true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Indexes added for the hot queries, dropped to compare with them
+var entryIndexes = []string{"entries_user_start", "entries_start", "entries_active", "entries_imported_at"}
+
+func TestEntryQueriesUseIndexes(t *testing.T) {
+	db := newTestDatabase(t)
+	seedEntries(t, db)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+		index string
+	}{
+		{"entries of user between", getEntriesBetweenSQL, []any{"1", 0, 1}, "entries_user_start"},
+		{"all entries between", getAllEntriesBetweenSQL, []any{0, 1}, "entries_start"},
+		{"active entry", getActiveEntrySQL, []any{"1"}, "entries_active"},
+		{"active entries", getActiveEntriesSQL, nil, "entries_active"},
+		{"unimported entries", getUnimportedEntriesSQL, nil, "entries_imported_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.conn.Query("EXPLAIN QUERY PLAN "+tt.query, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+			}
+			if !strings.Contains(strings.Join(plan, "\n"), "USING INDEX "+tt.index) {
+				t.Errorf("plan does not use %s:\n%s", tt.index, strings.Join(plan, "\n"))
+			}
+		})
+	}
+}
+
+// Compares prepared statements with queries prepared on every call, with
+// and without the indexes of the entries table, on 100k entries. Run with
+//
+//	go test -run '^$' -bench EntryQueries
+func BenchmarkEntryQueries(b *testing.B) {
+	from := benchStart.Add(1000 * time.Hour)
+	to := from.Add(7 * 24 * time.Hour)
+
+	for _, indexed := range []bool{true, false} {
+		db := newTestDatabase(b)
+		seedEntries(b, db)
+		name := "indexed"
+		if !indexed {
+			name = "unindexed"
+			for _, index := range entryIndexes {
+				if _, err := db.conn.Exec("DROP INDEX " + index); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+
+		queries := []struct {
+			name     string
+			prepared func() error
+			adHoc    func() error
+		}{
+			{
+				name: "GetEntriesBetween",
+				prepared: func() error {
+					_, err := db.GetEntriesBetween("7", from, to)
+					return err
+				},
+				adHoc: func() error {
+					rows, err := db.conn.Query(getEntriesBetweenSQL, "7", from.Unix(), to.Unix())
+					if err != nil {
+						return err
+					}
+					defer rows.Close()
+					_, err = db.decryptNotes(scanEntries(rows))
+					return err
+				},
+			},
+			{
+				name: "getActiveEntry",
+				prepared: func() error {
+					_, _, err := db.getActiveEntry("7")
+					return err
+				},
+				adHoc: func() error {
+					var entry Entry
+					return db.conn.QueryRow(getActiveEntrySQL, "7").Scan(&entry.ID, &entry.UserID, &entry.StartTime, &entry.EndTime, &entry.Note, &entry.Project, &entry.Active, &entry.RemindedAt)
+				},
+			},
+			{
+				name: "GetUnimportedEntries",
+				prepared: func() error {
+					_, err := db.GetUnimportedEntries()
+					return err
+				},
+				adHoc: func() error {
+					rows, err := db.conn.Query(getUnimportedEntriesSQL)
+					if err != nil {
+						return err
+					}
+					defer rows.Close()
+					_, err = db.decryptNotes(scanEntries(rows))
+					return err
+				},
+			},
+		}
+
+		for _, query := range queries {
+			for _, variant := range []struct {
+				name string
+				run  func() error
+			}{{"prepared", query.prepared}, {"adhoc", query.adHoc}} {
+				b.Run(query.name+"/"+name+"/"+variant.name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if err := variant.run(); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Sends daily and weekly digests to users whose local digest time has passed
+// and who did not receive them today yet. Last sent dates are stored in user
+// settings, so digests are not repeated after restart.
+func (b *Bot) sendDueDigests(now time.Time) {
+	userIDs, err := b.db.GetKnownUserIDs()
+	if err != nil {
+		slog.Error("failed to get users for digests", "error", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		chatID, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil || !b.isAuthorized(chatID) {
+			continue
+		}
+
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			slog.Error("failed to get user settings", "user_id", userID, "error", err)
+			continue
+		}
+
+		local, daily, weekly := b.dueDigests(settings, now)
+		today := local.Format(time.DateOnly)
+
+		if daily {
+			if err := b.db.SetUserSetting(userID, "digest_sent_on", today); err != nil {
+				slog.Error("failed to record daily digest", "user_id", userID, "error", err)
+				continue
+			}
+			b.sendDailyDigest(chatID, userID, local)
+		}
+
+		if weekly {
+			if err := b.db.SetUserSetting(userID, "weekly_digest_sent_on", today); err != nil {
+				slog.Error("failed to record weekly digest", "user_id", userID, "error", err)
+				continue
+			}
+			b.sendWeeklyDigest(chatID, userID, local)
+		}
+	}
+}
+
+// Decides which digests of user are due at now. Returns now in user's
+// timezone, which digests are built for.
+func (b *Bot) dueDigests(settings UserSettings, now time.Time) (local time.Time, daily bool, weekly bool) {
+	local = now.In(settings.Location(b.cfg.Timezone))
+	if !b.digestTimeReached(settings, local) {
+		return local, false, false
+	}
+	today := local.Format(time.DateOnly)
+
+	daily = b.dailyDigestEnabled(settings) && settings.DigestSentOn.String != today
+	weekly = settings.WeeklyDigestEnabled.Bool && local.Weekday() == b.cfg.WeeklyDigestDay && settings.WeeklyDigestSentOn.String != today
+	return local, daily, weekly
+}
+
+// Checks if user's digest time already passed today in their timezone
+func (b *Bot) digestTimeReached(settings UserSettings, local time.Time) bool {
+	clock := b.cfg.DigestTime
+	if settings.DigestTime.Valid {
+		clock = settings.DigestTime.String
+	}
+
+	offset, err := parseClock(clock)
+	if err != nil {
+		return false
+	}
+	return !local.Before(startOfDay(local).Add(offset))
+}
+
+func (b *Bot) dailyDigestEnabled(settings UserSettings) bool {
+	if settings.DigestEnabled.Valid {
+		return settings.DigestEnabled.Bool
+	}
+	return b.cfg.DigestEnabledByDefault
+}
+
+// Sends summary of the day before local time
+func (b *Bot) sendDailyDigest(chatID int64, userID string, local time.Time) {
+	from, to, _ := parsePeriod("yesterday", local, local.Location())
+
+	report, err := b.db.GetReport(userID, from, to, b.cfg.Rounding)
+	if err != nil {
+		slog.Error("failed to build daily digest", "user_id", userID, "error", err)
+		return
+	}
+
+	// entries started before yesterday which are still running are relevant too
+	if active, found, err := b.db.getActiveEntry(userID); err == nil && found && active.StartTime.Before(from) {
+		report.Open = append(report.Open, active)
+	}
+
+	b.sendMessage(chatID, formatReport("🗓️ Daily digest for "+periodTitle(from, to), report, time.Now()), 0)
+}
+
+// Sends summary of the week before local time
+func (b *Bot) sendWeeklyDigest(chatID int64, userID string, local time.Time) {
+	from, to, _ := parsePeriod("lastweek", local, local.Location())
+
+	report, err := b.db.GetReport(userID, from, to, b.cfg.Rounding)
+	if err != nil {
+		slog.Error("failed to build weekly digest", "user_id", userID, "error", err)
+		return
+	}
+
+	b.sendMessage(chatID, formatReport("📅 Weekly digest for "+periodTitle(from, to), report, time.Now()), 0)
+}
+
+// Manages digest subscription.
+//
+// Usage:
+//
+//	/digest
+//	/digest on|off
+//	/digest weekly on|off
+//	/digest time HH:MM
+//	/digest now
+func (b *Bot) handleDigestCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(strings.ToLower(args))
+
+	reply := func(text string, err error) {
+		if err != nil {
+			text = fmt.Sprintf("%s", err)
+		}
+		b.sendMessage(message.Chat.ID, text, message.MessageID)
+	}
+
+	switch {
+	case len(fields) == 0:
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			reply("", err)
+			return
+		}
+		reply(b.describeDigest(settings), nil)
+	case len(fields) == 1 && fields[0] == "on":
+		reply("🗓️ Daily digest is turned on.", b.db.SetUserSetting(userID, "digest_enabled", true))
+	case len(fields) == 1 && fields[0] == "off":
+		reply("🗓️ Daily digest is turned off.", b.db.SetUserSetting(userID, "digest_enabled", false))
+	case len(fields) == 2 && fields[0] == "weekly" && fields[1] == "on":
+		reply("📅 Weekly digest is turned on.", b.db.SetUserSetting(userID, "weekly_digest_enabled", true))
+	case len(fields) == 2 && fields[0] == "weekly" && fields[1] == "off":
+		reply("📅 Weekly digest is turned off.", b.db.SetUserSetting(userID, "weekly_digest_enabled", false))
+	case len(fields) == 2 && fields[0] == "time":
+		offset, err := parseClock(fields[1])
+		if err != nil {
+			reply("", err)
+			return
+		}
+		clock := formatClock(offset)
+		reply("🗓️ Digest will be sent at "+clock+".", b.db.SetUserSetting(userID, "digest_time", clock))
+	case len(fields) == 1 && fields[0] == "now":
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			reply("", err)
+			return
+		}
+		b.sendDailyDigest(message.Chat.ID, userID, time.Now().In(settings.Location(b.cfg.Timezone)))
+	default:
+		reply(digestUsage, nil)
+	}
+}
+
+const digestUsage = "Usage:\n" +
+	"/digest on|off - Daily digest of yesterday's entries\n" +
+	"/digest weekly on|off - Weekly rollup of the last week\n" +
+	"/digest time HH:MM - Local time when digests are sent\n" +
+	"/digest now - Send yesterday's digest now"
+
+// Builds overview of user's digest subscription
+func (b *Bot) describeDigest(settings UserSettings) string {
+	onOff := func(enabled bool) string {
+		if enabled {
+			return "on"
+		}
+		return "off"
+	}
+
+	clock := b.cfg.DigestTime
+	if settings.DigestTime.Valid {
+		clock = settings.DigestTime.String
+	}
+
+	return fmt.Sprintf("🗓️ Daily digest: %s\n📅 Weekly digest: %s (%s)\n⏰ Time: %s (%s)\n\n%s",
+		onOff(b.dailyDigestEnabled(settings)),
+		onOff(settings.WeeklyDigestEnabled.Bool),
+		b.cfg.WeeklyDigestDay,
+		clock,
+		settings.Location(b.cfg.Timezone),
+		digestUsage,
+	)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestDueDigests(t *testing.T) {
+	// Monday morning in UTC, still Sunday in Honolulu
+	now := time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)
+	b := &Bot{cfg: &Config{
+		Timezone:               time.UTC,
+		DigestTime:             "08:00",
+		WeeklyDigestDay:        time.Monday,
+		DigestEnabledByDefault: true,
+	}}
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	weeklyOn := sql.NullBool{Bool: true, Valid: true}
+
+	tests := []struct {
+		name       string
+		settings   UserSettings
+		wantDay    string
+		wantDaily  bool
+		wantWeekly bool
+	}{
+		{"before digest time", UserSettings{}, "2024-03-04", false, false},
+		{"before digest time with weekly", UserSettings{WeeklyDigestEnabled: weeklyOn}, "2024-03-04", false, false},
+		{"own earlier digest time", UserSettings{DigestTime: str("07:00")}, "2024-03-04", true, false},
+		{"east of UTC", UserSettings{Timezone: str("Europe/Belgrade")}, "2024-03-04", true, false},
+		{"east of UTC with weekly", UserSettings{Timezone: str("Europe/Belgrade"), WeeklyDigestEnabled: weeklyOn}, "2024-03-04", true, true},
+		{"already sent today", UserSettings{Timezone: str("Asia/Tokyo"), DigestSentOn: str("2024-03-04")}, "2024-03-04", false, false},
+		{"sent yesterday", UserSettings{Timezone: str("Asia/Tokyo"), DigestSentOn: str("2024-03-03")}, "2024-03-04", true, false},
+		{"weekly sent today", UserSettings{Timezone: str("Asia/Tokyo"), WeeklyDigestEnabled: weeklyOn, WeeklyDigestSentOn: str("2024-03-04")}, "2024-03-04", true, false},
+		{"daily turned off", UserSettings{Timezone: str("Asia/Tokyo"), DigestEnabled: sql.NullBool{Valid: true}, WeeklyDigestEnabled: weeklyOn}, "2024-03-04", false, true},
+		{"west of UTC before digest time", UserSettings{Timezone: str("America/New_York"), WeeklyDigestEnabled: weeklyOn}, "2024-03-04", false, false},
+		{"previous day west of UTC", UserSettings{Timezone: str("Pacific/Honolulu"), WeeklyDigestEnabled: weeklyOn}, "2024-03-03", true, false},
+		{"previous day already sent", UserSettings{Timezone: str("Pacific/Honolulu"), DigestSentOn: str("2024-03-03")}, "2024-03-03", false, false},
+		{"unknown timezone uses default", UserSettings{Timezone: str("Mars/Olympus"), DigestTime: str("07:00")}, "2024-03-04", true, false},
+		{"invalid digest time", UserSettings{DigestTime: str("7am")}, "2024-03-04", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, daily, weekly := b.dueDigests(tt.settings, now)
+			if day := local.Format(time.DateOnly); day != tt.wantDay {
+				t.Errorf("local day = %s, want %s", day, tt.wantDay)
+			}
+			if daily != tt.wantDaily || weekly != tt.wantWeekly {
+				t.Errorf("dueDigests() daily = %v, weekly = %v, want %v, %v", daily, weekly, tt.wantDaily, tt.wantWeekly)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Distributes Telegram updates over a fixed number of workers.
+//
+// Updates are sharded by sender ID, so every update of a single user is
+// handled by the same worker in the order it was received, while updates
+// of different users are processed in parallel.
+type Dispatcher struct {
+	shards []chan tgbotapi.Update
+	handle func(tgbotapi.Update)
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(workers int, queueSize int, handle func(tgbotapi.Update)) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	shards := make([]chan tgbotapi.Update, workers)
+	for i := range shards {
+		shards[i] = make(chan tgbotapi.Update, queueSize)
+	}
+
+	return &Dispatcher{
+		shards: shards,
+		handle: handle,
+	}
+}
+
+// Starts worker goroutines
+func (d *Dispatcher) Start() {
+	for _, shard := range d.shards {
+		d.wg.Add(1)
+		go func(updates <-chan tgbotapi.Update) {
+			defer d.wg.Done()
+			for update := range updates {
+				d.process(update)
+			}
+		}(shard)
+	}
+}
+
+// Queues update on the worker owning its sender. Blocks when that
+// worker's queue is full, which applies backpressure to the poller.
+func (d *Dispatcher) Dispatch(update tgbotapi.Update) {
+	d.shards[d.shardFor(update)] <- update
+}
+
+// Stops accepting updates and waits until queued ones are processed
+func (d *Dispatcher) Stop() {
+	for _, shard := range d.shards {
+		close(shard)
+	}
+	d.wg.Wait()
+}
+
+// Picks worker index for update based on sender, falling back to chat
+func (d *Dispatcher) shardFor(update tgbotapi.Update) int {
+	var key int64
+	if user := update.SentFrom(); user != nil {
+		key = user.ID
+	} else if chat := update.FromChat(); chat != nil {
+		key = chat.ID
+	}
+
+	if key < 0 {
+		key = -key
+	}
+	return int(key % int64(len(d.shards)))
+}
+
+// Handles single update, recovering from panics so one bad update
+// does not take the worker down
+func (d *Dispatcher) process(update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic while handling update", "update_id", update.UpdateID, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		}
+	}()
+
+	d.handle(update)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDispatcherKeepsOrderOfUser(t *testing.T) {
+	const users = 20
+	const updatesPerUser = 200
+
+	var mu sync.Mutex
+	handled := make(map[int]int)
+	order := make(map[int64][]int)
+
+	d := NewDispatcher(4, 8, func(update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[update.UpdateID]++
+		userID := update.Message.From.ID
+		order[userID] = append(order[userID], update.Message.MessageID)
+	})
+	d.Start()
+
+	// every user sends from own goroutine, like updates of many chats
+	// arriving interleaved
+	var senders sync.WaitGroup
+	var dispatchMu sync.Mutex
+	nextID := 0
+	for user := int64(1); user <= users; user++ {
+		senders.Add(1)
+		go func(userID int64) {
+			defer senders.Done()
+			for seq := 1; seq <= updatesPerUser; seq++ {
+				// poller dispatches one update at a time
+				dispatchMu.Lock()
+				nextID++
+				d.Dispatch(tgbotapi.Update{
+					UpdateID: nextID,
+					Message: &tgbotapi.Message{
+						MessageID: seq,
+						From:      &tgbotapi.User{ID: userID},
+						Chat:      &tgbotapi.Chat{ID: userID},
+					},
+				})
+				dispatchMu.Unlock()
+			}
+		}(user)
+	}
+	senders.Wait()
+	d.Stop()
+
+	if len(handled) != users*updatesPerUser {
+		t.Fatalf("handled %d updates, want %d", len(handled), users*updatesPerUser)
+	}
+	for id, count := range handled {
+		if count != 1 {
+			t.Errorf("update %d handled %d times", id, count)
+		}
+	}
+	for userID, seqs := range order {
+		for i, seq := range seqs {
+			if seq != i+1 {
+				t.Fatalf("user %d: update %d handled at position %d", userID, seq, i+1)
+			}
+		}
+	}
+}
+
+func TestDispatcherRecoversFromPanic(t *testing.T) {
+	var mu sync.Mutex
+	var handled []int
+
+	d := NewDispatcher(1, 0, func(update tgbotapi.Update) {
+		if update.UpdateID == 1 {
+			panic("broken update")
+		}
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		mu.Unlock()
+	})
+	d.Start()
+
+	for id := 1; id <= 3; id++ {
+		d.Dispatch(tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 1}}})
+	}
+	d.Stop()
+
+	if len(handled) != 2 || handled[0] != 2 || handled[1] != 3 {
+		t.Fatalf("handled = %v, want [2 3]", handled)
+	}
+}
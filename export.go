@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Writes entries in a specific file format.
+type Exporter interface {
+	// Short name used to select the format, e.g. "csv"
+	Name() string
+	Extension() string
+	ContentType() string
+	Export(w io.Writer, entries []Entry, opts ExportOptions) error
+}
+
+// Settings shared by all exporters
+type ExportOptions struct {
+	// Location used for local dates and times
+	Location *time.Location
+	// Running entries are exported as ending at this time
+	Now time.Time
+	// Client of each project, keyed by project name
+	Clients map[string]string
+	// Person the entries belong to, for tools that require one
+	Email string
+	Name  string
+	// Rounding of durations, exact times of entries are kept where formats allow
+	Rounding RoundingRules
+}
+
+// Implemented by exporters of tools which reject files without email of
+// the person the entries belong to
+type emailExporter interface {
+	RequiresEmail() bool
+}
+
+// Checks if exporter needs ExportOptions.Email to produce a valid file
+func requiresEmail(exporter Exporter) bool {
+	e, ok := exporter.(emailExporter)
+	return ok && e.RequiresEmail()
+}
+
+var exporters = make(map[string]Exporter)
+
+// Aliases accepted in addition to exporter names
+var exporterAliases = map[string]string{
+	"json":     "jsonl",
+	"ical":     "ics",
+	"calendar": "ics",
+	"timew":    "timewarrior",
+}
+
+// Makes exporter available by its name
+func registerExporter(exporter Exporter) {
+	exporters[exporter.Name()] = exporter
+}
+
+func init() {
+	registerExporter(csvExporter{})
+	registerExporter(jsonLinesExporter{})
+	registerExporter(icsExporter{})
+	registerExporter(togglExporter{})
+	registerExporter(clockifyExporter{})
+	registerExporter(harvestExporter{})
+	registerExporter(timewarriorExporter{})
+}
+
+// Gets exporter by name or alias
+func getExporter(name string) (Exporter, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := exporterAliases[name]; ok {
+		name = alias
+	}
+
+	exporter, ok := exporters[name]
+	return exporter, ok
+}
+
+// Gets sorted names of available export formats
+func exporterNames() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Gets rounded duration of entry, running entries are counted until export time
+func (o ExportOptions) duration(entry Entry) time.Duration {
+	return o.Rounding.Duration(entry, o.Now)
+}
+
+// Gets end time of entry after rounding its duration, running entries end at export time
+func (o ExportOptions) endTime(entry Entry) time.Time {
+	return entry.StartTime.Add(o.duration(entry))
+}
+
+// Gets client of entry's project, empty if there is none
+func (o ExportOptions) client(entry Entry) string {
+	return o.Clients[entry.Project]
+}
+
+// Plain CSV with one row per entry.
+type csvExporter struct{}
+
+func (csvExporter) Name() string        { return "csv" }
+func (csvExporter) Extension() string   { return "csv" }
+func (csvExporter) ContentType() string { return "text/csv" }
+
+func (csvExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"id", "user_id", "start_time", "end_time", "duration_seconds", "rounded_seconds", "note", "project", "client", "active", "billable"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		end := ""
+		if entry.EndTime.Valid {
+			end = entry.EndTime.Time.In(opts.Location).Format(time.RFC3339)
+		}
+
+		record := []string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.UserID,
+			entry.StartTime.In(opts.Location).Format(time.RFC3339),
+			end,
+			strconv.FormatInt(int64(entry.Duration(opts.Now).Seconds()), 10),
+			strconv.FormatInt(int64(opts.duration(entry).Seconds()), 10),
+			entry.Note,
+			entry.Project,
+			opts.client(entry),
+			strconv.FormatBool(entry.Active),
+			strconv.FormatBool(entry.Billable),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// JSON Lines with one JSON object per entry.
+type jsonLinesExporter struct{}
+
+func (jsonLinesExporter) Name() string        { return "jsonl" }
+func (jsonLinesExporter) Extension() string   { return "jsonl" }
+func (jsonLinesExporter) ContentType() string { return "application/jsonl" }
+
+func (jsonLinesExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	encoder := json.NewEncoder(w)
+
+	for _, entry := range entries {
+		record := struct {
+			ID              int64      `json:"id"`
+			UserID          string     `json:"user_id"`
+			StartTime       time.Time  `json:"start_time"`
+			EndTime         *time.Time `json:"end_time"`
+			DurationSeconds int64      `json:"duration_seconds"`
+			RoundedSeconds  int64      `json:"rounded_seconds"`
+			Note            string     `json:"note"`
+			Project         string     `json:"project"`
+			Client          string     `json:"client,omitempty"`
+			Active          bool       `json:"active"`
+			Billable        bool       `json:"billable"`
+		}{
+			ID:              entry.ID,
+			UserID:          entry.UserID,
+			StartTime:       entry.StartTime.In(opts.Location),
+			DurationSeconds: int64(entry.Duration(opts.Now).Seconds()),
+			RoundedSeconds:  int64(opts.duration(entry).Seconds()),
+			Note:            entry.Note,
+			Project:         entry.Project,
+			Client:          opts.client(entry),
+			Active:          entry.Active,
+			Billable:        entry.Billable,
+		}
+		if entry.EndTime.Valid {
+			end := entry.EndTime.Time.In(opts.Location)
+			record.EndTime = &end
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// iCalendar file with one VEVENT per entry.
+type icsExporter struct{}
+
+func (icsExporter) Name() string        { return "ics" }
+func (icsExporter) Extension() string   { return "ics" }
+func (icsExporter) ContentType() string { return "text/calendar" }
+
+func (icsExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	const stamp = "20060102T150405Z"
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Timetick//Telegram Bot//EN",
+		"CALSCALE:GREGORIAN",
+	}
+
+	for _, entry := range entries {
+		summary := entry.Note
+		if summary == "" {
+			summary = "Time entry"
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:entry-%d-%s@timetick", entry.ID, entry.UserID),
+			"DTSTAMP:"+opts.Now.UTC().Format(stamp),
+			"DTSTART:"+entry.StartTime.UTC().Format(stamp),
+			"DTEND:"+opts.endTime(entry).UTC().Format(stamp),
+			"SUMMARY:"+escapeICSText(summary),
+		)
+		if entry.Project != "" {
+			lines = append(lines, "CATEGORIES:"+escapeICSText(entry.Project))
+		}
+		if entry.Active {
+			lines = append(lines, "STATUS:TENTATIVE")
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldICSLine(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Escapes text value according to RFC 5545
+func escapeICSText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// Folds content line longer than 75 octets, without splitting UTF-8 characters
+func foldICSLine(line string) string {
+	const limit = 75
+
+	var sb strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > limit {
+			sb.WriteString("\r\n ")
+			length = 1
+		}
+		sb.WriteRune(r)
+		length += size
+	}
+	return sb.String()
+}
+
+// Exports entries into memory, used when file is sent as a whole
+func exportToBytes(exporter Exporter, entries []Entry, opts ExportOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := exporter.Export(&buf, entries, opts); err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", exporter.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Builds export file name for the range, e.g. timetick-2024-01-01-2024-01-31.csv
+func exportFileName(prefix string, from time.Time, to time.Time, extension string) string {
+	last := to.AddDate(0, 0, -1)
+	if !last.After(from) {
+		return fmt.Sprintf("%s-%s.%s", prefix, from.Format(time.DateOnly), extension)
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", prefix, from.Format(time.DateOnly), last.Format(time.DateOnly), extension)
+}
+
+// Export file built for /export
+type exportFile struct {
+	Name    string
+	Data    []byte
+	Caption string
+}
+
+// Sends user's entries as a file.
+//
+// Usage:
+//
+//	/export [period] [format]
+func (b *Bot) handleExportCommand(message *tgbotapi.Message, userID string, args string) {
+	name := strings.TrimSpace(message.From.FirstName + " " + message.From.LastName)
+	file, err := b.exportEntries(userID, name, args, time.Now())
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	b.sendDocument(message.Chat.ID, file.Name, file.Data, file.Caption, message.MessageID)
+}
+
+// Exports user's entries in period and format given as /export arguments.
+// Name is full name of the user, written by formats which need one.
+func (b *Bot) exportEntries(userID string, name string, args string, now time.Time) (exportFile, error) {
+	period := "week"
+	format := "csv"
+
+	// arguments can be given in any order
+	for _, field := range strings.Fields(args) {
+		if _, ok := getExporter(field); ok {
+			format = field
+		} else {
+			period = field
+		}
+	}
+
+	exporter, _ := getExporter(format)
+
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		return exportFile{}, err
+	}
+	if requiresEmail(exporter) && !settings.Email.Valid {
+		return exportFile{}, fmt.Errorf("%s export needs your email, set it with /settings email you@example.com", exporter.Name())
+	}
+
+	clients, err := b.db.GetProjectClients()
+	if err != nil {
+		return exportFile{}, err
+	}
+
+	rounding, err := b.db.GetRoundingRules(b.cfg.Rounding)
+	if err != nil {
+		return exportFile{}, err
+	}
+	loc := settings.Location(b.cfg.Timezone)
+
+	from, to, err := parsePeriod(period, now, loc)
+	if err != nil {
+		return exportFile{}, fmt.Errorf("%w\nFormats: %s", err, strings.Join(exporterNames(), ", "))
+	}
+
+	entries, err := b.db.GetEntriesBetween(userID, from, to)
+	if err != nil {
+		return exportFile{}, err
+	}
+	if len(entries) == 0 {
+		return exportFile{}, fmt.Errorf("There are no entries for %s.", periodTitle(from, to))
+	}
+
+	opts := ExportOptions{
+		Location: loc,
+		Now:      now,
+		Clients:  clients,
+		Email:    settings.Email.String,
+		Name:     name,
+		Rounding: rounding,
+	}
+	data, err := exportToBytes(exporter, entries, opts)
+	if err != nil {
+		return exportFile{}, err
+	}
+
+	return exportFile{
+		Name:    exportFileName("timetick", from, to, exporter.Extension()),
+		Data:    data,
+		Caption: fmt.Sprintf("📤 %d entries, %s", len(entries), periodTitle(from, to)),
+	}, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Writers producing import files of other time tracking tools. They only
+// build files, uploading them is left to the user.
+
+// Formats duration as HH:MM:SS, hours are not limited to 24
+func formatHMS(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second))
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return "No"
+}
+
+// Writes CSV rows produced for each entry under the header
+func writeCSV(w io.Writer, header []string, entries []Entry, row func(Entry) []string) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writer.Write(row(entry)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Toggl Track CSV import format.
+// Email, start date, start time and duration are required by Toggl.
+type togglExporter struct{}
+
+func (togglExporter) Name() string        { return "toggl" }
+func (togglExporter) Extension() string   { return "csv" }
+func (togglExporter) ContentType() string { return "text/csv" }
+func (togglExporter) RequiresEmail() bool { return true }
+
+func (togglExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	header := []string{"Email", "Start date", "Start time", "Duration", "Project", "Client", "Description", "Tags", "Billable"}
+
+	return writeCSV(w, header, entries, func(entry Entry) []string {
+		start := entry.StartTime.In(opts.Location)
+		return []string{
+			opts.Email,
+			start.Format(time.DateOnly),
+			start.Format(time.TimeOnly),
+			formatHMS(opts.duration(entry)),
+			entry.Project,
+			opts.client(entry),
+			entry.Note,
+			"",
+			yesNo(entry.Billable),
+		}
+	})
+}
+
+// Clockify CSV import format. Rows are assigned to users by email.
+type clockifyExporter struct{}
+
+func (clockifyExporter) Name() string        { return "clockify" }
+func (clockifyExporter) Extension() string   { return "csv" }
+func (clockifyExporter) ContentType() string { return "text/csv" }
+func (clockifyExporter) RequiresEmail() bool { return true }
+
+func (clockifyExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	header := []string{"Project", "Client", "Description", "Task", "Email", "Tags", "Billable", "Start Date", "Start Time", "End Date", "End Time"}
+
+	return writeCSV(w, header, entries, func(entry Entry) []string {
+		start := entry.StartTime.In(opts.Location)
+		end := opts.endTime(entry).In(opts.Location)
+		return []string{
+			entry.Project,
+			opts.client(entry),
+			entry.Note,
+			"",
+			opts.Email,
+			"",
+			yesNo(entry.Billable),
+			start.Format(time.DateOnly),
+			start.Format(time.TimeOnly),
+			end.Format(time.DateOnly),
+			end.Format(time.TimeOnly),
+		}
+	})
+}
+
+// Harvest CSV import format. Harvest requires client, project and task on
+// every row, so missing values are filled with placeholders.
+type harvestExporter struct{}
+
+func (harvestExporter) Name() string        { return "harvest" }
+func (harvestExporter) Extension() string   { return "csv" }
+func (harvestExporter) ContentType() string { return "text/csv" }
+
+func (harvestExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	header := []string{"Date", "Client", "Project", "Task", "Notes", "Hours", "First name", "Last name"}
+
+	firstName, lastName, _ := strings.Cut(strings.TrimSpace(opts.Name), " ")
+
+	return writeCSV(w, header, entries, func(entry Entry) []string {
+		client := opts.client(entry)
+		if client == "" {
+			client = "Internal"
+		}
+		project := entry.Project
+		if project == "" {
+			project = "General"
+		}
+
+		return []string{
+			entry.StartTime.In(opts.Location).Format(time.DateOnly),
+			client,
+			project,
+			"General",
+			entry.Note,
+			fmt.Sprintf("%.2f", opts.duration(entry).Hours()),
+			firstName,
+			lastName,
+		}
+	})
+}
+
+// Timewarrior JSON format, as produced by "timew export" and accepted by
+// its import extensions. Project and client become tags, note is the annotation.
+type timewarriorExporter struct{}
+
+func (timewarriorExporter) Name() string        { return "timewarrior" }
+func (timewarriorExporter) Extension() string   { return "json" }
+func (timewarriorExporter) ContentType() string { return "application/json" }
+
+func (timewarriorExporter) Export(w io.Writer, entries []Entry, opts ExportOptions) error {
+	const stamp = "20060102T150405Z"
+
+	type interval struct {
+		ID         int      `json:"id"`
+		Start      string   `json:"start"`
+		End        string   `json:"end,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+		Annotation string   `json:"annotation,omitempty"`
+	}
+
+	intervals := make([]interval, 0, len(entries))
+	for i, entry := range entries {
+		item := interval{
+			// Timewarrior numbers intervals from the newest one
+			ID:         len(entries) - i,
+			Start:      entry.StartTime.UTC().Format(stamp),
+			Annotation: entry.Note,
+		}
+		if entry.EndTime.Valid {
+			item.End = opts.endTime(entry).UTC().Format(stamp)
+		}
+		if entry.Project != "" {
+			item.Tags = append(item.Tags, entry.Project)
+		}
+		if client := opts.client(entry); client != "" {
+			item.Tags = append(item.Tags, client)
+		}
+		intervals = append(intervals, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(intervals)
+}
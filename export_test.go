@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Finished entry with characters needing escaping and a running entry
+func exportTestEntries(loc *time.Location) []Entry {
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, loc)
+	return []Entry{
+		{
+			ID:        1,
+			UserID:    "42",
+			StartTime: start,
+			EndTime:   sql.NullTime{Time: start.Add(90 * time.Minute), Valid: true},
+			Note:      "Review \"login\", part 1; see notes\nand fix",
+			Project:   "web, mobile",
+			Billable:  true,
+		},
+		{
+			ID:        2,
+			UserID:    "42",
+			StartTime: start.Add(5 * time.Hour),
+			Project:   "internal",
+			Active:    true,
+		},
+	}
+}
+
+func TestExportersGolden(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ExportOptions{
+		Location: loc,
+		Now:      time.Date(2024, 3, 4, 15, 30, 0, 0, loc),
+		Clients:  map[string]string{"web, mobile": "ACME"},
+		Email:    "ana@example.com",
+		Name:     "Ana Petrović",
+	}
+
+	for _, name := range exporterNames() {
+		t.Run(name, func(t *testing.T) {
+			exporter, _ := getExporter(name)
+			data, err := exportToBytes(exporter, exportTestEntries(loc), opts)
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", "export", name+"."+exporter.Extension())
+			if *update {
+				if err := os.WriteFile(golden, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file, run with -update to create it: %v", err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("export differs from %s, run with -update if the change is intended\ngot:\n%s", golden, data)
+			}
+		})
+	}
+}
+
+func TestGetExporter(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"csv", "csv", true},
+		{" CSV ", "csv", true},
+		{"json", "jsonl", true},
+		{"calendar", "ics", true},
+		{"ical", "ics", true},
+		{"timew", "timewarrior", true},
+		{"Toggl", "toggl", true},
+		{"xlsx", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, ok := getExporter(tt.name)
+			if ok != tt.wantOK || ok && exporter.Name() != tt.want {
+				t.Errorf("getExporter(%q) = %v, %v, want %q", tt.name, exporter, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:Review", "SUMMARY:Review"},
+		{"exactly 75 octets", strings.Repeat("a", 75), strings.Repeat("a", 75)},
+		{"76 octets", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a"},
+		{"multi-byte character on the limit", strings.Repeat("a", 74) + "é", strings.Repeat("a", 74) + "\r\n é"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foldICSLine(tt.line); got != tt.want {
+				t.Errorf("foldICSLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportFileName(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want string
+	}{
+		{"single day", day, day.AddDate(0, 0, 1), "timetick-2024-03-04.csv"},
+		{"week", day, day.AddDate(0, 0, 7), "timetick-2024-03-04-2024-03-10.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportFileName("timetick", tt.from, tt.to, "csv"); got != tt.want {
+				t.Errorf("exportFileName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Creates bot with entries of exportTestEntries stored for user 42
+func newExportTestBot(t *testing.T) *Bot {
+	b := &Bot{db: newTestDatabase(t), cfg: &Config{Timezone: time.UTC}}
+	for _, entry := range exportTestEntries(time.UTC) {
+		if _, err := b.db.conn.Exec(`INSERT INTO entries (user_id, start_time, end_time, note, project, active) VALUES (?, ?, ?, ?, ?, ?)`,
+			entry.UserID, entry.StartTime, entry.EndTime, entry.Note, entry.Project, entry.Active); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestExportEntries(t *testing.T) {
+	b := newExportTestBot(t)
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+
+	file, err := b.exportEntries("42", "Ana", "ics week", now)
+	if err != nil {
+		t.Fatalf("exportEntries() error = %v", err)
+	}
+	if file.Name != "timetick-2024-03-04-2024-03-10.ics" || !strings.HasPrefix(file.Caption, "📤 2 entries") {
+		t.Errorf("exportEntries() = %q, %q", file.Name, file.Caption)
+	}
+	if !bytes.Contains(file.Data, []byte(`SUMMARY:Review "login"\, part 1\; see notes\nand fix`)) {
+		t.Errorf("exportEntries() data does not contain escaped note:\n%s", file.Data)
+	}
+
+	if _, err := b.exportEntries("42", "Ana", "lastweek", now); err == nil || !strings.Contains(err.Error(), "no entries") {
+		t.Errorf("exportEntries() of empty period error = %v, want no entries", err)
+	}
+	if _, err := b.exportEntries("42", "Ana", "fortnight", now); err == nil || !strings.Contains(err.Error(), "Formats: clockify, csv, harvest") {
+		t.Errorf("exportEntries() of unknown period error = %v, want list of formats", err)
+	}
+}
+
+func TestExportEntriesOfEachFormat(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		email  string
+		// text every export must contain, empty when export must fail
+		want string
+	}{
+		{"csv", "", "web, mobile\",ACME,false"},
+		{"jsonl", "", `"client":"ACME"`},
+		{"ics", "", "CATEGORIES:web\\, mobile"},
+		{"toggl", "ana@example.com", "ana@example.com,2024-03-04,09:00:00,01:30:00,\"web, mobile\",ACME"},
+		{"toggl", "", ""},
+		{"clockify", "ana@example.com", "ACME,\"Review"},
+		{"clockify", "", ""},
+		{"harvest", "", "2024-03-04,ACME,\"web, mobile\",General"},
+		{"timewarrior", "", `"web, mobile",`},
+	}
+
+	for _, tt := range tests {
+		name := tt.format
+		if tt.email == "" {
+			name += " without email"
+		}
+		t.Run(name, func(t *testing.T) {
+			b := newExportTestBot(t)
+			if err := b.db.SetProjectClient("web, mobile", "ACME"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.email != "" {
+				if err := b.db.SetUserSetting("42", "email", tt.email); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			file, err := b.exportEntries("42", "Ana Petrović", "week "+tt.format, now)
+			if tt.want == "" {
+				if err == nil || !strings.Contains(err.Error(), "/settings email") {
+					t.Fatalf("exportEntries() error = %v, want hint to set email", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exportEntries() error = %v", err)
+			}
+
+			exporter, _ := getExporter(tt.format)
+			if !strings.HasSuffix(file.Name, "."+exporter.Extension()) {
+				t.Errorf("file name = %q, want extension %s", file.Name, exporter.Extension())
+			}
+			if !strings.Contains(string(file.Data), tt.want) {
+				t.Errorf("export does not contain %q:\n%s", tt.want, file.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	FocusKindFocus = "focus"
+	FocusKindBreak = "break"
+
+	FocusStatusRunning     = "running"
+	FocusStatusCompleted   = "completed"
+	FocusStatusInterrupted = "interrupted"
+
+	// Longest focus session accepted by /focus, in minutes
+	maxFocusMinutes = 240
+)
+
+// Timed focus session or break. Focus sessions track time in a regular
+// entry, breaks are not tracked.
+type FocusSession struct {
+	ID        int64
+	UserID    string
+	ChatID    int64
+	Kind      string
+	EntryID   sql.NullInt64
+	Note      string
+	Duration  time.Duration
+	StartedAt time.Time
+	EndsAt    time.Time
+	Status    string
+}
+
+const (
+	createFocusSessionSQL = `INSERT INTO focus_sessions (user_id, chat_id, kind, entry_id, note, duration, started_at, ends_at, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	focusSessionColumns   = `id, user_id, chat_id, kind, entry_id, note, duration, started_at, ends_at, status`
+	getFocusSessionSQL    = `SELECT ` + focusSessionColumns + ` FROM focus_sessions WHERE id = ?`
+	getDueFocusSessionSQL = `SELECT ` + focusSessionColumns + ` FROM focus_sessions WHERE status = 'running' AND unixepoch(ends_at) <= ?`
+	// status is changed only while running, so a session is completed once
+	updateFocusStatusSQL     = `UPDATE focus_sessions SET status = ? WHERE id = ? AND status = 'running'`
+	interruptFocusSessionSQL = `UPDATE focus_sessions SET status = 'interrupted' WHERE entry_id = ? AND status = 'running'`
+	interruptBreaksSQL       = `UPDATE focus_sessions SET status = 'interrupted' WHERE user_id = ? AND kind = 'break' AND status = 'running'`
+	countFocusSessionsSQL    = `
+  SELECT COALESCE(SUM(status = 'completed'), 0), COALESCE(SUM(status = 'interrupted'), 0) FROM focus_sessions
+  WHERE user_id = ? AND kind = 'focus' AND unixepoch(started_at) >= ? AND unixepoch(started_at) < ?`
+)
+
+// Creates focus session or break
+func (db *Database) CreateFocusSession(session *FocusSession) error {
+	note, err := db.notes.Encrypt(session.Note)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.conn.Exec(createFocusSessionSQL,
+		session.UserID,
+		session.ChatID,
+		session.Kind,
+		session.EntryID,
+		note,
+		int64(session.Duration.Seconds()),
+		session.StartedAt,
+		session.EndsAt,
+		session.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create focus session: %w", err)
+	}
+
+	session.ID, err = res.LastInsertId()
+	return err
+}
+
+// Gets focus session by ID
+func (db *Database) GetFocusSession(id int64) (FocusSession, error) {
+	session, err := scanFocusSession(db.conn.QueryRow(getFocusSessionSQL, id))
+	if err != nil {
+		return FocusSession{}, fmt.Errorf("failed to get focus session %d: %w", id, err)
+	}
+	if session.Note, err = db.notes.Decrypt(session.Note); err != nil {
+		return FocusSession{}, fmt.Errorf("focus session %d: %w", id, err)
+	}
+	return session, nil
+}
+
+// Gets running sessions and breaks that should have ended by now
+func (db *Database) GetDueFocusSessions(now time.Time) ([]FocusSession, error) {
+	rows, err := db.conn.Query(getDueFocusSessionSQL, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due focus sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []FocusSession
+	for rows.Next() {
+		session, err := scanFocusSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan focus session: %w", err)
+		}
+		if session.Note, err = db.notes.Decrypt(session.Note); err != nil {
+			return nil, fmt.Errorf("focus session %d: %w", session.ID, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Changes status of running session. Returns false if session was not running anymore.
+func (db *Database) SetFocusSessionStatus(id int64, status string) (bool, error) {
+	res, err := db.conn.Exec(updateFocusStatusSQL, status, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update focus session %d: %w", id, err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// Ends running break of user, e.g. when they start working again early
+func (db *Database) InterruptBreaks(userID string) error {
+	if _, err := db.conn.Exec(interruptBreaksSQL, userID); err != nil {
+		return fmt.Errorf("failed to end break: %w", err)
+	}
+	return nil
+}
+
+// Counts completed and interrupted focus sessions started in [from, to)
+func (db *Database) CountFocusSessions(userID string, from time.Time, to time.Time) (completed int, interrupted int, err error) {
+	err = db.conn.QueryRow(countFocusSessionsSQL, userID, from.Unix(), to.Unix()).Scan(&completed, &interrupted)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count focus sessions: %w", err)
+	}
+	return completed, interrupted, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFocusSession(row rowScanner) (FocusSession, error) {
+	var session FocusSession
+	var seconds int64
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.ChatID,
+		&session.Kind,
+		&session.EntryID,
+		&session.Note,
+		&seconds,
+		&session.StartedAt,
+		&session.EndsAt,
+		&session.Status,
+	)
+	session.Duration = time.Duration(seconds) * time.Second
+
+	return session, err
+}
+
+// Starts focus session tracked in new entry
+func (b *Bot) startFocus(userID string, chatID int64, duration time.Duration, note string, logger *slog.Logger) (FocusSession, error) {
+	if err := b.db.InterruptBreaks(userID); err != nil {
+		logger.Error("failed to interrupt breaks", "error", err)
+	}
+
+	entry, err := b.db.StartTracking(userID, note, "")
+	if err != nil {
+		return FocusSession{}, err
+	}
+
+	session := FocusSession{
+		UserID:    userID,
+		ChatID:    chatID,
+		Kind:      FocusKindFocus,
+		EntryID:   sql.NullInt64{Int64: entry.ID, Valid: true},
+		Note:      note,
+		Duration:  duration,
+		StartedAt: entry.StartTime,
+		EndsAt:    entry.StartTime.Add(duration),
+		Status:    FocusStatusRunning,
+	}
+	if err := b.db.CreateFocusSession(&session); err != nil {
+		return FocusSession{}, err
+	}
+
+	return session, nil
+}
+
+// Starts focus session.
+//
+// Usage:
+//
+//	/focus [minutes] <note>
+func (b *Bot) handleFocusCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	duration := b.cfg.FocusDuration
+	note := strings.TrimSpace(args)
+
+	// first argument is length of the session if it is a number
+	if fields := strings.Fields(note); len(fields) > 0 {
+		if minutes, err := strconv.Atoi(fields[0]); err == nil {
+			if minutes < 1 || minutes > maxFocusMinutes {
+				b.sendMessage(message.Chat.ID, fmt.Sprintf("Focus session must be between 1 and %d minutes.", maxFocusMinutes), message.MessageID)
+				return
+			}
+			duration = time.Duration(minutes) * time.Minute
+			note = strings.TrimSpace(strings.TrimPrefix(note, fields[0]))
+		}
+	}
+
+	session, err := b.startFocus(userID, message.Chat.ID, duration, note, logger)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	text := fmt.Sprintf("🍅 Focus session started for %s, until %s.", formatDuration(duration), session.EndsAt.Format("15:04"))
+	if note != "" {
+		text += " Note is: " + note
+	}
+	text += "\nUse /stop to end it early."
+	b.sendMessage(message.Chat.ID, text, message.MessageID)
+}
+
+// Finishes focus sessions and breaks which reached their end time.
+// Session state lives in the database, so sessions which ended while
+// the bot was not running are finished on the first check after start.
+func (b *Bot) completeDueFocusSessions(now time.Time) {
+	sessions, err := b.db.GetDueFocusSessions(now)
+	if err != nil {
+		slog.Error("failed to get due focus sessions", "error", err)
+		return
+	}
+
+	for _, session := range sessions {
+		// mark completed first, stopping the entry would interrupt it otherwise
+		completed, err := b.db.SetFocusSessionStatus(session.ID, FocusStatusCompleted)
+		if err != nil {
+			slog.Error("failed to complete focus session", "session_id", session.ID, "error", err)
+			continue
+		}
+		if !completed {
+			continue
+		}
+
+		switch session.Kind {
+		case FocusKindFocus:
+			b.finishFocus(session)
+		case FocusKindBreak:
+			b.finishBreak(session)
+		}
+	}
+}
+
+// Stops entry of completed focus session and offers a break
+func (b *Bot) finishFocus(session FocusSession) {
+	if session.EntryID.Valid {
+		if _, err := b.db.StopEntryAt(ActorSystem, session.UserID, session.EntryID.Int64, session.EndsAt); err != nil {
+			slog.Error("failed to stop entry of focus session", "session_id", session.ID, "error", err)
+		}
+	}
+
+	text := fmt.Sprintf("✅ Focus session of %s is finished.", formatDuration(session.Duration))
+	if session.Note != "" {
+		text += "\nNote: " + session.Note
+	}
+	text += "\nTake a break or continue?"
+
+	minutes := strconv.Itoa(int(session.Duration.Minutes()))
+	id := strconv.FormatInt(session.ID, 10)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("☕ Break "+formatDuration(b.cfg.FocusBreak), "focus:break:"+minutes+":"+id),
+			tgbotapi.NewInlineKeyboardButtonData("▶️ Continue", "focus:start:"+minutes+":"+id),
+		),
+	)
+
+	b.sendMessageWithKeyboard(session.ChatID, text, keyboard)
+}
+
+// Notifies user that break is over
+func (b *Bot) finishBreak(session FocusSession) {
+	minutes := strconv.Itoa(int(b.cfg.FocusDuration.Minutes()))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ Focus again", "focus:start:"+minutes+":"+strconv.FormatInt(session.ID, 10)),
+		),
+	)
+
+	b.sendMessageWithKeyboard(session.ChatID, "☕ Break is over.", keyboard)
+}
+
+// Handles buttons of focus messages.
+//
+// Callback data format:
+//
+//	focus:break:<focus minutes>:<session id>
+//	focus:start:<focus minutes>:<session id>
+func (b *Bot) handleFocusCallback(query *tgbotapi.CallbackQuery, args []string, logger *slog.Logger) {
+	if len(args) != 3 {
+		b.answerCallback(query, "Invalid action.")
+		return
+	}
+
+	minutes, err := strconv.Atoi(args[1])
+	if err != nil || minutes < 1 || minutes > maxFocusMinutes {
+		b.answerCallback(query, "Invalid action.")
+		return
+	}
+	sessionID, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		b.answerCallback(query, "Invalid action.")
+		return
+	}
+
+	userID := strconv.FormatInt(query.From.ID, 10)
+	previous, err := b.db.GetFocusSession(sessionID)
+	if err != nil || previous.UserID != userID {
+		b.answerCallback(query, "This session does not exist anymore.")
+		return
+	}
+
+	var result string
+	switch args[0] {
+	case "break":
+		now := time.Now()
+		session := FocusSession{
+			UserID:    userID,
+			ChatID:    previous.ChatID,
+			Kind:      FocusKindBreak,
+			Note:      previous.Note,
+			Duration:  b.cfg.FocusBreak,
+			StartedAt: now,
+			EndsAt:    now.Add(b.cfg.FocusBreak),
+			Status:    FocusStatusRunning,
+		}
+		if err := b.db.CreateFocusSession(&session); err != nil {
+			b.answerCallback(query, fmt.Sprintf("%s", err))
+			return
+		}
+		result = "☕ Break until " + session.EndsAt.Format("15:04") + "."
+	case "start":
+		session, err := b.startFocus(userID, previous.ChatID, time.Duration(minutes)*time.Minute, previous.Note, logger)
+		if err != nil {
+			b.answerCallback(query, fmt.Sprintf("%s", err))
+			return
+		}
+		result = "🍅 Focus session started until " + session.EndsAt.Format("15:04") + "."
+	default:
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+
+	b.answerCallback(query, "")
+	b.editMessage(query.Message, query.Message.Text+"\n\n"+result)
+}
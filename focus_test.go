@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestFocusSessionLifecycle(t *testing.T) {
+	tests := []struct {
+		name string
+		// runs after session was started, at given time since its start
+		act        func(t *testing.T, db *Database, session FocusSession)
+		at         time.Duration
+		wantDue    bool
+		wantStatus string
+	}{
+		{
+			name:       "running",
+			act:        func(t *testing.T, db *Database, session FocusSession) {},
+			at:         10 * time.Minute,
+			wantStatus: FocusStatusRunning,
+		},
+		{
+			name:       "due",
+			act:        func(t *testing.T, db *Database, session FocusSession) {},
+			at:         25 * time.Minute,
+			wantDue:    true,
+			wantStatus: FocusStatusRunning,
+		},
+		{
+			name: "completed once",
+			act: func(t *testing.T, db *Database, session FocusSession) {
+				for i, want := range []bool{true, false} {
+					completed, err := db.SetFocusSessionStatus(session.ID, FocusStatusCompleted)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if completed != want {
+						t.Errorf("SetFocusSessionStatus() call %d = %v, want %v", i+1, completed, want)
+					}
+				}
+			},
+			at:         25 * time.Minute,
+			wantStatus: FocusStatusCompleted,
+		},
+		{
+			name: "stopped early",
+			act: func(t *testing.T, db *Database, session FocusSession) {
+				if _, err := db.StopTracking(session.UserID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			at:         25 * time.Minute,
+			wantStatus: FocusStatusInterrupted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{db: newTestDatabase(t), cfg: &Config{FocusDuration: 25 * time.Minute}}
+
+			session, err := b.startFocus("1", 42, 25*time.Minute, "write report", slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !session.EntryID.Valid || !session.EndsAt.Equal(session.StartedAt.Add(25*time.Minute)) {
+				t.Fatalf("startFocus() = %+v, want session tracked in entry for 25m", session)
+			}
+			entry, running, err := b.db.getActiveEntry("1")
+			if err != nil || !running || entry.ID != session.EntryID.Int64 || entry.Note != "write report" {
+				t.Fatalf("entry of focus session = %+v, %v, %v", entry, running, err)
+			}
+
+			tt.act(t, b.db, session)
+
+			due, err := b.db.GetDueFocusSessions(session.StartedAt.Add(tt.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(due) == 1) != tt.wantDue {
+				t.Errorf("GetDueFocusSessions() = %d sessions, want due %v", len(due), tt.wantDue)
+			}
+
+			stored, err := b.db.GetFocusSession(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus || stored.ChatID != 42 || stored.Duration != 25*time.Minute {
+				t.Errorf("GetFocusSession() = %+v, want status %s", stored, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFocusEndsBreak(t *testing.T) {
+	b := &Bot{db: newTestDatabase(t), cfg: &Config{}}
+	now := time.Now()
+
+	pause := FocusSession{
+		UserID:    "1",
+		Kind:      FocusKindBreak,
+		Duration:  5 * time.Minute,
+		StartedAt: now,
+		EndsAt:    now.Add(5 * time.Minute),
+		Status:    FocusStatusRunning,
+	}
+	if err := b.db.CreateFocusSession(&pause); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.startFocus("1", 42, 25*time.Minute, "", slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := b.db.GetFocusSession(pause.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != FocusStatusInterrupted {
+		t.Errorf("break status after focus started = %s, want %s", stored.Status, FocusStatusInterrupted)
+	}
+
+	if _, err := b.startFocus("1", 42, 25*time.Minute, "", slog.Default()); err == nil {
+		t.Error("startFocus() while timer runs succeeded, want error")
+	}
+
+	completed, interrupted, err := b.db.CountFocusSessions("1", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed != 0 || interrupted != 0 {
+		t.Errorf("CountFocusSessions() = %d, %d, want breaks not counted", completed, interrupted)
+	}
+}
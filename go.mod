@@ -5,4 +5,5 @@ go 1.24.1
 require (
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/image v0.25.0
 )
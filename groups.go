@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Person who wrote to the bot in a chat, used to show names in group views
+type ChatMember struct {
+	ChatID int64
+	UserID string
+	Name   string
+}
+
+// Running entry of a user together with the user's name
+type ActiveTracker struct {
+	UserID    string
+	Name      string
+	StartTime time.Time
+	Note      string
+	Project   string
+}
+
+const (
+	upsertChatMemberSQL = `
+  INSERT INTO chat_members (chat_id, user_id, name, last_seen) VALUES (?, ?, ?, ?)
+  ON CONFLICT(chat_id, user_id) DO UPDATE SET name = excluded.name, last_seen = excluded.last_seen`
+	getChatDefaultProjectSQL = `SELECT default_project FROM chat_settings WHERE chat_id = ?`
+	upsertChatDefaultProject = `
+  INSERT INTO chat_settings (chat_id, default_project, updated_at) VALUES (?, ?, ?)
+  ON CONFLICT(chat_id) DO UPDATE SET default_project = excluded.default_project, updated_at = excluded.updated_at`
+	getChatTrackersSQL = `
+  SELECT e.user_id, m.name, e.start_time, e.note, e.project FROM entries e
+  JOIN chat_members m ON m.user_id = e.user_id AND m.chat_id = ?
+  WHERE e.active = 1 AND e.deleted_at IS NULL ORDER BY unixepoch(e.start_time)`
+	getAllTrackersSQL = `
+  SELECT e.user_id, COALESCE((SELECT name FROM chat_members m WHERE m.user_id = e.user_id ORDER BY last_seen DESC LIMIT 1), ''),
+  e.start_time, e.note, e.project FROM entries e
+  WHERE e.active = 1 AND e.deleted_at IS NULL ORDER BY unixepoch(e.start_time)`
+)
+
+// Checks if chat is a group where several users talk to the bot
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// Gets display name of Telegram user
+func displayName(user *tgbotapi.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.UserName
+	}
+	return name
+}
+
+// Checks if command is meant for this bot. Commands without @botname
+// are meant for every bot in the chat.
+func (b *Bot) addressedToMe(message *tgbotapi.Message) bool {
+	_, bot, found := strings.Cut(message.CommandWithAt(), "@")
+	return !found || strings.EqualFold(bot, b.api.Self.UserName)
+}
+
+// Checks if command explicitly names this bot with @botname
+func (b *Bot) mentionsMe(message *tgbotapi.Message) bool {
+	return strings.Contains(message.CommandWithAt(), "@") && b.addressedToMe(message)
+}
+
+// Records that user wrote to the bot in chat
+func (db *Database) SaveChatMember(member ChatMember) error {
+	if _, err := db.conn.Exec(upsertChatMemberSQL, member.ChatID, member.UserID, member.Name, time.Now()); err != nil {
+		return fmt.Errorf("failed to save chat member: %w", err)
+	}
+	return nil
+}
+
+// Gets project used for timers started in chat, empty if there is none
+func (db *Database) GetChatDefaultProject(chatID int64) (string, error) {
+	var project string
+	err := db.conn.QueryRow(getChatDefaultProjectSQL, chatID).Scan(&project)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	return project, nil
+}
+
+// Sets project used for timers started in chat, empty project removes it
+func (db *Database) SetChatDefaultProject(chatID int64, project string) error {
+	if _, err := db.conn.Exec(upsertChatDefaultProject, chatID, project, time.Now()); err != nil {
+		return fmt.Errorf("failed to save chat settings: %w", err)
+	}
+	return nil
+}
+
+// Gets running entries of members of chat. Zero chat ID gets running
+// entries of all users.
+func (db *Database) GetActiveTrackers(chatID int64) ([]ActiveTracker, error) {
+	var rows *sql.Rows
+	var err error
+	if chatID != 0 {
+		rows, err = db.conn.Query(getChatTrackersSQL, chatID)
+	} else {
+		rows, err = db.conn.Query(getAllTrackersSQL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running timers: %w", err)
+	}
+	defer rows.Close()
+
+	var trackers []ActiveTracker
+	for rows.Next() {
+		var tracker ActiveTracker
+		if err := rows.Scan(&tracker.UserID, &tracker.Name, &tracker.StartTime, &tracker.Note, &tracker.Project); err != nil {
+			return nil, fmt.Errorf("failed to scan running timer: %w", err)
+		}
+		if tracker.Note, err = db.notes.Decrypt(tracker.Note); err != nil {
+			return nil, err
+		}
+		trackers = append(trackers, tracker)
+	}
+	return trackers, rows.Err()
+}
+
+// Remembers sender of message so group views can show names
+func (b *Bot) rememberMember(message *tgbotapi.Message, logger *slog.Logger) {
+	member := ChatMember{
+		ChatID: message.Chat.ID,
+		UserID: strconv.FormatInt(message.From.ID, 10),
+		Name:   displayName(message.From),
+	}
+	if err := b.db.SaveChatMember(member); err != nil {
+		logger.Error("failed to remember chat member", "error", err)
+	}
+}
+
+// Gets default project of chat, logging failures. Private chats have none.
+func (b *Bot) chatDefaultProject(chat *tgbotapi.Chat, logger *slog.Logger) string {
+	if !isGroupChat(chat) {
+		return ""
+	}
+	project, err := b.db.GetChatDefaultProject(chat.ID)
+	if err != nil {
+		logger.Error("failed to get default project of chat", "error", err)
+	}
+	return project
+}
+
+// Gets running timers user may see in chat. Groups see timers of their
+// members, private chats only the user's own timer.
+func (b *Bot) visibleTrackers(chat *tgbotapi.Chat, userID string) ([]ActiveTracker, error) {
+	if isGroupChat(chat) {
+		return b.db.GetActiveTrackers(chat.ID)
+	}
+
+	trackers, err := b.db.GetActiveTrackers(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var own []ActiveTracker
+	for _, tracker := range trackers {
+		if tracker.UserID == userID {
+			own = append(own, tracker)
+		}
+	}
+	return own, nil
+}
+
+// Shows who is tracking what. In groups only members of the group are listed,
+// in private chat only own timer.
+//
+// Usage:
+//
+//	/who
+func (b *Bot) handleWhoCommand(message *tgbotapi.Message, userID string) {
+	trackers, err := b.visibleTrackers(message.Chat, userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if len(trackers) == 0 {
+		b.sendMessage(message.Chat.ID, "Nobody is tracking time right now.", message.MessageID)
+		return
+	}
+
+	now := time.Now()
+	lines := []string{"👀 Tracking now:"}
+	for _, tracker := range trackers {
+		name := tracker.Name
+		if name == "" {
+			name = tracker.UserID
+		}
+
+		line := fmt.Sprintf("• %s: %s", name, formatDuration(now.Sub(tracker.StartTime)))
+		if tracker.Note != "" {
+			line += " " + tracker.Note
+		}
+		if tracker.Project != "" {
+			line += " [" + tracker.Project + "]"
+		}
+		lines = append(lines, line)
+	}
+
+	b.sendMessage(message.Chat.ID, strings.Join(lines, "\n"), message.MessageID)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// How long readiness checks may take before they count as failed
+const readyCheckTimeout = 2 * time.Second
+
+// HTTP client of Telegram API recording when Telegram last answered, so
+// readiness can tell whether polling still works
+type telegramClient struct {
+	client       *http.Client
+	lastResponse atomic.Int64
+}
+
+func (c *telegramClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err == nil {
+		c.lastResponse.Store(time.Now().UnixNano())
+	}
+	return resp, err
+}
+
+// Gets time of the last response of Telegram, zero if there was none
+func (c *telegramClient) LastResponse() time.Time {
+	nanos := c.lastResponse.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Result of one readiness check
+type ReadyCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type MigrationCheck struct {
+	ReadyCheck
+	Version  int `json:"version"`
+	Expected int `json:"expected"`
+}
+
+type TelegramCheck struct {
+	ReadyCheck
+	LastResponse *time.Time `json:"last_response,omitempty"`
+}
+
+type ReadyReport struct {
+	Database   ReadyCheck     `json:"database"`
+	Migrations MigrationCheck `json:"migrations"`
+	Telegram   TelegramCheck  `json:"telegram"`
+}
+
+func (r ReadyReport) Ready() bool {
+	return r.Database.OK && r.Migrations.OK && r.Telegram.OK
+}
+
+// Checks database connection, schema version and that Telegram answered
+// recently enough
+func (a *App) CheckReady(ctx context.Context, now time.Time) ReadyReport {
+	var report ReadyReport
+
+	if err := a.db.conn.PingContext(ctx); err != nil {
+		report.Database.Error = err.Error()
+	} else {
+		report.Database.OK = true
+	}
+
+	report.Migrations.Expected = len(migrations)
+	version, err := a.db.SchemaVersion()
+	if err != nil {
+		report.Migrations.Error = err.Error()
+	} else {
+		report.Migrations.Version = version
+		report.Migrations.OK = version == len(migrations)
+		if !report.Migrations.OK {
+			report.Migrations.Error = "schema version does not match this build"
+		}
+	}
+
+	last := a.bot.telegram.LastResponse()
+	switch {
+	case last.IsZero():
+		report.Telegram.Error = "no response from Telegram yet"
+	case now.Sub(last) > a.cfg.ReadyTelegramMaxAge:
+		report.Telegram.LastResponse = &last
+		report.Telegram.Error = "no response from Telegram since " + last.UTC().Format(time.RFC3339)
+	default:
+		report.Telegram.LastResponse = &last
+		report.Telegram.OK = true
+	}
+
+	return report
+}
+
+// Tells that the process is alive, without checking its dependencies
+func (h *APIHandler) getHealth(w http.ResponseWriter, r *http.Request) {
+	RespondWithMessage(w, http.StatusOK, "ok", true)
+}
+
+// Tells whether the bot can serve requests, with result of every check
+func (h *APIHandler) getReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	report := h.app.CheckReady(ctx, time.Now())
+	if report.Ready() {
+		RespondWithJSON(w, http.StatusOK, report)
+		return
+	}
+
+	requestLogger(r.Context()).Warn("not ready", "report", report)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Code:    NOT_READY,
+		Message: "Not ready.",
+		Data:    report,
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Envelope of /healthz and /readyz responses
+type healthResponse struct {
+	Success bool         `json:"success"`
+	Code    ErrorCode    `json:"code"`
+	Message string       `json:"message"`
+	Data    *ReadyReport `json:"data"`
+}
+
+// Creates API routes of app whose bot never talked to Telegram
+func newHealthTestApp(t *testing.T) (*App, http.Handler) {
+	t.Helper()
+	db := newTestDatabase(t)
+	app := &App{
+		cfg: &Config{ReadyTelegramMaxAge: 3 * time.Minute},
+		db:  db,
+		bot: &Bot{metrics: NewMetrics(), telegram: &telegramClient{client: http.DefaultClient}},
+	}
+	return app, SetupRoutes(app, db)
+}
+
+func getHealth(t *testing.T, routes http.Handler, path string) (int, healthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var resp healthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealthz(t *testing.T) {
+	app, routes := newHealthTestApp(t)
+	// liveness does not depend on the database
+	app.db.conn.Close()
+
+	status, resp := getHealth(t, routes, "/healthz")
+	if status != http.StatusOK || !resp.Success || resp.Message != "ok" || resp.Code != "" || resp.Data != nil {
+		t.Errorf("/healthz = %d %+v, want 200 with success and message ok", status, resp)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		prepare    func(t *testing.T, app *App)
+		wantStatus int
+		wantChecks [3]bool
+	}{
+		{"ready", func(t *testing.T, app *App) {
+			app.bot.telegram.lastResponse.Store(time.Now().UnixNano())
+		}, http.StatusOK, [3]bool{true, true, true}},
+		{"no response from Telegram", func(t *testing.T, app *App) {
+		}, http.StatusServiceUnavailable, [3]bool{true, true, false}},
+		{"stale response from Telegram", func(t *testing.T, app *App) {
+			app.bot.telegram.lastResponse.Store(time.Now().Add(-time.Hour).UnixNano())
+		}, http.StatusServiceUnavailable, [3]bool{true, true, false}},
+		{"schema of other build", func(t *testing.T, app *App) {
+			app.bot.telegram.lastResponse.Store(time.Now().UnixNano())
+			if _, err := app.db.conn.Exec(`PRAGMA user_version = 1`); err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusServiceUnavailable, [3]bool{true, false, true}},
+		{"database closed", func(t *testing.T, app *App) {
+			app.bot.telegram.lastResponse.Store(time.Now().UnixNano())
+			app.db.conn.Close()
+		}, http.StatusServiceUnavailable, [3]bool{false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, routes := newHealthTestApp(t)
+			tt.prepare(t, app)
+
+			status, resp := getHealth(t, routes, "/readyz")
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if resp.Data == nil {
+				t.Fatalf("response %+v has no checks", resp)
+			}
+
+			ready := tt.wantStatus == http.StatusOK
+			if resp.Success != ready {
+				t.Errorf("success = %v, want %v", resp.Success, ready)
+			}
+			if ready && (resp.Code != "" || resp.Message != "") {
+				t.Errorf("ready response has code %q and message %q", resp.Code, resp.Message)
+			}
+			if !ready && (resp.Code != NOT_READY || resp.Message != "Not ready.") {
+				t.Errorf("code = %q, message = %q, want NOT_READY", resp.Code, resp.Message)
+			}
+
+			checks := []ReadyCheck{resp.Data.Database, resp.Data.Migrations.ReadyCheck, resp.Data.Telegram.ReadyCheck}
+			for i, check := range checks {
+				if check.OK != tt.wantChecks[i] || check.OK != (check.Error == "") {
+					t.Errorf("check %d = %+v, want ok %v with error only when failed", i, check, tt.wantChecks[i])
+				}
+			}
+			if resp.Data.Migrations.Expected != len(migrations) {
+				t.Errorf("expected schema version = %d, want %d", resp.Data.Migrations.Expected, len(migrations))
+			}
+		})
+	}
+}
+
+func TestTelegramClientRecordsResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := &telegramClient{client: server.Client()}
+	if !client.LastResponse().IsZero() {
+		t.Fatal("LastResponse() before any call is not zero")
+	}
+
+	// any answer counts, also an error status, while failed calls do not
+	before := time.Now()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	last := client.LastResponse()
+	if last.Before(before) {
+		t.Fatalf("LastResponse() = %v, want after %v", last, before)
+	}
+
+	server.Close()
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() to closed server succeeded")
+	}
+	if !client.LastResponse().Equal(last) {
+		t.Errorf("failed call changed LastResponse() to %v", client.LastResponse())
+	}
+}
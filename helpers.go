@@ -6,9 +6,10 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Converts comma-separated string into slice of integers.
@@ -27,7 +28,7 @@ func convertStringToIntArray(arrString string) []int64 {
 
 		intValue, err := strconv.ParseInt(trimmed, 10, 64)
 		if err != nil {
-			log.Printf("Skipping invalid integer: %q - %v", trimmed, err)
+			slog.Warn("skipping invalid integer", "value", trimmed, "error", err)
 			continue
 		}
 
@@ -59,3 +60,68 @@ func Hash(input string) string {
 	hasher.Write([]byte(input))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// Formats duration as hours and minutes.
+//
+// Example:
+//
+//	Input: 2h5m30s
+//	Output: 2h 05m
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %02dm", hours, minutes)
+}
+
+// Parses time of day in HH:MM format and returns offset from midnight
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time, use HH:MM format", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Formats offset from midnight as HH:MM
+func formatClock(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// Parses English weekday name or its three letter abbreviation
+func parseWeekday(value string) (time.Weekday, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if value == name || value == name[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a weekday", value)
+}
+
+// Gets midnight of the day containing t, in t's location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// Gets midnight of Monday of the week containing t, in t's location
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+// Checks if slice contains given string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Largest file accepted by /import
+const maxImportFileSize = 5 << 20
+
+// Group of entries added by one import, rolled back as a whole.
+type ImportBatch struct {
+	ID           string
+	UserID       string
+	Format       string
+	Source       string
+	EntryCount   int
+	CreatedAt    time.Time
+	RolledBackAt sql.NullTime
+}
+
+// Result of comparing imported entries with entries already in database.
+type ImportPlan struct {
+	New        []ImportedEntry
+	Duplicates []ImportedEntry
+	Overlaps   []ImportedEntry
+	Invalid    []ImportedEntry
+}
+
+const (
+	createImportBatchSQL     = `INSERT INTO import_batches (id, user_id, format, source, entry_count, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	createImportedEntrySQL   = `INSERT INTO entries (user_id, start_time, end_time, note, project, active, import_batch) VALUES (?, ?, ?, ?, ?, 0, ?)`
+	getImportBatchSQL        = `SELECT id, user_id, format, source, entry_count, created_at, rolled_back_at FROM import_batches WHERE id = ?`
+	getImportBatchesSQL      = `SELECT id, user_id, format, source, entry_count, created_at, rolled_back_at FROM import_batches WHERE ? = '' OR user_id = ? ORDER BY created_at DESC`
+	deleteImportedEntriesSQL = `UPDATE entries SET deleted_at = ? WHERE import_batch = ? AND deleted_at IS NULL`
+	rollbackImportBatchSQL   = `UPDATE import_batches SET rolled_back_at = ? WHERE id = ? AND rolled_back_at IS NULL`
+)
+
+// Builds import plan, sorting out entries that are invalid, already exist or
+// overlap entries of the user. Overlapping entries are imported only when allowed.
+func (db *Database) PlanImport(userID string, items []ImportedEntry, allowOverlaps bool, now time.Time) (ImportPlan, error) {
+	var plan ImportPlan
+	if len(items) == 0 {
+		return plan, nil
+	}
+
+	sorted := append([]ImportedEntry{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	// entries started up to a day earlier can still reach into the imported range
+	from := sorted[0].Start.AddDate(0, 0, -1)
+	to := sorted[0].End
+	for _, item := range sorted {
+		if item.End.After(to) {
+			to = item.End
+		}
+	}
+	existing, err := db.GetEntriesBetween(userID, from, to)
+	if err != nil {
+		return plan, err
+	}
+
+	var accepted []ImportedEntry
+	for _, e := range existing {
+		accepted = append(accepted, ImportedEntry{Start: e.StartTime, End: e.StartTime.Add(e.Duration(now)), Note: e.Note, Project: e.Project})
+	}
+
+	for _, item := range sorted {
+		if !item.End.After(item.Start) {
+			plan.Invalid = append(plan.Invalid, item)
+			continue
+		}
+
+		duplicate, overlap := false, false
+		for _, other := range accepted {
+			if sameSecond(item.Start, other.Start) && sameSecond(item.End, other.End) {
+				duplicate = true
+				break
+			}
+			if item.Start.Before(other.End) && other.Start.Before(item.End) {
+				overlap = true
+			}
+		}
+
+		switch {
+		case duplicate:
+			plan.Duplicates = append(plan.Duplicates, item)
+		case overlap && !allowOverlaps:
+			plan.Overlaps = append(plan.Overlaps, item)
+		default:
+			plan.New = append(plan.New, item)
+			accepted = append(accepted, item)
+		}
+	}
+
+	return plan, nil
+}
+
+// Compares times at second precision, which is what the export formats keep
+func sameSecond(a time.Time, b time.Time) bool {
+	return a.Unix() == b.Unix()
+}
+
+// Describes import plan as a diff, listing at most limit entries per group
+func (p ImportPlan) Summary(loc *time.Location, limit int) string {
+	lines := []string{fmt.Sprintf("%d new, %d duplicates, %d overlapping, %d invalid",
+		len(p.New), len(p.Duplicates), len(p.Overlaps), len(p.Invalid))}
+
+	groups := []struct {
+		mark    string
+		entries []ImportedEntry
+	}{
+		{"+", p.New},
+		{"=", p.Duplicates},
+		{"!", p.Overlaps},
+		{"?", p.Invalid},
+	}
+	for _, group := range groups {
+		for i, entry := range group.entries {
+			if i == limit {
+				lines = append(lines, fmt.Sprintf("%s ... and %d more", group.mark, len(group.entries)-limit))
+				break
+			}
+			lines = append(lines, group.mark+" "+describeImportedEntry(entry, loc))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Formats imported entry as a single line, e.g. 2024-01-02 09:00-12:00 (3h 00m) note [project]
+func describeImportedEntry(entry ImportedEntry, loc *time.Location) string {
+	start := entry.Start.In(loc)
+	line := fmt.Sprintf("%s %s-%s (%s)", start.Format(time.DateOnly), start.Format("15:04"),
+		entry.End.In(loc).Format("15:04"), formatDuration(entry.End.Sub(entry.Start)))
+	if entry.Note != "" {
+		line += " " + entry.Note
+	}
+	if entry.Project != "" {
+		line += " [" + entry.Project + "]"
+	}
+	return line
+}
+
+// Generates random identifier of import batch
+func generateBatchID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate batch ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Adds entries of the user as one import batch. Returns the created batch.
+func (db *Database) ImportEntries(actor string, userID string, format string, source string, entries []ImportedEntry) (ImportBatch, error) {
+	id, err := generateBatchID()
+	if err != nil {
+		return ImportBatch{}, err
+	}
+	batch := ImportBatch{ID: id, UserID: userID, Format: format, Source: source, EntryCount: len(entries), CreatedAt: time.Now()}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return batch, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(createImportBatchSQL, batch.ID, userID, format, source, batch.EntryCount, batch.CreatedAt); err != nil {
+		return batch, fmt.Errorf("failed to create import batch: %w", err)
+	}
+	for _, entry := range entries {
+		if err := checkUnlocked(tx, lockedAtSQL, userID, entry.Start, entry.Start); err != nil {
+			return batch, fmt.Errorf("entry starting %s: %w", entry.Start.Format("2006-01-02 15:04"), err)
+		}
+		note, err := db.notes.Encrypt(entry.Note)
+		if err != nil {
+			return batch, err
+		}
+		res, err := tx.Exec(createImportedEntrySQL, userID, entry.Start, entry.End, note, entry.Project, batch.ID)
+		if err != nil {
+			return batch, fmt.Errorf("failed to import entry: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return batch, fmt.Errorf("failed to import entry: %w", err)
+		}
+
+		created, err := getEntryByID(tx, id)
+		if err != nil {
+			return batch, err
+		}
+		if err := writeAudit(tx, actor, "import", AuditEntry, id, nil, created); err != nil {
+			return batch, err
+		}
+	}
+
+	if err := writeAudit(tx, actor, "import", AuditImport, batch.ID, nil, batch); err != nil {
+		return batch, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return batch, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return batch, nil
+}
+
+// Gets import batch by ID, returns nil if there is none
+func (db *Database) GetImportBatch(id string) (*ImportBatch, error) {
+	batch, err := scanImportBatch(db.conn.QueryRow(getImportBatchSQL, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import batch: %w", err)
+	}
+	return &batch, nil
+}
+
+// Gets import batches of the user, newest first. Empty user ID gets batches of all users.
+func (db *Database) GetImportBatches(userID string) ([]ImportBatch, error) {
+	rows, err := db.conn.Query(getImportBatchesSQL, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []ImportBatch
+	for rows.Next() {
+		batch, err := scanImportBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, rows.Err()
+}
+
+func scanImportBatch(row rowScanner) (ImportBatch, error) {
+	var batch ImportBatch
+	err := row.Scan(&batch.ID, &batch.UserID, &batch.Format, &batch.Source, &batch.EntryCount, &batch.CreatedAt, &batch.RolledBackAt)
+	return batch, err
+}
+
+// Deletes entries added by import batch, they are purged with other deleted
+// entries after retention period. Returns number of deleted entries.
+func (db *Database) RollbackImport(actor string, id string) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin rollback: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(rollbackImportBatchSQL, time.Now(), id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll back import %s: %w", id, err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return 0, fmt.Errorf("import %s does not exist or was already rolled back", id)
+	}
+
+	if err := checkUnlocked(tx, lockedImportBatchSQL, id); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(getBatchEntriesSQL, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get imported entries: %w", err)
+	}
+	entries, err := scanEntries(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = tx.Exec(deleteImportedEntriesSQL, time.Now(), id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete imported entries: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+
+	for _, entry := range entries {
+		if err := writeAudit(tx, actor, "rollback", AuditEntry, entry.ID, entry, nil); err != nil {
+			return 0, err
+		}
+	}
+	if err := writeAudit(tx, actor, "rollback", AuditImport, id, nil, map[string]any{"deleted": deleted}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit rollback: %w", err)
+	}
+	return deleted, nil
+}
+
+// Describes import batch as a single line
+func (batch ImportBatch) String() string {
+	line := fmt.Sprintf("%s  %s  %s  %d entries", batch.ID, batch.CreatedAt.Format("2006-01-02 15:04"), batch.Format, batch.EntryCount)
+	if batch.Source != "" {
+		line += "  " + batch.Source
+	}
+	if batch.RolledBackAt.Valid {
+		line += "  (rolled back)"
+	}
+	return line
+}
+
+// Parses import file, detecting its format when format is empty
+func parseImport(format string, name string, data []byte, loc *time.Location) (Importer, []ImportedEntry, error) {
+	var importer Importer
+	if format == "" || format == "auto" {
+		var err error
+		if importer, err = detectImportFormat(name, data); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var ok bool
+		if importer, ok = getImporter(format); !ok {
+			return nil, nil, fmt.Errorf("unknown import format %q, use one of: %s", format, strings.Join(importerNames(), ", "))
+		}
+	}
+
+	entries, err := importer.Parse(bytes.NewReader(data), loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s file: %w", importer.Name(), err)
+	}
+	return importer, entries, nil
+}
+
+// Downloads file sent to the bot, refusing files larger than limit
+func (b *Bot) downloadFile(fileID string, limit int64) ([]byte, error) {
+	url, err := b.api.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is larger than %d MB", limit>>20)
+	}
+	return data, nil
+}
+
+// Imports entries from a file sent after the command.
+//
+// Usage:
+//
+//	/import [format]
+//	/import list
+//	/import rollback <batch>
+func (b *Bot) handleImportCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	fields := strings.Fields(args)
+
+	switch {
+	case len(fields) == 0:
+		b.beginConversation(message, StateAwaitingImportFile, ConversationData{}, importPrompt, logger)
+	case len(fields) == 1 && strings.ToLower(fields[0]) == "list":
+		b.sendMessage(message.Chat.ID, b.describeImports(userID), message.MessageID)
+	case len(fields) == 2 && strings.ToLower(fields[0]) == "rollback":
+		batch, err := b.db.GetImportBatch(fields[1])
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if batch == nil || batch.UserID != userID {
+			b.sendMessage(message.Chat.ID, "Import "+fields[1]+" was not found. Use /import list to see your imports.", message.MessageID)
+			return
+		}
+
+		deleted, err := b.db.RollbackImport(userActor(userID), batch.ID)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("↩️ Import %s rolled back, %d entries removed.", batch.ID, deleted), message.MessageID)
+	case len(fields) == 1:
+		if _, ok := getImporter(fields[0]); !ok {
+			b.sendMessage(message.Chat.ID, importUsage, message.MessageID)
+			return
+		}
+		b.beginConversation(message, StateAwaitingImportFile, ConversationData{ImportFormat: fields[0]}, importPrompt, logger)
+	default:
+		b.sendMessage(message.Chat.ID, importUsage, message.MessageID)
+	}
+}
+
+const importPrompt = "📥 Send me the file to import as a document. CSV exported by this bot, Toggl CSV and Timewarrior JSON are supported."
+
+const importUsage = "Usage:\n" +
+	"/import [format] - Imports entries from a file (csv, toggl, timewarrior)\n" +
+	"/import list - Lists your imports\n" +
+	"/import rollback <id> - Removes entries added by an import"
+
+// Lists imports of the user
+func (b *Bot) describeImports(userID string) string {
+	batches, err := b.db.GetImportBatches(userID)
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	if len(batches) == 0 {
+		return "You have not imported any entries yet.\n\n" + importUsage
+	}
+
+	lines := []string{"📥 Imports:"}
+	for _, batch := range batches {
+		lines = append(lines, "• "+batch.String())
+	}
+	return strings.Join(lines, "\n") + "\n\n" + importUsage
+}
+
+// Reads and plans import of file referenced by the conversation
+func (b *Bot) planImportFile(conv *Conversation) (Importer, ImportPlan, *time.Location, error) {
+	settings, err := b.db.GetUserSettings(conv.UserID)
+	if err != nil {
+		return nil, ImportPlan{}, nil, err
+	}
+	loc := settings.Location(b.cfg.Timezone)
+
+	data, err := b.downloadFile(conv.Data.ImportFileID, maxImportFileSize)
+	if err != nil {
+		return nil, ImportPlan{}, nil, err
+	}
+
+	importer, entries, err := parseImport(conv.Data.ImportFormat, conv.Data.ImportFileName, data, loc)
+	if err != nil {
+		return nil, ImportPlan{}, nil, err
+	}
+
+	plan, err := b.db.PlanImport(conv.UserID, entries, false, time.Now())
+	return importer, plan, loc, err
+}
+
+func stepAwaitingImportFile(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	if message.Document == nil {
+		return StateAwaitingImportFile, "Please send the file as a document, or use /cancel."
+	}
+	if message.Document.FileSize > maxImportFileSize {
+		return "", fmt.Sprintf("File is larger than %d MB.", maxImportFileSize>>20)
+	}
+
+	conv.Data.ImportFileID = message.Document.FileID
+	conv.Data.ImportFileName = message.Document.FileName
+
+	importer, plan, loc, err := b.planImportFile(conv)
+	if err != nil {
+		return "", fmt.Sprintf("%s", err)
+	}
+	// confirmation must read the file the same way
+	conv.Data.ImportFormat = importer.Name()
+
+	summary := fmt.Sprintf("📥 %s (%s)\n%s", conv.Data.ImportFileName, importer.Name(), plan.Summary(loc, 10))
+	if len(plan.New) == 0 {
+		return "", summary + "\n\nThere is nothing to import."
+	}
+
+	return StateAwaitingImportConfirm, fmt.Sprintf("%s\n\nImport %d new entries? Reply 'yes' or 'no'.", summary, len(plan.New))
+}
+
+func stepAwaitingImportConfirm(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	switch strings.ToLower(strings.TrimSpace(message.Text)) {
+	case "yes", "y":
+		// entries may have changed since the preview, so the plan is built again
+		importer, plan, _, err := b.planImportFile(conv)
+		if err != nil {
+			return "", fmt.Sprintf("%s", err)
+		}
+		if len(plan.New) == 0 {
+			return "", "There is nothing to import."
+		}
+
+		batch, err := b.db.ImportEntries(userActor(conv.UserID), conv.UserID, importer.Name(), conv.Data.ImportFileName, plan.New)
+		if err != nil {
+			return "", fmt.Sprintf("%s", err)
+		}
+		return "", fmt.Sprintf("📥 Imported %d entries as %s.\nUse /import rollback %s to undo.", batch.EntryCount, batch.ID, batch.ID)
+	case "no", "n":
+		return "", "Nothing was imported."
+	default:
+		return StateAwaitingImportConfirm, "Please reply 'yes' or 'no', or use /cancel."
+	}
+}
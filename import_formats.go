@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Single time record read from an import file.
+type ImportedEntry struct {
+	Start   time.Time
+	End     time.Time
+	Note    string
+	Project string
+}
+
+// Reads entries from file format of this or another time tracking tool.
+type Importer interface {
+	Name() string
+	// Parses entries, times without zone are read in given location
+	Parse(r io.Reader, loc *time.Location) ([]ImportedEntry, error)
+}
+
+var importers = make(map[string]Importer)
+
+func registerImporter(importer Importer) {
+	importers[importer.Name()] = importer
+}
+
+func init() {
+	registerImporter(csvImporter{})
+	registerImporter(togglImporter{})
+	registerImporter(timewarriorImporter{})
+}
+
+// Gets importer by name, accepting the same aliases as exporters
+func getImporter(name string) (Importer, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := exporterAliases[name]; ok {
+		name = alias
+	}
+
+	importer, ok := importers[name]
+	return importer, ok
+}
+
+// Gets sorted names of available import formats
+func importerNames() []string {
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Guesses import format from file name and content
+func detectImportFormat(name string, data []byte) (Importer, error) {
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(name), ".json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		return importers["timewarrior"], nil
+	}
+
+	header, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	columns := strings.ToLower(string(header))
+	switch {
+	case strings.Contains(columns, "start_time"):
+		return importers["csv"], nil
+	case strings.Contains(columns, "start date"):
+		return importers["toggl"], nil
+	}
+
+	return nil, fmt.Errorf("could not detect format of %s, supported formats: %s", name, strings.Join(importerNames(), ", "))
+}
+
+// Reads CSV file into rows keyed by lowercased header names
+func readCSVRecords(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i, column := range header {
+		// strip UTF-8 BOM written by spreadsheet applications
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+	}
+
+	var records []map[string]string
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV line %d: %w", line, err)
+		}
+
+		record := make(map[string]string, len(header))
+		for i, value := range row {
+			if i < len(header) {
+				record[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// CSV produced by the csv exporter.
+type csvImporter struct{}
+
+func (csvImporter) Name() string { return "csv" }
+
+func (csvImporter) Parse(r io.Reader, loc *time.Location) ([]ImportedEntry, error) {
+	records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ImportedEntry
+	for i, record := range records {
+		// running entries can not be imported
+		if record["end_time"] == "" {
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, record["start_time"])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start_time: %w", i+2, err)
+		}
+		end, err := time.Parse(time.RFC3339, record["end_time"])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid end_time: %w", i+2, err)
+		}
+
+		entries = append(entries, ImportedEntry{Start: start, End: end, Note: record["note"], Project: record["project"]})
+	}
+
+	return entries, nil
+}
+
+// Toggl Track CSV, either detailed report export or import template.
+type togglImporter struct{}
+
+func (togglImporter) Name() string { return "toggl" }
+
+func (togglImporter) Parse(r io.Reader, loc *time.Location) ([]ImportedEntry, error) {
+	records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ImportedEntry
+	for i, record := range records {
+		line := i + 2
+
+		start, err := time.ParseInLocation(time.DateTime, record["start date"]+" "+record["start time"], loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start: %w", line, err)
+		}
+
+		var end time.Time
+		if record["end date"] != "" && record["end time"] != "" {
+			if end, err = time.ParseInLocation(time.DateTime, record["end date"]+" "+record["end time"], loc); err != nil {
+				return nil, fmt.Errorf("line %d: invalid end: %w", line, err)
+			}
+		} else {
+			duration, err := parseHMS(record["duration"])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid duration: %w", line, err)
+			}
+			end = start.Add(duration)
+		}
+
+		entries = append(entries, ImportedEntry{Start: start, End: end, Note: record["description"], Project: record["project"]})
+	}
+
+	return entries, nil
+}
+
+// Parses duration in HH:MM:SS format
+func parseHMS(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%q is not in HH:MM:SS format", value)
+	}
+
+	var total time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not in HH:MM:SS format", value)
+		}
+		total += time.Duration(n) * units[i]
+	}
+	return total, nil
+}
+
+// Timewarrior JSON as produced by "timew export". First tag is used as project.
+type timewarriorImporter struct{}
+
+func (timewarriorImporter) Name() string { return "timewarrior" }
+
+func (timewarriorImporter) Parse(r io.Reader, loc *time.Location) ([]ImportedEntry, error) {
+	const stamp = "20060102T150405Z"
+
+	var intervals []struct {
+		Start      string   `json:"start"`
+		End        string   `json:"end"`
+		Tags       []string `json:"tags"`
+		Annotation string   `json:"annotation"`
+	}
+	if err := json.NewDecoder(r).Decode(&intervals); err != nil {
+		return nil, fmt.Errorf("failed to read Timewarrior JSON: %w", err)
+	}
+
+	var entries []ImportedEntry
+	for i, interval := range intervals {
+		// open interval is still being tracked in Timewarrior
+		if interval.End == "" {
+			continue
+		}
+
+		start, err := time.Parse(stamp, interval.Start)
+		if err != nil {
+			return nil, fmt.Errorf("interval %d: invalid start: %w", i+1, err)
+		}
+		end, err := time.Parse(stamp, interval.End)
+		if err != nil {
+			return nil, fmt.Errorf("interval %d: invalid end: %w", i+1, err)
+		}
+
+		entry := ImportedEntry{Start: start, End: end, Note: interval.Annotation}
+		if len(interval.Tags) > 0 {
+			entry.Project = interval.Tags[0]
+			// without annotation the remaining tags describe the work best
+			if entry.Note == "" && len(interval.Tags) > 1 {
+				entry.Note = strings.Join(interval.Tags[1:], " ")
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
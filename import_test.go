@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanImport(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(hour float64) time.Time { return day.Add(time.Duration(hour * float64(time.Hour))) }
+	item := func(from, to float64) ImportedEntry { return ImportedEntry{Start: at(from), End: at(to)} }
+
+	tests := []struct {
+		name          string
+		items         []ImportedEntry
+		allowOverlaps bool
+		// numbers of new, duplicate, overlapping and invalid entries
+		want [4]int
+	}{
+		{"nothing", nil, false, [4]int{}},
+		{"new", []ImportedEntry{item(13, 14), item(14, 15)}, false, [4]int{2, 0, 0, 0}},
+		{"duplicate of stored", []ImportedEntry{item(9, 11)}, false, [4]int{0, 1, 0, 0}},
+		{"duplicate within file", []ImportedEntry{item(13, 14), item(13, 14)}, false, [4]int{1, 1, 0, 0}},
+		{"overlaps stored", []ImportedEntry{item(10, 12)}, false, [4]int{0, 0, 1, 0}},
+		{"overlaps within file", []ImportedEntry{item(13, 15), item(14, 16)}, false, [4]int{1, 0, 1, 0}},
+		{"overlaps allowed", []ImportedEntry{item(10, 12), item(13, 15), item(14, 16)}, true, [4]int{3, 0, 0, 0}},
+		{"touching stored", []ImportedEntry{item(8, 9), item(11, 12)}, false, [4]int{2, 0, 0, 0}},
+		{"overlaps entry of previous day", []ImportedEntry{item(0, 1)}, false, [4]int{0, 0, 1, 0}},
+		{"ends before start", []ImportedEntry{item(15, 14), item(15, 15)}, false, [4]int{0, 0, 0, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			if _, err := db.ImportEntries(userActor("1"), "1", "csv", "stored", []ImportedEntry{item(9, 11), item(-2, 0.5)}); err != nil {
+				t.Fatal(err)
+			}
+			// entries of other users never collide
+			if _, err := db.ImportEntries(userActor("2"), "2", "csv", "other", []ImportedEntry{item(13, 14)}); err != nil {
+				t.Fatal(err)
+			}
+
+			plan, err := db.PlanImport("1", tt.items, tt.allowOverlaps, at(24))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [4]int{len(plan.New), len(plan.Duplicates), len(plan.Overlaps), len(plan.Invalid)}
+			if got != tt.want {
+				t.Errorf("PlanImport() = %v, want %v\n%s", got, tt.want, plan.Summary(time.UTC, 10))
+			}
+		})
+	}
+}
+
+func TestImportSummary(t *testing.T) {
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	plan := ImportPlan{
+		New: []ImportedEntry{
+			{Start: start, End: start.Add(90 * time.Minute), Note: "review", Project: "web"},
+			{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)},
+			{Start: start.Add(4 * time.Hour), End: start.Add(5 * time.Hour)},
+		},
+		Invalid: []ImportedEntry{{Start: start, End: start}},
+	}
+
+	want := "3 new, 0 duplicates, 0 overlapping, 1 invalid\n" +
+		"+ 2024-03-04 09:00-10:30 (1h 30m) review [web]\n" +
+		"+ 2024-03-04 11:00-12:00 (1h 00m)\n" +
+		"+ ... and 1 more\n" +
+		"? 2024-03-04 09:00-09:00 (0m)"
+	if got := plan.Summary(time.UTC, 2); got != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestImportRollback(t *testing.T) {
+	db := newTestDatabase(t)
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+
+	if _, err := db.conn.Exec(createEntrySQL, "1", start.Add(-time.Hour), "tracked", ""); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := db.ImportEntries(userActor("1"), "1", "toggl", "toggl.csv", []ImportedEntry{
+		{Start: start, End: start.Add(time.Hour), Note: "first"},
+		{Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Note: "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.EntryCount != 2 || batch.UserID != "1" {
+		t.Errorf("ImportEntries() = %+v", batch)
+	}
+
+	countEntries := func() int {
+		var count int
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM entries WHERE user_id = '1' AND deleted_at IS NULL`).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	if got := countEntries(); got != 3 {
+		t.Fatalf("entries after import = %d, want 3", got)
+	}
+
+	deleted, err := db.RollbackImport(userActor("1"), batch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || countEntries() != 1 {
+		t.Errorf("RollbackImport() deleted %d, %d entries left, want 2 deleted and tracked entry kept", deleted, countEntries())
+	}
+
+	stored, err := db.GetImportBatch(batch.ID)
+	if err != nil || stored == nil || !stored.RolledBackAt.Valid {
+		t.Errorf("GetImportBatch() after rollback = %+v, %v", stored, err)
+	}
+	if _, err := db.RollbackImport(userActor("1"), batch.ID); err == nil {
+		t.Error("second RollbackImport() succeeded, want error")
+	}
+	if _, err := db.RollbackImport(userActor("1"), "missing"); err == nil {
+		t.Error("RollbackImport() of unknown batch succeeded, want error")
+	}
+}
+
+func TestImportReadsExports(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := exportTestEntries(loc)[:1]
+	opts := ExportOptions{Location: loc, Now: time.Now(), Email: "ana@example.com"}
+
+	for _, format := range importerNames() {
+		t.Run(format, func(t *testing.T) {
+			exporter, _ := getExporter(format)
+			data, err := exportToBytes(exporter, entries, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			importer, imported, err := parseImport("", "export."+exporter.Extension(), data, loc)
+			if err != nil {
+				t.Fatalf("parseImport() error = %v", err)
+			}
+			if importer.Name() != format {
+				t.Errorf("detected format = %s, want %s", importer.Name(), format)
+			}
+			want := ImportedEntry{Start: entries[0].StartTime, End: entries[0].EndTime.Time, Note: entries[0].Note, Project: entries[0].Project}
+			if len(imported) != 1 || !imported[0].Start.Equal(want.Start) || !imported[0].End.Equal(want.End) ||
+				imported[0].Note != want.Note || imported[0].Project != want.Project {
+				t.Errorf("parseImport() = %+v, want %+v", imported, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Invites are valid for a week and for one user unless given otherwise
+const (
+	defaultInviteExpiry = 7 * 24 * time.Hour
+	defaultInviteUses   = 1
+)
+
+// Code which registers users with a role when they send /start <code>
+type Invite struct {
+	Code      string
+	Role      string
+	MaxUses   int
+	Uses      int
+	ExpiresAt time.Time
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+const (
+	createInviteSQL = `INSERT INTO invites (code, role, max_uses, expires_at, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	getInviteSQL    = `SELECT code, role, max_uses, uses, expires_at, created_by, created_at FROM invites WHERE code = ?`
+	getInvitesSQL   = `SELECT code, role, max_uses, uses, expires_at, created_by, created_at FROM invites WHERE uses < max_uses AND unixepoch(expires_at) > unixepoch(?) ORDER BY unixepoch(created_at)`
+	useInviteSQL    = `UPDATE invites SET uses = uses + 1 WHERE code = ?`
+	deleteInviteSQL = `DELETE FROM invites WHERE code = ?`
+	userExistsSQL   = `SELECT COUNT(*) FROM users WHERE id = ?`
+)
+
+// Checks if invite can still be redeemed
+func (i Invite) Valid(now time.Time) bool {
+	return i.Uses < i.MaxUses && now.Before(i.ExpiresAt)
+}
+
+// Generates random invite code usable in t.me deep links
+func generateInviteCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Parses invite expiry like "48h" or "14d"
+func parseExpiry(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid expiry %q, use e.g. 48h or 7d", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid expiry %q, use e.g. 48h or 7d", value)
+	}
+	return d, nil
+}
+
+func scanInvite(row rowScanner) (Invite, error) {
+	var invite Invite
+	err := row.Scan(&invite.Code, &invite.Role, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.CreatedBy, &invite.CreatedAt)
+	return invite, err
+}
+
+// Creates invite with random code
+func (db *Database) CreateInvite(role string, maxUses int, expiresAt time.Time, createdBy string) (Invite, error) {
+	code, err := generateInviteCode()
+	if err != nil {
+		return Invite{}, err
+	}
+
+	invite := Invite{
+		Code:      code,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	if _, err := db.conn.Exec(createInviteSQL, invite.Code, invite.Role, invite.MaxUses, invite.ExpiresAt, invite.CreatedBy, invite.CreatedAt); err != nil {
+		return Invite{}, fmt.Errorf("failed to create invite: %w", err)
+	}
+	return invite, nil
+}
+
+// Gets invite by code, returns nil if there is none
+func (db *Database) GetInvite(code string) (*Invite, error) {
+	invite, err := scanInvite(db.conn.QueryRow(getInviteSQL, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// Gets invites which can still be redeemed
+func (db *Database) GetValidInvites(now time.Time) ([]Invite, error) {
+	rows, err := db.conn.Query(getInvitesSQL, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// Deletes invite. Returns false if there was no such invite.
+func (db *Database) RevokeInvite(code string) (bool, error) {
+	res, err := db.conn.Exec(deleteInviteSQL, code)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invite: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// Registers user with role of invite and counts the use
+func (db *Database) RedeemInvite(code string, userID int64, now time.Time) (Invite, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Invite{}, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	defer tx.Rollback()
+
+	invite, err := scanInvite(tx.QueryRow(getInviteSQL, code))
+	if err == sql.ErrNoRows || (err == nil && !invite.Valid(now)) {
+		return Invite{}, fmt.Errorf("This invite code is invalid or has expired.")
+	}
+	if err != nil {
+		return Invite{}, fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	var exists int
+	if err := tx.QueryRow(userExistsSQL, userID).Scan(&exists); err != nil {
+		return Invite{}, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	if exists > 0 {
+		return Invite{}, fmt.Errorf("You can already use this bot.")
+	}
+
+	if _, err := tx.Exec(insertUserIfMissingSQL, userID, invite.Role, invite.CreatedBy, now); err != nil {
+		return Invite{}, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	if _, err := tx.Exec(useInviteSQL, code); err != nil {
+		return Invite{}, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Invite{}, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+	invite.Uses++
+	return invite, nil
+}
+
+// Registers sender of /start <code> if the code is an invite.
+// Returns false if message is not an invite redemption, e.g. /start with a note.
+func (b *Bot) redeemInvite(message *tgbotapi.Message, logger *slog.Logger) bool {
+	if !message.IsCommand() || message.Command() != "start" || isGroupChat(message.Chat) {
+		return false
+	}
+	code := strings.TrimSpace(message.CommandArguments())
+	if code == "" || strings.ContainsAny(code, " \n") {
+		return false
+	}
+	if existing, err := b.db.GetInvite(code); err != nil || existing == nil {
+		return false
+	}
+
+	invite, err := b.db.RedeemInvite(code, message.From.ID, time.Now())
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return true
+	}
+	if err := b.loadUsers(); err != nil {
+		logger.Error("failed to reload users", "error", err)
+	}
+
+	logger.Info("user joined with invite", "role", invite.Role, "invited_by", invite.CreatedBy)
+	b.sendMessage(message.Chat.ID, fmt.Sprintf("👋 Welcome! You can now use this bot as %s.\nType /help to see available commands.", invite.Role), message.MessageID)
+	return true
+}
+
+// Builds t.me link which sends /start <code> to the bot
+func (b *Bot) inviteLink(code string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", b.api.Self.UserName, code)
+}
+
+// Manages invite codes.
+//
+// Usage:
+//
+//	/invite create [role] [expires] [uses]
+//	/invite list
+//	/invite revoke <code>
+func (b *Bot) handleInviteCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		b.sendMessage(message.Chat.ID, inviteUsage, message.MessageID)
+		return
+	}
+
+	now := time.Now()
+	switch strings.ToLower(fields[0]) {
+	case "create":
+		role := RoleMember
+		expiry := defaultInviteExpiry
+		uses := defaultInviteUses
+
+		// options can be given in any order: role name, expiry with unit, number of uses
+		for _, field := range fields[1:] {
+			if parsed, err := parseRole(field); err == nil {
+				role = parsed
+			} else if n, err := strconv.Atoi(field); err == nil && n > 0 {
+				uses = n
+			} else if d, err := parseExpiry(field); err == nil {
+				expiry = d
+			} else {
+				b.sendMessage(message.Chat.ID, inviteUsage, message.MessageID)
+				return
+			}
+		}
+
+		invite, err := b.db.CreateInvite(role, uses, now.Add(expiry), userID)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("✉️ Invite for %s, valid until %s for %d use(s):\n%s\n\nOr send /start %s to the bot.",
+			invite.Role, invite.ExpiresAt.In(b.cfg.Timezone).Format("2006-01-02 15:04"), invite.MaxUses, b.inviteLink(invite.Code), invite.Code), message.MessageID)
+	case "list":
+		invites, err := b.db.GetValidInvites(now)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if len(invites) == 0 {
+			b.sendMessage(message.Chat.ID, "There are no valid invites.", message.MessageID)
+			return
+		}
+
+		lines := []string{"✉️ Invites:"}
+		for _, invite := range invites {
+			lines = append(lines, fmt.Sprintf("• %s: %s, used %d of %d, until %s", invite.Code, invite.Role, invite.Uses, invite.MaxUses,
+				invite.ExpiresAt.In(b.cfg.Timezone).Format("2006-01-02 15:04")))
+		}
+		b.sendMessage(message.Chat.ID, strings.Join(lines, "\n"), message.MessageID)
+	case "revoke":
+		if len(fields) != 2 {
+			b.sendMessage(message.Chat.ID, inviteUsage, message.MessageID)
+			return
+		}
+		revoked, err := b.db.RevokeInvite(fields[1])
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if !revoked {
+			b.sendMessage(message.Chat.ID, "There is no such invite.", message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, "✉️ Invite revoked.", message.MessageID)
+	default:
+		b.sendMessage(message.Chat.ID, inviteUsage, message.MessageID)
+	}
+}
+
+const inviteUsage = "Usage:\n" +
+	"/invite create [admin|manager|member|viewer] [expires] [uses] - Create invite, e.g. /invite create viewer 3d 5\n" +
+	"/invite list - List invites which can still be used\n" +
+	"/invite revoke <code> - Revoke invite"
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"48h", 48 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"-2d", 0, true},
+		{"0h", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"week", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseExpiry(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseExpiry(%q) = %v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExpiry(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseExpiry(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInviteValid(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		uses      int
+		maxUses   int
+		expiresAt time.Time
+		want      bool
+	}{
+		{"unused", 0, 1, now.Add(time.Hour), true},
+		{"uses left", 2, 3, now.Add(time.Hour), true},
+		{"used up", 1, 1, now.Add(time.Hour), false},
+		{"expired", 0, 1, now.Add(-time.Hour), false},
+		{"expires now", 0, 1, now, false},
+		{"used up and expired", 3, 3, now.Add(-time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invite := Invite{Uses: tt.uses, MaxUses: tt.maxUses, ExpiresAt: tt.expiresAt}
+			if got := invite.Valid(now); got != tt.want {
+				t.Errorf("Valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeemInvite(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now()
+
+	invite, err := db.CreateInvite(RoleViewer, 2, now.Add(time.Hour), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redeemed, err := db.RedeemInvite(invite.Code, 101, now)
+	if err != nil {
+		t.Fatalf("RedeemInvite() error = %v", err)
+	}
+	if redeemed.Role != RoleViewer || redeemed.Uses != 1 {
+		t.Errorf("RedeemInvite() = %+v, want role %s and 1 use", redeemed, RoleViewer)
+	}
+
+	if _, err := db.RedeemInvite(invite.Code, 101, now); err == nil {
+		t.Error("RedeemInvite() by registered user succeeded, want error")
+	}
+	if _, err := db.RedeemInvite(invite.Code, 102, now); err != nil {
+		t.Fatalf("RedeemInvite() of second use error = %v", err)
+	}
+	if _, err := db.RedeemInvite(invite.Code, 103, now); err == nil {
+		t.Error("RedeemInvite() of used up invite succeeded, want error")
+	}
+
+	expired, err := db.CreateInvite(RoleMember, 1, now.Add(-time.Minute), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RedeemInvite(expired.Code, 104, now); err == nil {
+		t.Error("RedeemInvite() of expired invite succeeded, want error")
+	}
+	if _, err := db.RedeemInvite("missing", 105, now); err == nil {
+		t.Error("RedeemInvite() of unknown code succeeded, want error")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Single billed entry on invoice
+type InvoiceLine struct {
+	Date    time.Time
+	UserID  string
+	Project string
+	Note    string
+	Tracked time.Duration
+	// Tracked time after rounding, used for the amount
+	Billed      time.Duration
+	HourlyCents int64
+	AmountCents int64
+	HasRate     bool
+}
+
+// Itemised invoice for billable entries of one client in a period.
+type Invoice struct {
+	Number   string
+	Client   string
+	Currency string
+	From     time.Time
+	To       time.Time
+	IssuedAt time.Time
+	Lines    []InvoiceLine
+
+	Billed     time.Duration
+	TotalCents int64
+	// Number of lines without any matching rate
+	MissingRates int
+}
+
+// Settings used when building invoice
+type InvoiceOptions struct {
+	Currency string
+	Rounding RoundingRules
+	Now      time.Time
+}
+
+// Writes invoice in a specific file format, keyed by format name
+var invoiceRenderers = map[string]func(w io.Writer, invoice Invoice) error{
+	"pdf":  renderInvoicePDF,
+	"html": renderInvoiceHTML,
+}
+
+// Builds invoice for client from entries started in [from, to). Only
+// finished billable entries on projects of the client are included.
+func BuildInvoice(client string, entries []Entry, clients map[string]string, rates RateTable, from time.Time, to time.Time, opts InvoiceOptions) Invoice {
+	loc := from.Location()
+	invoice := Invoice{
+		Number:   invoiceNumber(client, from),
+		Client:   client,
+		Currency: opts.Currency,
+		From:     from,
+		To:       to,
+		IssuedAt: opts.Now.In(loc),
+	}
+
+	for _, entry := range entries {
+		if !entry.Billable || !entry.EndTime.Valid || clients[entry.Project] != client {
+			continue
+		}
+
+		date := entry.StartTime.In(loc)
+		line := InvoiceLine{
+			Date:    date,
+			UserID:  entry.UserID,
+			Project: entry.Project,
+			Note:    entry.Note,
+			Tracked: entry.Duration(opts.Now),
+		}
+		line.Billed = opts.Rounding.Duration(entry, opts.Now)
+
+		if rate, ok := rates.Find(entry.UserID, entry.Project, client, date.Format(time.DateOnly)); ok {
+			line.HasRate = true
+			line.HourlyCents = rate.HourlyCents
+			// integer math keeps amounts exact, half a cent is rounded up
+			line.AmountCents = (int64(line.Billed/time.Second)*rate.HourlyCents + 1800) / 3600
+		} else {
+			invoice.MissingRates++
+		}
+
+		invoice.Lines = append(invoice.Lines, line)
+		invoice.Billed += line.Billed
+		invoice.TotalCents += line.AmountCents
+	}
+
+	sort.SliceStable(invoice.Lines, func(i, j int) bool { return invoice.Lines[i].Date.Before(invoice.Lines[j].Date) })
+	return invoice
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// Builds invoice number from client and month of period, e.g. ACME-INC-202401.
+// Periods not starting on the first day of a month get the full start
+// date, e.g. ACME-INC-20240115, so they do not reuse the monthly number.
+func invoiceNumber(client string, from time.Time) string {
+	slug := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToUpper(client), "-"), "-")
+	if slug == "" {
+		slug = "INVOICE"
+	}
+	if from.Day() != 1 {
+		return slug + "-" + from.Format("20060102")
+	}
+	return slug + "-" + from.Format("200601")
+}
+
+// Finds client by name ignoring case, returns false if no project belongs to it
+func findClient(clients map[string]string, name string) (string, bool) {
+	for _, client := range clients {
+		if strings.EqualFold(client, name) {
+			return client, true
+		}
+	}
+	return "", false
+}
+
+// Formats billed hours with two decimals
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%.2f", d.Hours())
+}
+
+// Formats rate of line, lines without rate are marked
+func (l InvoiceLine) RateText(currency string) string {
+	if !l.HasRate {
+		return "no rate"
+	}
+	return formatMoney(l.HourlyCents, currency)
+}
+
+func renderInvoicePDF(w io.Writer, invoice Invoice) error {
+	const (
+		left   = 40.0
+		right  = pdfPageWidth - 40.0
+		bottom = 80.0
+		size   = 9.0
+	)
+
+	doc := &pdfDocument{}
+	doc.AddPage()
+
+	doc.Text(left, 790, 20, true, "Invoice "+invoice.Number)
+	doc.Text(left, 765, 11, false, "Client: "+invoice.Client)
+	doc.Text(left, 750, 11, false, "Period: "+invoice.From.Format(time.DateOnly)+" - "+invoice.To.AddDate(0, 0, -1).Format(time.DateOnly))
+	doc.Text(left, 735, 11, false, "Issued: "+invoice.IssuedAt.Format(time.DateOnly))
+
+	header := func(y float64) float64 {
+		doc.Text(left, y, size, true, "Date")
+		doc.Text(left+60, y, size, true, "Project")
+		doc.Text(left+160, y, size, true, "Description")
+		doc.TextRight(right-140, y, size, true, "Hours")
+		doc.TextRight(right-70, y, size, true, "Rate")
+		doc.TextRight(right, y, size, true, "Amount")
+		doc.Line(left, right, y-4)
+		return y - 18
+	}
+
+	y := header(700)
+	for _, line := range invoice.Lines {
+		if y < bottom {
+			doc.AddPage()
+			y = header(pdfPageHeight - 60)
+		}
+
+		doc.Text(left, y, size, false, line.Date.Format(time.DateOnly))
+		doc.Text(left+60, y, size, false, truncateText(line.Project, 18))
+		doc.Text(left+160, y, size, false, truncateText(line.Note, 40))
+		doc.TextRight(right-140, y, size, false, formatHours(line.Billed))
+		doc.TextRight(right-70, y, size, false, line.RateText(invoice.Currency))
+		doc.TextRight(right, y, size, false, formatMoney(line.AmountCents, invoice.Currency))
+		y -= 14
+	}
+
+	if y < bottom {
+		doc.AddPage()
+		y = pdfPageHeight - 60
+	}
+	doc.Line(left, right, y+8)
+	doc.Text(left, y-6, 11, true, "Total")
+	doc.TextRight(right-140, y-6, 11, true, formatHours(invoice.Billed))
+	doc.TextRight(right, y-6, 11, true, formatMoney(invoice.TotalCents, invoice.Currency))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// Shortens text to at most n characters, marking the cut with "..."
+func truncateText(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"hours": formatHours,
+	"money": formatMoney,
+	"date":  func(t time.Time) string { return t.Format(time.DateOnly) },
+	"last":  func(t time.Time) string { return t.AddDate(0, 0, -1).Format(time.DateOnly) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 40px; color: #333; }
+table { border-collapse: collapse; width: 100%; margin-top: 24px; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.number { text-align: right; white-space: nowrap; }
+tfoot td { font-weight: bold; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Client: {{.Client}}<br>
+Period: {{date .From}} – {{last .To}}<br>
+Issued: {{date .IssuedAt}}</p>
+<table>
+<thead>
+<tr><th>Date</th><th>Project</th><th>Description</th><th class="number">Hours</th><th class="number">Rate</th><th class="number">Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{date .Date}}</td><td>{{.Project}}</td><td>{{.Note}}</td><td class="number">{{hours .Billed}}</td><td class="number">{{.RateText $.Currency}}</td><td class="number">{{money .AmountCents $.Currency}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="3">Total</td><td class="number">{{hours .Billed}}</td><td></td><td class="number">{{money .TotalCents .Currency}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+func renderInvoiceHTML(w io.Writer, invoice Invoice) error {
+	return invoiceTemplate.Execute(w, invoice)
+}
+
+// Sends invoice for client as a file.
+//
+// Usage:
+//
+//	/invoice <client> [period] [pdf|html]
+func (b *Bot) handleInvoiceCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+	period := "lastmonth"
+	format := "pdf"
+
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	loc := settings.Location(b.cfg.Timezone)
+	now := time.Now()
+
+	// format and period follow the client name, which may contain spaces
+	for len(fields) > 1 {
+		last := strings.ToLower(fields[len(fields)-1])
+		if _, ok := invoiceRenderers[last]; ok {
+			format = last
+		} else if _, _, err := parsePeriod(last, now, loc); err == nil {
+			period = last
+		} else {
+			break
+		}
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		b.sendMessage(message.Chat.ID, invoiceUsage, message.MessageID)
+		return
+	}
+
+	clients, err := b.db.GetProjectClients()
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	client, ok := findClient(clients, strings.Join(fields, " "))
+	if !ok {
+		b.sendMessage(message.Chat.ID, "No project belongs to client "+strings.Join(fields, " ")+". Assign one with /project client <project> <client>.", message.MessageID)
+		return
+	}
+
+	from, to, _ := parsePeriod(period, now, loc)
+	entries, err := b.db.GetEntriesBetween(userID, from, to)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	rates, err := b.db.GetRates()
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	rounding, err := b.db.GetRoundingRules(b.cfg.Rounding)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	invoice := BuildInvoice(client, entries, clients, rates, from, to, InvoiceOptions{
+		Currency: b.cfg.Currency,
+		Rounding: rounding,
+		Now:      now,
+	})
+	if len(invoice.Lines) == 0 {
+		b.sendMessage(message.Chat.ID, "There are no billable entries for "+client+" in "+periodTitle(from, to)+".", message.MessageID)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoiceRenderers[format](&buf, invoice); err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("Failed to create invoice: %s", err), message.MessageID)
+		return
+	}
+
+	caption := fmt.Sprintf("🧾 %s, %s: %s h, %s", client, periodTitle(from, to), formatHours(invoice.Billed), formatMoney(invoice.TotalCents, invoice.Currency))
+	if invoice.MissingRates > 0 {
+		caption += fmt.Sprintf("\n⚠️ %d entries have no rate, set one with /rate set.", invoice.MissingRates)
+	}
+	b.sendDocument(message.Chat.ID, "invoice-"+strings.ToLower(invoice.Number)+"."+format, buf.Bytes(), caption, message.MessageID)
+}
+
+const invoiceUsage = "Usage:\n" +
+	"/invoice <client> [period] [pdf|html] - Creates invoice for billable entries, period defaults to lastmonth"
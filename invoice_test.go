@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		client string
+		from   time.Time
+		want   string
+	}{
+		{"ACME Inc.", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "ACME-INC-202401"},
+		{"  müller & söhne ", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), "M-LLER-S-HNE-202412"},
+		{"ACME Inc.", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), "ACME-INC-20240115"},
+		{"***", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "INVOICE-202401"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := invoiceNumber(tt.client, tt.from); got != tt.want {
+				t.Errorf("invoiceNumber(%q, %v) = %q, want %q", tt.client, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateTableFind(t *testing.T) {
+	rates := RateTable{
+		{ID: 1, HourlyCents: 5000, EffectiveFrom: "2024-01-01"},
+		{ID: 2, Client: "ACME", HourlyCents: 6000, EffectiveFrom: "2024-01-01"},
+		{ID: 3, Client: "ACME", HourlyCents: 6500, EffectiveFrom: "2024-03-01"},
+		{ID: 4, Project: "web", HourlyCents: 7000, EffectiveFrom: "2024-01-01"},
+		{ID: 5, Project: "web", UserID: "1", HourlyCents: 9000, EffectiveFrom: "2024-02-01"},
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		project string
+		client  string
+		day     string
+		wantID  int64
+	}{
+		{"default", "2", "other", "Other", "2024-02-01", 1},
+		{"client", "2", "app", "ACME", "2024-02-01", 2},
+		{"newer client rate", "2", "app", "ACME", "2024-03-15", 3},
+		{"project wins over client", "2", "web", "ACME", "2024-03-15", 4},
+		{"user on project wins", "1", "web", "ACME", "2024-03-15", 5},
+		{"user rate not effective yet", "1", "web", "ACME", "2024-01-15", 4},
+		{"nothing effective", "1", "web", "ACME", "2023-12-31", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := rates.Find(tt.userID, tt.project, tt.client, tt.day)
+			if ok != (tt.wantID != 0) || rate.ID != tt.wantID {
+				t.Errorf("Find() = rate %d, %v, want rate %d", rate.ID, ok, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestBuildInvoice(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(day int, minutes int, project string, billable bool) Entry {
+		start := from.AddDate(0, 0, day).Add(9 * time.Hour)
+		return Entry{
+			UserID:    "1",
+			StartTime: start,
+			EndTime:   sql.NullTime{Time: start.Add(time.Duration(minutes) * time.Minute), Valid: true},
+			Project:   project,
+			Billable:  billable,
+		}
+	}
+	running := entry(4, 60, "web", true)
+	running.EndTime = sql.NullTime{}
+
+	entries := []Entry{
+		entry(2, 50, "web", true),
+		entry(0, 60, "web", true),
+		entry(1, 60, "web", false),
+		entry(3, 60, "internal", true),
+		entry(5, 30, "app", true),
+		running,
+	}
+	clients := map[string]string{"web": "ACME", "app": "ACME", "internal": "Us"}
+	rates := RateTable{{Project: "web", HourlyCents: 6000, EffectiveFrom: "2024-01-01"}}
+
+	invoice := BuildInvoice("ACME", entries, clients, rates, from, from.AddDate(0, 1, 0), InvoiceOptions{
+		Currency: "EUR",
+		Rounding: RoundingRules{Default: RoundingPolicy{Mode: RoundUp, Increment: 15 * time.Minute}},
+		Now:      from.AddDate(0, 1, 0),
+	})
+
+	if invoice.Number != "ACME-202403" || len(invoice.Lines) != 3 {
+		t.Fatalf("BuildInvoice() = %s with %d lines, want ACME-202403 with 3 lines", invoice.Number, len(invoice.Lines))
+	}
+	for i, want := range []time.Duration{time.Hour, time.Hour, 30 * time.Minute} {
+		if invoice.Lines[i].Billed != want {
+			t.Errorf("line %d billed %v, want %v", i, invoice.Lines[i].Billed, want)
+		}
+	}
+	if !invoice.Lines[0].Date.Before(invoice.Lines[1].Date) {
+		t.Error("lines are not sorted by date")
+	}
+	if invoice.Billed != 150*time.Minute || invoice.TotalCents != 12000 || invoice.MissingRates != 1 {
+		t.Errorf("BuildInvoice() billed %v, total %d, missing rates %d, want 2h30m, 12000, 1",
+			invoice.Billed, invoice.TotalCents, invoice.MissingRates)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	RequestIDContextKey contextKey = "request_id"
+	LoggerContextKey    contextKey = "logger"
+)
+
+// Header carrying request ID, taken from the caller when present
+const requestIDHeader = "X-Request-ID"
+
+// Replacement of secrets and redacted values in logs
+const redacted = "[REDACTED]"
+
+// Parses log level name like "info" or "debug"
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, use debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// Builds logger writing JSON or text records to w. Secrets are removed from
+// every logged value, e.g. bot token included in URLs of Telegram API errors.
+func newLogger(w io.Writer, format string, level slog.Level, secrets []string) *slog.Logger {
+	var secretList []string
+	for _, secret := range secrets {
+		if secret != "" {
+			secretList = append(secretList, secret)
+		}
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(secretList) == 0 {
+				return attr
+			}
+			switch value := attr.Value.Any().(type) {
+			case string:
+				attr.Value = slog.StringValue(removeSecrets(value, secretList))
+			case error:
+				attr.Value = slog.StringValue(removeSecrets(value.Error(), secretList))
+			}
+			return attr
+		},
+	}
+
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func removeSecrets(value string, secrets []string) string {
+	for _, secret := range secrets {
+		value = strings.ReplaceAll(value, secret, redacted)
+	}
+	return value
+}
+
+// Makes configured logger the default one, also for the standard log package
+func setupLogging(cfg *Config) {
+	slog.SetDefault(newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel, []string{cfg.BotToken}))
+}
+
+// Logs error and exits, used when the bot can not start
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Gets command arguments safe to log. Arguments contain notes and invite
+// codes, so only their length is logged unless redaction is disabled.
+func (b *Bot) loggedArgs(args string) slog.Attr {
+	if !b.cfg.LogRedact || args == "" {
+		return slog.String("args", args)
+	}
+	return slog.Int("args_length", len(args))
+}
+
+// Builds logger of Telegram update, carrying update ID, sender and chat
+func updateLogger(update tgbotapi.Update) *slog.Logger {
+	logger := slog.Default().With("update_id", update.UpdateID)
+	if user := update.SentFrom(); user != nil {
+		logger = logger.With("user_id", user.ID)
+	}
+	if chat := update.FromChat(); chat != nil {
+		logger = logger.With("chat_id", chat.ID)
+	}
+	return logger
+}
+
+// Generates random ID of API request
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Gets logger of request, carrying its request ID and token
+func requestLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(LoggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Records status code written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Assigns request ID to every request, returns it in X-Request-ID header and
+// logs completed requests. Callers may pass their own ID in the same header.
+func RequestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		ctx := context.WithValue(r.Context(), RequestIDContextKey, requestID)
+		ctx = context.WithValue(ctx, LoggerContextKey, logger)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		// query is left out, it may contain names and emails
+		logger.Info("request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Makes logger writing JSON records to the returned buffer the default one
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(newLogger(&buf, "json", slog.LevelDebug, nil))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// Decodes JSON log records, one per line
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"info", slog.LevelInfo, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseLogLevel(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogLevel(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseLogLevel(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLoggerRemovesSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "json", slog.LevelInfo, []string{"123:secret", ""})
+
+	logger.Error("failed to send message",
+		"url", "https://api.telegram.org/bot123:secret/sendMessage",
+		"error", errors.New(`Post "https://api.telegram.org/bot123:secret/sendMessage": timeout`),
+	)
+	logger.Debug("below level", "token", "123:secret")
+
+	if strings.Contains(buf.String(), "123:secret") {
+		t.Fatalf("log contains secret: %s", buf.String())
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("logged %d records, want 1", len(records))
+	}
+	if url := records[0]["url"]; url != "https://api.telegram.org/bot"+redacted+"/sendMessage" {
+		t.Errorf("url = %v, want token replaced", url)
+	}
+}
+
+func TestUpdateLogger(t *testing.T) {
+	buf := captureLogs(t)
+
+	from := &tgbotapi.User{ID: 7}
+	chat := &tgbotapi.Chat{ID: -100}
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   map[string]float64
+	}{
+		{"message", tgbotapi.Update{UpdateID: 1, Message: &tgbotapi.Message{From: from, Chat: chat}},
+			map[string]float64{"update_id": 1, "user_id": 7, "chat_id": -100}},
+		{"callback", tgbotapi.Update{UpdateID: 2, CallbackQuery: &tgbotapi.CallbackQuery{From: from, Message: &tgbotapi.Message{Chat: chat}}},
+			map[string]float64{"update_id": 2, "user_id": 7, "chat_id": -100}},
+		{"without sender", tgbotapi.Update{UpdateID: 3},
+			map[string]float64{"update_id": 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			updateLogger(tt.update).Error("failed")
+
+			records := logRecords(t, buf)
+			if len(records) != 1 {
+				t.Fatalf("logged %d records, want 1", len(records))
+			}
+			for key, want := range tt.want {
+				if got := records[0][key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+			for _, key := range []string{"user_id", "chat_id"} {
+				if _, ok := tt.want[key]; !ok && records[0][key] != nil {
+					t.Errorf("%s = %v, want none", key, records[0][key])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleUpdateLogsUpdateID(t *testing.T) {
+	buf := captureLogs(t)
+	b := &Bot{db: newTestDatabase(t), cfg: &Config{OpenAccess: true}}
+
+	chat := &tgbotapi.Chat{ID: 7, Type: "private"}
+	from := &tgbotapi.User{ID: 7}
+	tests := []struct {
+		name    string
+		message *tgbotapi.Message
+		want    string
+	}{
+		{"plain message", &tgbotapi.Message{From: from, Chat: chat, Text: "secret note"}, "received message"},
+		{"document", &tgbotapi.Message{From: from, Chat: chat, Document: &tgbotapi.Document{FileID: "file", FileSize: 10}}, "received document"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			b.handleUpdate(tgbotapi.Update{UpdateID: 40 + i, Message: tt.message})
+
+			records := logRecords(t, buf)
+			if len(records) != 1 {
+				t.Fatalf("logged %d records, want 1: %s", len(records), buf)
+			}
+			if records[0]["msg"] != tt.want || records[0]["update_id"] != float64(40+i) {
+				t.Errorf("record = %v, want %q with update_id %d", records[0], tt.want, 40+i)
+			}
+			if strings.Contains(buf.String(), "secret note") {
+				t.Errorf("text of message was logged: %s", buf)
+			}
+		})
+	}
+}
+
+func TestLoggedArgs(t *testing.T) {
+	tests := []struct {
+		redact bool
+		args   string
+		want   string
+	}{
+		{true, "secret note", "args_length=11"},
+		{true, "", "args="},
+		{false, "secret note", "args=secret note"},
+	}
+
+	for _, tt := range tests {
+		b := &Bot{cfg: &Config{LogRedact: tt.redact}}
+		if got := b.loggedArgs(tt.args).String(); got != tt.want {
+			t.Errorf("loggedArgs(%q) with redact %v = %q, want %q", tt.args, tt.redact, got, tt.want)
+		}
+	}
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	buf := captureLogs(t)
+
+	var handlerID any
+	handler := RequestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerID = r.Context().Value(RequestIDContextKey)
+		requestLogger(r.Context()).Error("failed to fetch entries")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"caller ID", "abc-123"},
+		{"generated ID", ""},
+		{"too long ID", strings.Repeat("x", 65)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/entries?email=someone@example.com", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(requestIDHeader)
+			if requestID == "" || handlerID != requestID {
+				t.Fatalf("request ID = %q, handler saw %v", requestID, handlerID)
+			}
+			if tt.header != "" && len(tt.header) <= 64 && requestID != tt.header {
+				t.Errorf("request ID = %q, want caller's %q", requestID, tt.header)
+			}
+			if len(tt.header) > 64 && requestID == tt.header {
+				t.Error("too long request ID was kept")
+			}
+
+			records := logRecords(t, buf)
+			if len(records) != 2 {
+				t.Fatalf("logged %d records, want 2", len(records))
+			}
+			for _, record := range records {
+				if record["request_id"] != requestID {
+					t.Errorf("record %q has request_id %v, want %q", record["msg"], record["request_id"], requestID)
+				}
+			}
+			if records[1]["status"] != float64(http.StatusTeapot) || records[1]["path"] != "/api/entries" {
+				t.Errorf("request record = %v", records[1])
+			}
+			if strings.Contains(buf.String(), "someone@example.com") {
+				t.Error("query was logged")
+			}
+		})
+	}
+}
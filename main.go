@@ -2,62 +2,145 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"sync"
+	"time"
 )
 
 type App struct {
-	db  *Database
-	bot *Bot
+	cfg       *Config
+	db        *Database
+	bot       *Bot
+	scheduler *Scheduler
 }
 
-func NewApp(db *Database, bot *Bot) *App {
-	return &App{
-		db:  db,
-		bot: bot,
+func NewApp(cfg *Config, db *Database, bot *Bot) *App {
+	app := &App{
+		cfg:       cfg,
+		db:        db,
+		bot:       bot,
+		scheduler: NewScheduler(),
 	}
+	app.registerJobs()
+
+	return app
+}
+
+// Registers background jobs run while the bot is running
+func (a *App) registerJobs() {
+	a.scheduler.Add(Job{
+		Name:     "timer-reminders",
+		Interval: a.cfg.ReminderCheckInterval,
+		Run:      a.bot.checkLongRunningTimers,
+	})
+
+	a.scheduler.Add(Job{
+		Name:     "focus-sessions",
+		Interval: a.cfg.FocusCheckInterval,
+		Run:      a.bot.completeDueFocusSessions,
+	})
+
+	a.scheduler.Add(Job{
+		Name:     "digests",
+		Interval: time.Minute,
+		Run:      a.bot.sendDueDigests,
+	})
+
+	a.scheduler.Add(Job{
+		Name:     "schedule-nudges",
+		Interval: time.Minute,
+		Run:      a.bot.sendDueNudges,
+	})
+
+	a.scheduler.Add(Job{
+		Name:     "budget-alerts",
+		Interval: a.cfg.BudgetCheckInterval,
+		Run:      a.bot.checkBudgets,
+	})
+
+	a.scheduler.Add(Job{
+		Name:     "purge-deleted",
+		Interval: time.Hour,
+		Run:      a.bot.purgeDeletedEntries,
+	})
+
+	if a.cfg.BackupInterval > 0 {
+		// due backups are checked often, so restarts do not skip them
+		a.scheduler.Add(Job{
+			Name:       "backups",
+			Interval:   min(a.cfg.BackupInterval, time.Hour),
+			RunAtStart: true,
+			Run: func(now time.Time) {
+				opts := BackupOptions{Dir: a.cfg.BackupDir, Gzip: a.cfg.BackupGzip, Keep: a.cfg.BackupKeep}
+				path, err := a.db.BackupIfDue(opts, a.cfg.BackupInterval, now)
+				if err != nil {
+					slog.Error("backup failed", "error", err)
+					return
+				}
+				if path == "" {
+					return
+				}
+				if _, err := VerifyBackup(path); err != nil {
+					slog.Error("backup failed verification", "path", path, "error", err)
+					return
+				}
+				slog.Info("database backed up", "path", path)
+			},
+		})
+	}
+
+	a.scheduler.Add(Job{
+		Name:     "expired-conversations",
+		Interval: conversationTimeout,
+		Run: func(now time.Time) {
+			if _, err := a.db.DeleteExpiredConversations(); err != nil {
+				slog.Error("failed to delete expired conversations", "error", err)
+			}
+		},
+	})
 }
 
 func main() {
 	args := os.Args
-	app := createApp()
 
 	if len(args) > 1 {
 		command := args[1]
-		handleCommand(app, command)
+		handleCommand(command, args[2:])
 		return
 	}
 
-	app.Start()
+	createApp().Start()
 }
 
 func createApp() *App {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if botToken == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is required")
+	cfg, err := LoadConfig()
+	if err != nil {
+		fatal("failed to load config", "error", err)
 	}
+	setupLogging(cfg)
 
-	authorizedUsersEnv := os.Getenv("AUTHORIZED_USERS")
-	authorizedUsers := convertStringToIntArray(authorizedUsersEnv)
-	if len(authorizedUsers) == 0 {
-		log.Println("No authorized users specified.")
+	if cfg.BotToken == "" {
+		fatal("TELEGRAM_BOT_TOKEN environment variable is required")
 	}
 
-	db, err := NewDatabase("database.db")
+	db, err := NewDatabase(cfg.DatabasePath, cfg.NoteKeys)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to open database", "error", err)
 	}
 
-	bot, err := NewTelegramBot(botToken, authorizedUsers, db)
+	bot, err := NewTelegramBot(cfg, db)
 	if err != nil {
-		log.Fatal("Failed to initialize bot: ", err)
+		fatal("failed to initialize bot", "error", err)
 	}
 
-	return NewApp(db, bot)
+	return NewApp(cfg, db, bot)
 }
 
 func (a *App) Start() {
+	a.scheduler.Start()
+	defer a.scheduler.Stop()
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -68,9 +151,9 @@ func (a *App) Start() {
 
 	go func() {
 		defer wg.Done()
-		err := StartAPIServer(a, a.db, 3000)
+		err := StartAPIServer(a, a.db, a.cfg.APIPort)
 		if err != nil {
-			log.Fatal(err)
+			fatal("API server failed", "error", err)
 		}
 	}()
 
@@ -80,10 +163,10 @@ func (a *App) Start() {
 func (a *App) GenerateAPIToken() {
 	token, err := GenerateToken()
 	if err != nil {
-		log.Fatal("Failed to generate token: ", err)
+		fatal("failed to generate token", "error", err)
 	}
 
-	err = a.db.CreateApiToken(token)
+	err = a.db.CreateApiToken(ActorCLI, token)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -93,11 +176,29 @@ func (a *App) GenerateAPIToken() {
 	fmt.Println("IMPORTANT: Save this token now. You won't be able to see it again!")
 }
 
-func handleCommand(app *App, command string) {
+func handleCommand(command string, args []string) {
 	switch command {
 	case "start":
-		app.Start()
+		createApp().Start()
 	case "gen-api-token":
-		app.GenerateAPIToken()
+		createApp().GenerateAPIToken()
+	case "export":
+		runExportCommand(args)
+	case "import":
+		runImportCommand(args)
+	case "invoice":
+		runInvoiceCommand(args)
+	case "rate":
+		runRateCommand(args)
+	case "backup":
+		runBackupCommand(args)
+	case "verify":
+		runVerifyCommand(args)
+	case "restore":
+		runRestoreCommand(args)
+	case "rekey":
+		runRekeyCommand(args)
+	default:
+		printUsage()
 	}
 }
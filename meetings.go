@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Shared timer in a chat. Everyone who joins gets own entry, which is
+// stopped when the meeting ends.
+type Meeting struct {
+	ID        int64
+	ChatID    int64
+	MessageID int
+	Note      string
+	Project   string
+	StartedBy string
+	StartedAt time.Time
+	EndedAt   sql.NullTime
+}
+
+type MeetingParticipant struct {
+	UserID  string
+	Name    string
+	EntryID int64
+}
+
+const (
+	createMeetingSQL          = `INSERT INTO meetings (chat_id, note, project, started_by, started_at) VALUES (?, ?, ?, ?, ?)`
+	updateMeetingMessageSQL   = `UPDATE meetings SET message_id = ? WHERE id = ?`
+	getMeetingSQL             = `SELECT id, chat_id, message_id, note, project, started_by, started_at, ended_at FROM meetings WHERE id = ?`
+	endMeetingSQL             = `UPDATE meetings SET ended_at = ? WHERE id = ? AND ended_at IS NULL`
+	addMeetingParticipantSQL  = `INSERT INTO meeting_participants (meeting_id, user_id, entry_id, joined_at) VALUES (?, ?, ?, ?)`
+	getMeetingParticipantsSQL = `
+  SELECT p.user_id, COALESCE(m.name, ''), p.entry_id FROM meeting_participants p
+  JOIN meetings mt ON mt.id = p.meeting_id
+  LEFT JOIN chat_members m ON m.chat_id = mt.chat_id AND m.user_id = p.user_id
+  WHERE p.meeting_id = ? ORDER BY p.joined_at`
+)
+
+// Creates meeting in chat
+func (db *Database) CreateMeeting(meeting *Meeting) error {
+	note, err := db.notes.Encrypt(meeting.Note)
+	if err != nil {
+		return err
+	}
+	res, err := db.conn.Exec(createMeetingSQL, meeting.ChatID, note, meeting.Project, meeting.StartedBy, meeting.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create meeting: %w", err)
+	}
+	meeting.ID, err = res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to create meeting: %w", err)
+	}
+	return nil
+}
+
+// Stores ID of message with Join button of meeting
+func (db *Database) SetMeetingMessage(meetingID int64, messageID int) error {
+	if _, err := db.conn.Exec(updateMeetingMessageSQL, messageID, meetingID); err != nil {
+		return fmt.Errorf("failed to update meeting: %w", err)
+	}
+	return nil
+}
+
+// Gets meeting by ID, returns nil if there is none
+func (db *Database) GetMeeting(id int64) (*Meeting, error) {
+	var meeting Meeting
+	err := db.conn.QueryRow(getMeetingSQL, id).Scan(&meeting.ID, &meeting.ChatID, &meeting.MessageID, &meeting.Note,
+		&meeting.Project, &meeting.StartedBy, &meeting.StartedAt, &meeting.EndedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meeting: %w", err)
+	}
+	if meeting.Note, err = db.notes.Decrypt(meeting.Note); err != nil {
+		return nil, fmt.Errorf("meeting %d: %w", id, err)
+	}
+	return &meeting, nil
+}
+
+// Marks meeting as ended. Returns false if it already ended.
+func (db *Database) EndMeeting(id int64, at time.Time) (bool, error) {
+	res, err := db.conn.Exec(endMeetingSQL, at, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to end meeting: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+// Starts entry of user for meeting and adds the user to participants,
+// both or neither are stored
+func (db *Database) JoinMeeting(meeting *Meeting, userID string) (Entry, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to join meeting: %w", err)
+	}
+	defer tx.Rollback()
+
+	entry, err := db.startEntry(tx, userID, meeting.Note, meeting.Project)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if _, err := tx.Exec(addMeetingParticipantSQL, meeting.ID, userID, entry.ID, entry.StartTime); err != nil {
+		return Entry{}, fmt.Errorf("failed to join meeting: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Entry{}, fmt.Errorf("failed to join meeting: %w", err)
+	}
+	return entry, nil
+}
+
+// Gets participants of meeting in order of joining
+func (db *Database) GetMeetingParticipants(meetingID int64) ([]MeetingParticipant, error) {
+	rows, err := db.conn.Query(getMeetingParticipantsSQL, meetingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meeting participants: %w", err)
+	}
+	defer rows.Close()
+
+	var participants []MeetingParticipant
+	for rows.Next() {
+		var participant MeetingParticipant
+		if err := rows.Scan(&participant.UserID, &participant.Name, &participant.EntryID); err != nil {
+			return nil, fmt.Errorf("failed to scan meeting participant: %w", err)
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
+
+// Builds text of meeting message with list of participants
+func (b *Bot) meetingText(meeting *Meeting, participants []MeetingParticipant) string {
+	title := "👥 Meeting"
+	if meeting.Note != "" {
+		title += ": " + meeting.Note
+	}
+	if meeting.Project != "" {
+		title += " [" + meeting.Project + "]"
+	}
+
+	names := make([]string, 0, len(participants))
+	for _, participant := range participants {
+		name := participant.Name
+		if name == "" {
+			name = participant.UserID
+		}
+		names = append(names, name)
+	}
+	joined := "nobody yet"
+	if len(names) > 0 {
+		joined = strings.Join(names, ", ")
+	}
+
+	if meeting.EndedAt.Valid {
+		return fmt.Sprintf("%s\nEnded after %s.\nParticipants: %s", title, formatDuration(meeting.EndedAt.Time.Sub(meeting.StartedAt)), joined)
+	}
+	return fmt.Sprintf("%s\nStarted at %s.\nJoined: %s", title, meeting.StartedAt.In(b.cfg.Timezone).Format("15:04"), joined)
+}
+
+func meetingKeyboard(meetingID int64) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(meetingID, 10)
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✋ Join", "meeting:join:"+id),
+		tgbotapi.NewInlineKeyboardButtonData("⏹️ End", "meeting:end:"+id),
+	))
+}
+
+// Starts shared meeting timer with Join button. Sender joins right away
+// unless a timer of theirs is already running.
+//
+// Usage:
+//
+//	/meeting [note]
+func (b *Bot) handleMeetingCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	meeting := &Meeting{
+		ChatID:    message.Chat.ID,
+		Note:      strings.TrimSpace(args),
+		Project:   b.chatDefaultProject(message.Chat, logger),
+		StartedBy: userID,
+		StartedAt: time.Now(),
+	}
+	if err := b.db.CreateMeeting(meeting); err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	if active, err := b.db.hasActiveEntry(userID); err == nil && !active {
+		if _, err := b.db.JoinMeeting(meeting, userID); err != nil {
+			logger.Error("failed to join meeting", "meeting_id", meeting.ID, "error", err)
+		}
+	}
+
+	participants, err := b.db.GetMeetingParticipants(meeting.ID)
+	if err != nil {
+		logger.Error("failed to get meeting participants", "meeting_id", meeting.ID, "error", err)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, b.meetingText(meeting, participants))
+	msg.ReplyMarkup = meetingKeyboard(meeting.ID)
+	sent, err := b.api.Send(msg)
+	if err != nil {
+		b.metrics.SendFailed("send_message")
+		logger.Error("failed to send message", "error", err)
+		return
+	}
+	if err := b.db.SetMeetingMessage(meeting.ID, sent.MessageID); err != nil {
+		logger.Error("failed to save meeting message", "meeting_id", meeting.ID, "error", err)
+	}
+}
+
+// Handles Join and End buttons of meeting.
+//
+// Callback data:
+//
+//	meeting:join:<meeting-id>
+//	meeting:end:<meeting-id>
+func (b *Bot) handleMeetingCallback(query *tgbotapi.CallbackQuery, args []string, logger *slog.Logger) {
+	if len(args) != 2 {
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+	meetingID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+
+	meeting, err := b.db.GetMeeting(meetingID)
+	if err != nil || meeting == nil {
+		b.answerCallback(query, "This meeting does not exist anymore.")
+		return
+	}
+	if meeting.EndedAt.Valid {
+		b.answerCallback(query, "This meeting has already ended.")
+		return
+	}
+
+	userID := strconv.FormatInt(query.From.ID, 10)
+	if query.Message != nil {
+		b.rememberMember(&tgbotapi.Message{Chat: query.Message.Chat, From: query.From}, logger)
+	}
+
+	participants, err := b.db.GetMeetingParticipants(meeting.ID)
+	if err != nil {
+		b.answerCallback(query, fmt.Sprintf("%s", err))
+		return
+	}
+
+	switch args[0] {
+	case "join":
+		for _, participant := range participants {
+			if participant.UserID == userID {
+				b.answerCallback(query, "You have already joined.")
+				return
+			}
+		}
+
+		if _, err := b.db.JoinMeeting(meeting, userID); err != nil {
+			b.answerCallback(query, fmt.Sprintf("%s Stop your timer first.", err))
+			return
+		}
+		b.answerCallback(query, "⏲️ Your timer is started.")
+	case "end":
+		allowed := userID == meeting.StartedBy
+		for _, participant := range participants {
+			allowed = allowed || participant.UserID == userID
+		}
+		if !allowed {
+			b.answerCallback(query, "Only participants can end the meeting.")
+			return
+		}
+
+		now := time.Now()
+		if ended, err := b.db.EndMeeting(meeting.ID, now); err != nil || !ended {
+			b.answerCallback(query, "This meeting has already ended.")
+			return
+		}
+		meeting.EndedAt = sql.NullTime{Time: now, Valid: true}
+
+		// participants who already stopped or started another timer keep their entries
+		for _, participant := range participants {
+			if _, err := b.db.StopEntryAt(userActor(userID), participant.UserID, participant.EntryID, now); err != nil {
+				logger.Info("timer of meeting participant not stopped", "meeting_id", meeting.ID, "participant_id", participant.UserID, "error", err)
+			}
+		}
+		b.answerCallback(query, "Meeting ended.")
+	default:
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+
+	participants, err = b.db.GetMeetingParticipants(meeting.ID)
+	if err != nil {
+		logger.Error("failed to get meeting participants", "meeting_id", meeting.ID, "error", err)
+		return
+	}
+	b.updateMeetingMessage(meeting, participants)
+}
+
+// Refreshes meeting message, buttons are kept only while meeting runs
+func (b *Bot) updateMeetingMessage(meeting *Meeting, participants []MeetingParticipant) {
+	if meeting.MessageID == 0 {
+		return
+	}
+
+	text := b.meetingText(meeting, participants)
+	if meeting.EndedAt.Valid {
+		b.editMessage(&tgbotapi.Message{MessageID: meeting.MessageID, Chat: &tgbotapi.Chat{ID: meeting.ChatID}}, text)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(meeting.ChatID, meeting.MessageID, text, meetingKeyboard(meeting.ID))
+	if _, err := b.api.Send(edit); err != nil {
+		b.metrics.SendFailed("edit_message")
+		slog.Error("failed to edit message", "chat_id", meeting.ChatID, "error", err)
+	}
+}
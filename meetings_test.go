@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestJoinMeeting(t *testing.T) {
+	db := newTestDatabase(t)
+
+	meeting := &Meeting{ChatID: -100, Note: "standup", Project: "team", StartedBy: "1", StartedAt: time.Now()}
+	if err := db.CreateMeeting(meeting); err != nil {
+		t.Fatalf("CreateMeeting() error = %v", err)
+	}
+
+	entry, err := db.JoinMeeting(meeting, "1")
+	if err != nil {
+		t.Fatalf("JoinMeeting() error = %v", err)
+	}
+	if entry.Note != "standup" || entry.Project != "team" {
+		t.Errorf("JoinMeeting() entry = %+v, want note and project of the meeting", entry)
+	}
+
+	// user with a running timer does not become a participant
+	if _, err := db.StartTracking("2", "other work", ""); err != nil {
+		t.Fatalf("StartTracking() error = %v", err)
+	}
+	if _, err := db.JoinMeeting(meeting, "2"); err == nil {
+		t.Error("JoinMeeting() with running timer succeeded")
+	}
+
+	// joining twice fails on the participant and must not leave a new entry behind
+	if _, err := db.StopTracking("1"); err != nil {
+		t.Fatalf("StopTracking() error = %v", err)
+	}
+	if _, err := db.JoinMeeting(meeting, "1"); err == nil {
+		t.Error("second JoinMeeting() succeeded")
+	}
+	if active, _ := db.hasActiveEntry("1"); active {
+		t.Error("entry of failed join was stored")
+	}
+
+	participants, err := db.GetMeetingParticipants(meeting.ID)
+	if err != nil {
+		t.Fatalf("GetMeetingParticipants() error = %v", err)
+	}
+	if len(participants) != 1 || participants[0].UserID != "1" || participants[0].EntryID != entry.ID {
+		t.Errorf("GetMeetingParticipants() = %+v, want only user 1 with entry %d", participants, entry.ID)
+	}
+}
+
+func TestVisibleTrackers(t *testing.T) {
+	b := &Bot{db: newTestDatabase(t), cfg: &Config{Timezone: time.UTC}}
+
+	group := &tgbotapi.Chat{ID: -100, Type: "group"}
+	for _, member := range []ChatMember{{ChatID: group.ID, UserID: "1", Name: "Ana"}, {ChatID: group.ID, UserID: "2", Name: "Bob"}} {
+		if err := b.db.SaveChatMember(member); err != nil {
+			t.Fatalf("SaveChatMember() error = %v", err)
+		}
+	}
+	for _, userID := range []string{"1", "2", "3"} {
+		if _, err := b.db.StartTracking(userID, "note of "+userID, ""); err != nil {
+			t.Fatalf("StartTracking() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		chat   *tgbotapi.Chat
+		userID string
+		want   []string
+	}{
+		{"group members", group, "3", []string{"1", "2"}},
+		{"private chat", &tgbotapi.Chat{ID: 3, Type: "private"}, "3", []string{"3"}},
+		{"private chat without timer", &tgbotapi.Chat{ID: 4, Type: "private"}, "4", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trackers, err := b.visibleTrackers(tt.chat, tt.userID)
+			if err != nil {
+				t.Fatalf("visibleTrackers() error = %v", err)
+			}
+
+			var got []string
+			for _, tracker := range trackers {
+				got = append(got, tracker.UserID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("visibleTrackers() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("visibleTrackers() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
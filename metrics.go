@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcomes of bot commands counted in metrics
+const (
+	OutcomeOK        = "ok"
+	OutcomeError     = "error"
+	OutcomeForbidden = "forbidden"
+	OutcomeUnknown   = "unknown"
+	OutcomePanic     = "panic"
+)
+
+// Upper bounds of HTTP latency histogram buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	countActiveEntriesSQL     = `SELECT COUNT(*) FROM entries WHERE active = 1 AND deleted_at IS NULL`
+	countUnimportedEntriesSQL = `SELECT COUNT(*) FROM entries WHERE imported_at IS NULL AND deleted_at IS NULL`
+)
+
+// Counters of bot and API activity, exposed on /metrics in Prometheus
+// text format. Gauges are read from database when metrics are scraped.
+type Metrics struct {
+	mu           sync.Mutex
+	commands     map[[2]string]uint64
+	requests     map[[3]string]uint64
+	latencies    map[string]*histogram
+	sendFailures map[string]uint64
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		commands:     make(map[[2]string]uint64),
+		requests:     make(map[[3]string]uint64),
+		latencies:    make(map[string]*histogram),
+		sendFailures: make(map[string]uint64),
+	}
+}
+
+// Counts handled bot command. Unknown commands are counted under one name,
+// so users can not create new series by sending made up commands.
+func (m *Metrics) CommandHandled(command string, outcome string) {
+	if outcome == OutcomeUnknown {
+		command = "unknown"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands[[2]string{command, outcome}]++
+}
+
+// Log handler remembering whether an error was logged. Handlers of bot
+// commands log their failures, so this tells failed commands apart.
+type failureHandler struct {
+	slog.Handler
+	failed *atomic.Bool
+}
+
+// Wraps logger of command, the returned flag is set once it logs an error
+func trackFailures(logger *slog.Logger) (*slog.Logger, *atomic.Bool) {
+	failed := &atomic.Bool{}
+	return slog.New(failureHandler{Handler: logger.Handler(), failed: failed}), failed
+}
+
+// Errors are always handled, so they are noticed also when LOG_LEVEL
+// hides them
+func (h failureHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || h.Handler.Enabled(ctx, level)
+}
+
+func (h failureHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		h.failed.Store(true)
+	}
+	if !h.Handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h failureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return failureHandler{Handler: h.Handler.WithAttrs(attrs), failed: h.failed}
+}
+
+func (h failureHandler) WithGroup(name string) slog.Handler {
+	return failureHandler{Handler: h.Handler.WithGroup(name), failed: h.failed}
+}
+
+// Counts HTTP request and its latency. Route is the pattern which matched
+// the request, empty for requests matching no route.
+func (m *Metrics) RequestHandled(route string, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[[3]string{route, method, strconv.Itoa(status)}]++
+
+	h, ok := m.latencies[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[route] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Counts failed call of Telegram API, method is e.g. "send_message"
+func (m *Metrics) SendFailed(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sendFailures[method]++
+}
+
+// Wraps API routes to count requests and their latency by route pattern
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// mux sets pattern of matched route on the request
+		m.RequestHandled(r.Pattern, r.Method, recorder.status, time.Since(start))
+	})
+}
+
+// Writes all metrics in Prometheus text format
+func (m *Metrics) writeText(w io.Writer, gauges MetricGauges) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP timetick_bot_commands_total Bot commands handled by command and outcome.")
+	fmt.Fprintln(w, "# TYPE timetick_bot_commands_total counter")
+	for _, key := range sortedKeys(m.commands) {
+		fmt.Fprintf(w, "timetick_bot_commands_total{command=%s,outcome=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.commands[key])
+	}
+
+	fmt.Fprintln(w, "# HELP timetick_telegram_send_failures_total Failed calls of Telegram API by method.")
+	fmt.Fprintln(w, "# TYPE timetick_telegram_send_failures_total counter")
+	for _, method := range sortedKeys(m.sendFailures) {
+		fmt.Fprintf(w, "timetick_telegram_send_failures_total{method=%s} %d\n", quoteLabel(method), m.sendFailures[method])
+	}
+
+	fmt.Fprintln(w, "# HELP timetick_http_requests_total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE timetick_http_requests_total counter")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "timetick_http_requests_total{route=%s,method=%s,status=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), quoteLabel(key[2]), m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP timetick_http_request_duration_seconds Latency of HTTP requests by route.")
+	fmt.Fprintln(w, "# TYPE timetick_http_request_duration_seconds histogram")
+	for _, route := range sortedKeys(m.latencies) {
+		h := m.latencies[route]
+		label := quoteLabel(route)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "timetick_http_request_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "timetick_http_request_duration_seconds_bucket{route=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(w, "timetick_http_request_duration_seconds_sum{route=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "timetick_http_request_duration_seconds_count{route=%s} %d\n", label, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP timetick_active_timers Running timers.")
+	fmt.Fprintln(w, "# TYPE timetick_active_timers gauge")
+	fmt.Fprintf(w, "timetick_active_timers %d\n", gauges.ActiveTimers)
+
+	fmt.Fprintln(w, "# HELP timetick_unimported_entries Entries not imported through the API yet.")
+	fmt.Fprintln(w, "# TYPE timetick_unimported_entries gauge")
+	fmt.Fprintf(w, "timetick_unimported_entries %d\n", gauges.UnimportedEntries)
+}
+
+// Values of gauges read from database
+type MetricGauges struct {
+	ActiveTimers      int
+	UnimportedEntries int
+}
+
+func (db *Database) GetMetricGauges() (MetricGauges, error) {
+	var gauges MetricGauges
+	if err := db.conn.QueryRow(countActiveEntriesSQL).Scan(&gauges.ActiveTimers); err != nil {
+		return gauges, fmt.Errorf("failed to count active entries: %w", err)
+	}
+	if err := db.conn.QueryRow(countUnimportedEntriesSQL).Scan(&gauges.UnimportedEntries); err != nil {
+		return gauges, fmt.Errorf("failed to count unimported entries: %w", err)
+	}
+	return gauges, nil
+}
+
+// Serves metrics to callers presenting the metrics token, which is separate
+// from API tokens so scrapers can not read entries
+func MetricsHandler(metrics *Metrics, db *Database, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			RespondWithError(w, http.StatusUnauthorized, InvalidTokenCode, "Invalid metrics token")
+			return
+		}
+
+		gauges, err := db.GetMetricGauges()
+		if err != nil {
+			requestLogger(r.Context()).Error("failed to read metric gauges", "error", err)
+			RespondWithError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Failed to read metrics.")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writeText(w, gauges)
+	}
+}
+
+// Quotes label value, escaping backslashes, quotes and newlines
+func quoteLabel(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func sortedKeys[K [2]string | [3]string | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Creates bot talking to fake Telegram API which accepts every call
+func newMetricsTestBot(t *testing.T) *Bot {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"timetick_bot"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"chat":{"id":7}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient() error = %v", err)
+	}
+	return &Bot{
+		cfg:     &Config{Timezone: time.UTC},
+		api:     api,
+		db:      newTestDatabase(t),
+		metrics: NewMetrics(),
+		users:   map[int64]string{7: RoleMember, 8: RoleViewer},
+	}
+}
+
+func commandMessage(userID int64, text string) *tgbotapi.Message {
+	command, _, _ := strings.Cut(text, " ")
+	return &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: userID},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}
+}
+
+func TestCommandOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		prepare     func(t *testing.T, b *Bot)
+		userID      int64
+		text        string
+		wantCommand string
+		wantOutcome string
+	}{
+		{"ok", nil, 7, "/help", "help", OutcomeOK},
+		{"unknown", nil, 7, "/made_up", "unknown", OutcomeUnknown},
+		{"forbidden", nil, 8, "/start", "start", OutcomeForbidden},
+		{"error", func(t *testing.T, b *Bot) {
+			if _, err := b.db.conn.Exec(`DROP TABLE conversations`); err != nil {
+				t.Fatal(err)
+			}
+		}, 7, "/cancel", "cancel", OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newMetricsTestBot(t)
+			if tt.prepare != nil {
+				tt.prepare(t, b)
+			}
+
+			b.handleCommand(commandMessage(tt.userID, tt.text), slog.New(slog.DiscardHandler))
+
+			want := map[[2]string]uint64{{tt.wantCommand, tt.wantOutcome}: 1}
+			if fmt.Sprint(b.metrics.commands) != fmt.Sprint(want) {
+				t.Errorf("commands = %v, want %v", b.metrics.commands, want)
+			}
+		})
+	}
+}
+
+func TestTrackFailures(t *testing.T) {
+	var buf bytes.Buffer
+	logger, failed := trackFailures(newLogger(&buf, "json", slog.LevelError+4, nil))
+
+	logger.With("user_id", 7).Warn("no managers")
+	if failed.Load() {
+		t.Fatal("warning marked command as failed")
+	}
+
+	// errors count also when the level hides them
+	logger.With("user_id", 7).Error("failed to save conversation")
+	if !failed.Load() {
+		t.Error("logged error did not mark command as failed")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("record below level was written: %s", buf.String())
+	}
+}
+
+func TestMetricsExposition(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.StartTracking("1", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := NewMetrics()
+	metrics.CommandHandled("start", OutcomeOK)
+	metrics.CommandHandled("start", OutcomeOK)
+	metrics.CommandHandled("cancel", OutcomeError)
+	metrics.CommandHandled("made_up", OutcomeUnknown)
+	metrics.SendFailed("send_message")
+	metrics.RequestHandled("GET /api/entries", http.MethodGet, http.StatusOK, 30*time.Millisecond)
+	metrics.RequestHandled("", http.MethodGet, http.StatusNotFound, time.Millisecond)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"without token", "", http.StatusUnauthorized},
+		{"API token", "Bearer other", http.StatusUnauthorized},
+		{"metrics token", "Bearer scrape", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			MetricsHandler(metrics, db, "scrape")(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := rec.Body.String(); got != wantExposition {
+				t.Errorf("exposition:\n%s\nwant:\n%s", got, wantExposition)
+			}
+		})
+	}
+}
+
+const wantExposition = `# HELP timetick_bot_commands_total Bot commands handled by command and outcome.
+# TYPE timetick_bot_commands_total counter
+timetick_bot_commands_total{command="cancel",outcome="error"} 1
+timetick_bot_commands_total{command="start",outcome="ok"} 2
+timetick_bot_commands_total{command="unknown",outcome="unknown"} 1
+# HELP timetick_telegram_send_failures_total Failed calls of Telegram API by method.
+# TYPE timetick_telegram_send_failures_total counter
+timetick_telegram_send_failures_total{method="send_message"} 1
+# HELP timetick_http_requests_total HTTP requests by route, method and status.
+# TYPE timetick_http_requests_total counter
+timetick_http_requests_total{route="GET /api/entries",method="GET",status="200"} 1
+timetick_http_requests_total{route="unmatched",method="GET",status="404"} 1
+# HELP timetick_http_request_duration_seconds Latency of HTTP requests by route.
+# TYPE timetick_http_request_duration_seconds histogram
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.005"} 0
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.01"} 0
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.025"} 0
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.05"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.1"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.25"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="0.5"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="1"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="2.5"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="5"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="10"} 1
+timetick_http_request_duration_seconds_bucket{route="GET /api/entries",le="+Inf"} 1
+timetick_http_request_duration_seconds_sum{route="GET /api/entries"} 0.03
+timetick_http_request_duration_seconds_count{route="GET /api/entries"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.005"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.01"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.025"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.05"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.1"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.25"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="0.5"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="1"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="2.5"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="5"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="10"} 1
+timetick_http_request_duration_seconds_bucket{route="unmatched",le="+Inf"} 1
+timetick_http_request_duration_seconds_sum{route="unmatched"} 0.001
+timetick_http_request_duration_seconds_count{route="unmatched"} 1
+# HELP timetick_active_timers Running timers.
+# TYPE timetick_active_timers gauge
+timetick_active_timers 1
+# HELP timetick_unimported_entries Entries not imported through the API yet.
+# TYPE timetick_unimported_entries gauge
+timetick_unimported_entries 1
+`
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Ordered list of schema migrations. Migration at index i brings the
+// database to version i+1, which is stored in SQLite's user_version pragma.
+//
+// Never edit or reorder existing migrations, only append new ones.
+var migrations = []string{
+	// 1: initial schema
+	createEntriesTableSQL + ";" + createApiTokensTableSQL,
+
+	// 2: projects on entries and persistent conversation state
+	`ALTER TABLE entries ADD COLUMN project TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS conversations (
+  user_id TEXT PRIMARY KEY,
+  chat_id INTEGER NOT NULL,
+  state TEXT NOT NULL,
+  data TEXT NOT NULL DEFAULT '{}',
+  expires_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// 3: per-user settings and reminders for long running timers
+	`ALTER TABLE entries ADD COLUMN reminded_at TIMESTAMP DEFAULT NULL;
+	CREATE TABLE IF NOT EXISTS user_settings (
+  user_id TEXT PRIMARY KEY,
+  reminder_after INTEGER,
+  auto_stop_after INTEGER,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// 4: timezone and digest preferences
+	`ALTER TABLE user_settings ADD COLUMN timezone TEXT;
+	ALTER TABLE user_settings ADD COLUMN digest_enabled BOOLEAN;
+	ALTER TABLE user_settings ADD COLUMN digest_time TEXT;
+	ALTER TABLE user_settings ADD COLUMN weekly_digest_enabled BOOLEAN;
+	ALTER TABLE user_settings ADD COLUMN digest_sent_on TEXT;
+	ALTER TABLE user_settings ADD COLUMN weekly_digest_sent_on TEXT`,
+
+	// 5: expected working hours and nudges when timer was not started
+	`CREATE TABLE IF NOT EXISTS work_schedules (
+  user_id TEXT NOT NULL,
+  weekday INTEGER NOT NULL,
+  start_time TEXT NOT NULL,
+  end_time TEXT NOT NULL,
+  PRIMARY KEY (user_id, weekday)
+	);
+	ALTER TABLE user_settings ADD COLUMN nudge_after INTEGER;
+	ALTER TABLE user_settings ADD COLUMN nudge_sent_on TEXT`,
+
+	// 6: focus sessions and breaks
+	`CREATE TABLE IF NOT EXISTS focus_sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id TEXT NOT NULL,
+  chat_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  entry_id INTEGER,
+  note TEXT NOT NULL DEFAULT '',
+  duration INTEGER NOT NULL,
+  started_at TIMESTAMP NOT NULL,
+  ends_at TIMESTAMP NOT NULL,
+  status TEXT NOT NULL
+	)`,
+
+	// 7: projects with their clients and email of users for export files
+	`CREATE TABLE IF NOT EXISTS projects (
+  name TEXT PRIMARY KEY,
+  client TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE user_settings ADD COLUMN email TEXT;`,
+
+	// 8: import batches which can be rolled back
+	`ALTER TABLE entries ADD COLUMN import_batch TEXT DEFAULT NULL;
+	CREATE TABLE IF NOT EXISTS import_batches (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  format TEXT NOT NULL,
+  source TEXT NOT NULL DEFAULT '',
+  entry_count INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  rolled_back_at TIMESTAMP DEFAULT NULL
+	)`,
+
+	// 9: billable flag and hourly rates with effective dates
+	`ALTER TABLE entries ADD COLUMN billable BOOLEAN NOT NULL DEFAULT 1;
+	CREATE TABLE IF NOT EXISTS rates (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id TEXT NOT NULL DEFAULT '',
+  project TEXT NOT NULL DEFAULT '',
+  client TEXT NOT NULL DEFAULT '',
+  hourly_cents INTEGER NOT NULL,
+  effective_from TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, project, client, effective_from)
+	)`,
+
+	// 10: rounding policy of projects, empty uses the global policy
+	`ALTER TABLE projects ADD COLUMN rounding TEXT NOT NULL DEFAULT ''`,
+
+	// 11: project budgets and owners receiving budget alerts
+	`ALTER TABLE projects ADD COLUMN budget_kind TEXT NOT NULL DEFAULT '';
+	ALTER TABLE projects ADD COLUMN budget_amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE projects ADD COLUMN budget_alerted INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE projects ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+
+	// 12: group chats with their members, default projects and shared meetings
+	`CREATE TABLE IF NOT EXISTS chat_members (
+  chat_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  last_seen TIMESTAMP NOT NULL,
+  PRIMARY KEY (chat_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS chat_settings (
+  chat_id INTEGER PRIMARY KEY,
+  default_project TEXT NOT NULL DEFAULT '',
+  updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS meetings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  chat_id INTEGER NOT NULL,
+  message_id INTEGER NOT NULL DEFAULT 0,
+  note TEXT NOT NULL DEFAULT '',
+  project TEXT NOT NULL DEFAULT '',
+  started_by TEXT NOT NULL,
+  started_at TIMESTAMP NOT NULL,
+  ended_at TIMESTAMP DEFAULT NULL
+	);
+	CREATE TABLE IF NOT EXISTS meeting_participants (
+  meeting_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  entry_id INTEGER NOT NULL,
+  joined_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (meeting_id, user_id)
+	)`,
+
+	// 13: users allowed to use the bot with their roles
+	`CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY,
+  role TEXT NOT NULL,
+  added_by TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL
+	)`,
+
+	// 14: invite codes registering new users with a role
+	`CREATE TABLE IF NOT EXISTS invites (
+  code TEXT PRIMARY KEY,
+  role TEXT NOT NULL,
+  max_uses INTEGER NOT NULL DEFAULT 1,
+  uses INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP NOT NULL,
+  created_by TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL
+	)`,
+
+	// 15: weekly timesheets submitted for review, approved weeks are locked
+	`CREATE TABLE IF NOT EXISTS timesheets (
+  user_id TEXT NOT NULL,
+  week TEXT NOT NULL,
+  period_start TIMESTAMP NOT NULL,
+  period_end TIMESTAMP NOT NULL,
+  state TEXT NOT NULL,
+  submitted_at TIMESTAMP DEFAULT NULL,
+  reviewed_by TEXT NOT NULL DEFAULT '',
+  reviewed_at TIMESTAMP DEFAULT NULL,
+  comment TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (user_id, week)
+	)`,
+
+	// 16: append-only audit log of entry and token changes
+	`CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at TIMESTAMP NOT NULL,
+  actor TEXT NOT NULL,
+  action TEXT NOT NULL,
+  entity TEXT NOT NULL,
+  entity_id TEXT NOT NULL,
+  before TEXT,
+  after TEXT
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_entity ON audit_log (entity, entity_id);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+
+	// 17: soft deleted entries and undo records
+	`ALTER TABLE entries ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
+	ALTER TABLE audit_log ADD COLUMN undone_id INTEGER;
+	CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor, id)`,
+
+	// 18: indexes of frequent entry lookups, ranges are filtered by unixepoch of start
+	`CREATE INDEX IF NOT EXISTS entries_user_start ON entries (user_id, unixepoch(start_time));
+	CREATE INDEX IF NOT EXISTS entries_start ON entries (unixepoch(start_time));
+	CREATE INDEX IF NOT EXISTS entries_active ON entries (active, user_id);
+	CREATE INDEX IF NOT EXISTS entries_imported_at ON entries (imported_at);
+	CREATE INDEX IF NOT EXISTS entries_import_batch ON entries (import_batch)`,
+}
+
+// Gets current schema version of the database
+func (db *Database) SchemaVersion() (int, error) {
+	var version int
+	if err := db.conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Applies every migration newer than the current schema version.
+// Each migration runs in its own transaction together with the version bump.
+func (db *Database) migrate() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA does not support placeholders
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to set schema version %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
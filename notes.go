@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix of encrypted notes, followed by ID of the key and base64 of nonce
+// and sealed note, e.g. "enc:v1:1a2b3c4d:..."
+const encryptedNotePrefix = "enc:v1:"
+
+// Length of note encryption keys, they are AES-256 keys
+const noteKeySize = 32
+
+// Keys of note encryption. Current key encrypts new notes, retired keys
+// were replaced by rekey and only decrypt notes the append-only audit log
+// keeps from before.
+type NoteKeys struct {
+	Current []byte
+	Retired [][]byte
+}
+
+// Encrypts entry notes stored in database with AES-GCM. Notes stored before
+// encryption was enabled are read as they are.
+type NoteCipher struct {
+	// nil when new notes are stored in plain text
+	aead  cipher.AEAD
+	keyID string
+	// ciphers of retired keys by key ID
+	retired map[string]cipher.AEAD
+}
+
+const (
+	getLastEncryptedNoteSQL   = `SELECT note FROM entries WHERE note LIKE 'enc:%' ORDER BY id DESC LIMIT 1`
+	getConversationDataSQL    = `SELECT user_id, data FROM conversations`
+	updateConversationDataSQL = `UPDATE conversations SET data = ? WHERE user_id = ?`
+)
+
+// Creates cipher of keys, returns nil if there are none
+func NewNoteCipher(keys NoteKeys) (*NoteCipher, error) {
+	if keys.Current == nil && len(keys.Retired) == 0 {
+		return nil, nil
+	}
+
+	c := &NoteCipher{retired: make(map[string]cipher.AEAD)}
+	if keys.Current != nil {
+		aead, keyID, err := newNoteAEAD(keys.Current)
+		if err != nil {
+			return nil, err
+		}
+		c.aead, c.keyID = aead, keyID
+	}
+	for _, key := range keys.Retired {
+		aead, keyID, err := newNoteAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("retired key: %w", err)
+		}
+		if keyID != c.keyID {
+			c.retired[keyID] = aead
+		}
+	}
+	return c, nil
+}
+
+func newNoteAEAD(key []byte) (cipher.AEAD, string, error) {
+	if len(key) != noteKeySize {
+		return nil, "", fmt.Errorf("note encryption key must have %d bytes, got %d", noteKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create note cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create note cipher: %w", err)
+	}
+
+	// key ID tells which key encrypted a note without revealing the key
+	sum := sha256.Sum256(key)
+	return aead, hex.EncodeToString(sum[:4]), nil
+}
+
+// Gets ID of the key encrypting new notes, empty if notes are stored in plain text
+func (c *NoteCipher) KeyID() string {
+	if c == nil {
+		return ""
+	}
+	return c.keyID
+}
+
+// Parses base64 encoded key given in config or key file
+func parseNoteKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("note encryption key must be base64 encoded: %w", err)
+	}
+	if len(key) != noteKeySize {
+		return nil, fmt.Errorf("note encryption key must have %d bytes, got %d", noteKeySize, len(key))
+	}
+	return key, nil
+}
+
+// Reads base64 encoded key from file
+func readNoteKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note key file: %w", err)
+	}
+	return parseNoteKey(string(data))
+}
+
+// Parses base64 encoded keys separated by commas or new lines, empty
+// values are skipped
+func parseNoteKeys(value string) ([][]byte, error) {
+	var keys [][]byte
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		key, err := parseNoteKey(field)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func isEncryptedNote(value string) bool {
+	return strings.HasPrefix(value, encryptedNotePrefix)
+}
+
+// Encrypts note for storing. Nil cipher and empty notes store the note as it is.
+func (c *NoteCipher) Encrypt(note string) (string, error) {
+	if c == nil || c.aead == nil || note == "" {
+		return note, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt note: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(note), []byte(c.keyID))
+	return encryptedNotePrefix + c.keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypts stored note. Notes which are not encrypted are returned as they are.
+func (c *NoteCipher) Decrypt(value string) (string, error) {
+	if !isEncryptedNote(value) {
+		return value, nil
+	}
+
+	keyID, data, ok := strings.Cut(strings.TrimPrefix(value, encryptedNotePrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted note")
+	}
+	if c == nil {
+		return "", fmt.Errorf("note is encrypted with key %s but no note encryption key is configured", keyID)
+	}
+	aead := c.retired[keyID]
+	if keyID == c.keyID && c.aead != nil {
+		aead = c.aead
+	}
+	if aead == nil {
+		return "", fmt.Errorf("note is encrypted with key %s, configured key is %q and it is not a retired key", keyID, c.keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted note")
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	note, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt note: %w", err)
+	}
+	return string(note), nil
+}
+
+// Decrypts note of entry in place
+func (db *Database) decryptNote(entry *Entry) error {
+	note, err := db.notes.Decrypt(entry.Note)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", entry.ID, err)
+	}
+	entry.Note = note
+	return nil
+}
+
+// Decrypts notes of scanned entries, passing through error of the scan
+func (db *Database) decryptNotes(entries []Entry, err error) ([]Entry, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if err := db.decryptNote(&entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Decrypts notes in entry states of audit records. States are never
+// rewritten, so notes from before a rekey need the old key among retired
+// keys; a note none of the keys can read is left as stored.
+func (db *Database) decryptAuditNotes(records []AuditRecord) {
+	for i := range records {
+		if records[i].Entity != AuditEntry {
+			continue
+		}
+		records[i].Before = db.decryptStateNote(records[i].Before)
+		records[i].After = db.decryptStateNote(records[i].After)
+	}
+}
+
+func (db *Database) decryptStateNote(state json.RawMessage) json.RawMessage {
+	var fields map[string]any
+	if state == nil || json.Unmarshal(state, &fields) != nil {
+		return state
+	}
+	stored, _ := fields["note"].(string)
+	if !isEncryptedNote(stored) {
+		return state
+	}
+	note, err := db.notes.Decrypt(stored)
+	if err != nil {
+		return state
+	}
+
+	fields["note"] = note
+	decrypted, err := json.Marshal(fields)
+	if err != nil {
+		return state
+	}
+	return decrypted
+}
+
+// Tables with note column holding notes encrypted with the configured key
+var noteTables = []string{"entries", "focus_sessions", "meetings"}
+
+// Re-encrypts all stored notes with new cipher: notes of entries, including
+// deleted ones, of focus sessions, meetings and pending conversations.
+// Notes must be readable with the current cipher; plain notes are encrypted
+// too. Nil new cipher stores notes decrypted. The audit log is append-only
+// and keeps states with the old key, which stays readable as a retired key.
+// Returns number of changed notes.
+func (db *Database) RekeyNotes(actor string, next *NoteCipher) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to rekey notes: %w", err)
+	}
+	defer tx.Rollback()
+
+	rekey := func(stored string) (string, error) {
+		note, err := db.notes.Decrypt(stored)
+		if err != nil {
+			return "", err
+		}
+		return next.Encrypt(note)
+	}
+
+	count := 0
+	for _, table := range noteTables {
+		notes, err := queryNotes(tx, `SELECT id, note FROM `+table+` WHERE note != ''`)
+		if err != nil {
+			return 0, err
+		}
+		for id, stored := range notes {
+			value, err := rekey(stored)
+			if err != nil {
+				return 0, fmt.Errorf("note %d of %s: %w", id, table, err)
+			}
+			if _, err := tx.Exec(`UPDATE `+table+` SET note = ? WHERE id = ?`, value, id); err != nil {
+				return 0, fmt.Errorf("failed to update note %d of %s: %w", id, table, err)
+			}
+		}
+		count += len(notes)
+	}
+
+	conversations, err := rekeyConversations(tx, rekey)
+	if err != nil {
+		return 0, err
+	}
+	count += conversations
+
+	if err := writeAudit(tx, actor, "rekey", AuditNotes, next.KeyID(), nil, map[string]any{"notes": count, "retired_key": db.notes.KeyID()}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to rekey notes: %w", err)
+	}
+	db.notes = next.retiring(db.notes)
+	return count, nil
+}
+
+// Gets copy of cipher which also decrypts notes of the previous cipher,
+// whose keys become retired
+func (c *NoteCipher) retiring(previous *NoteCipher) *NoteCipher {
+	if previous == nil {
+		return c
+	}
+
+	next := &NoteCipher{retired: make(map[string]cipher.AEAD)}
+	if c != nil {
+		next.aead, next.keyID = c.aead, c.keyID
+		for keyID, aead := range c.retired {
+			next.retired[keyID] = aead
+		}
+	}
+	for keyID, aead := range previous.retired {
+		next.retired[keyID] = aead
+	}
+	if previous.aead != nil {
+		next.retired[previous.keyID] = previous.aead
+	}
+	delete(next.retired, next.keyID)
+	return next
+}
+
+// Gets notes keyed by ID selected with query of id and note columns
+func queryNotes(tx *sql.Tx, query string) (map[int64]string, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var note string
+		if err := rows.Scan(&id, &note); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		notes[id] = note
+	}
+	return notes, rows.Err()
+}
+
+// Re-encrypts notes of pending conversations. Returns number of changed notes.
+func rekeyConversations(tx *sql.Tx, rekey func(string) (string, error)) (int, error) {
+	rows, err := tx.Query(getConversationDataSQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get conversations: %w", err)
+	}
+	conversations := make(map[string]ConversationData)
+	for rows.Next() {
+		var userID, data string
+		var conv ConversationData
+		if err := rows.Scan(&userID, &data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &conv); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode conversation of user %s: %w", userID, err)
+		}
+		if conv.Note != "" {
+			conversations[userID] = conv
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get conversations: %w", err)
+	}
+
+	for userID, conv := range conversations {
+		if conv.Note, err = rekey(conv.Note); err != nil {
+			return 0, fmt.Errorf("conversation of user %s: %w", userID, err)
+		}
+		data, err := json.Marshal(conv)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode conversation data: %w", err)
+		}
+		if _, err := tx.Exec(updateConversationDataSQL, string(data), userID); err != nil {
+			return 0, fmt.Errorf("failed to update conversation of user %s: %w", userID, err)
+		}
+	}
+	return len(conversations), nil
+}
+
+// Checks that configured key can read notes, so a wrong key is noticed on
+// startup rather than by failing reports
+func (db *Database) checkNoteKey() error {
+	var note string
+	err := db.conn.QueryRow(getLastEncryptedNoteSQL).Scan(&note)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check note encryption key: %w", err)
+	}
+	if _, err := db.notes.Decrypt(note); err != nil {
+		return fmt.Errorf("failed to read notes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNoteKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, noteKeySize)
+}
+
+func TestNoteCipher(t *testing.T) {
+	cipher, err := NewNoteCipher(NoteKeys{Current: testNoteKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewNoteCipher(NoteKeys{Current: testNoteKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewNoteCipher(NoteKeys{Current: testNoteKey(2), Retired: [][]byte{testNoteKey(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredOnly, err := NewNoteCipher(NoteKeys{Retired: [][]byte{testNoteKey(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := cipher.Encrypt("Ticket ACME-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := cipher.Encrypt("Ticket ACME-42")
+	tampered := encrypted[:len(encrypted)-4] + "AAA="
+
+	tests := []struct {
+		name    string
+		cipher  *NoteCipher
+		stored  string
+		want    string
+		wantErr string
+	}{
+		{"round trip", cipher, encrypted, "Ticket ACME-42", ""},
+		{"plain note", cipher, "Plain note", "Plain note", ""},
+		{"plain note without key", nil, "Plain note", "Plain note", ""},
+		{"empty note", cipher, "", "", ""},
+		{"wrong key", other, encrypted, "", "it is not a retired key"},
+		{"retired key", rotated, encrypted, "Ticket ACME-42", ""},
+		{"retired key without current key", retiredOnly, encrypted, "Ticket ACME-42", ""},
+		{"no key", nil, encrypted, "", "no note encryption key is configured"},
+		{"tampered", cipher, tampered, "", "failed to decrypt note"},
+		{"malformed", cipher, encryptedNotePrefix + "nokeyid", "", "malformed encrypted note"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cipher.Decrypt(tt.stored)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decrypt() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Decrypt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if encrypted == again {
+		t.Error("same note encrypted twice gives the same value")
+	}
+	if empty, _ := cipher.Encrypt(""); empty != "" {
+		t.Errorf("Encrypt(\"\") = %q, want empty", empty)
+	}
+	if plain, _ := retiredOnly.Encrypt("note"); plain != "note" {
+		t.Errorf("Encrypt() without current key = %q, want plain text", plain)
+	}
+	if none, err := NewNoteCipher(NoteKeys{}); none != nil || err != nil {
+		t.Errorf("NewNoteCipher() without keys = %v, %v, want nil", none, err)
+	}
+}
+
+func TestParseNoteKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", false},
+		{"valid with newline", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n", false},
+		{"short", "AQEBAQ==", true},
+		{"not base64", "not a key!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseNoteKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNoteKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNoteKeys(t *testing.T) {
+	one, two := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="
+
+	keys, err := parseNoteKeys(one + "," + two + "\n\n")
+	if err != nil || len(keys) != 2 || keys[1][0] != 2 {
+		t.Errorf("parseNoteKeys() = %v, %v, want two keys", keys, err)
+	}
+	if _, err := parseNoteKeys(one + ",short"); err == nil {
+		t.Error("parseNoteKeys() with invalid key succeeded")
+	}
+}
+
+func TestNotesOfSessionsAreEncrypted(t *testing.T) {
+	db := newTestDatabaseWithKeys(t, NoteKeys{Current: testNoteKey(1)})
+
+	session := FocusSession{UserID: "1", ChatID: 1, Kind: "focus", Note: "Focus note", StartedAt: time.Now(), EndsAt: time.Now(), Status: "running"}
+	if err := db.CreateFocusSession(&session); err != nil {
+		t.Fatal(err)
+	}
+	meeting := Meeting{ChatID: 1, Note: "Meeting note", StartedBy: "1", StartedAt: time.Now()}
+	if err := db.CreateMeeting(&meeting); err != nil {
+		t.Fatal(err)
+	}
+	conv := Conversation{UserID: "1", ChatID: 1, State: StateAwaitingNote, Data: ConversationData{Note: "Prompt note"}, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.SaveConversation(&conv); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, note := range map[string]string{
+		`SELECT note FROM focus_sessions`: "Focus note",
+		`SELECT note FROM meetings`:       "Meeting note",
+		`SELECT data FROM conversations`:  "Prompt note",
+	} {
+		var stored string
+		if err := db.conn.QueryRow(query).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(stored, note) {
+			t.Errorf("%s stores %q in plain text", query, stored)
+		}
+	}
+
+	gotSession, err := db.GetFocusSession(session.ID)
+	if err != nil || gotSession.Note != "Focus note" {
+		t.Errorf("GetFocusSession() = %q, %v", gotSession.Note, err)
+	}
+	gotMeeting, err := db.GetMeeting(meeting.ID)
+	if err != nil || gotMeeting.Note != "Meeting note" {
+		t.Errorf("GetMeeting() = %+v, %v", gotMeeting, err)
+	}
+	gotConv, err := db.GetConversation("1")
+	if err != nil || gotConv.Data.Note != "Prompt note" {
+		t.Errorf("GetConversation() = %+v, %v", gotConv, err)
+	}
+}
+
+func TestRekeyNotes(t *testing.T) {
+	db := newTestDatabaseWithKeys(t, NoteKeys{Current: testNoteKey(1)})
+
+	if _, err := db.StartTracking("1", "Client work", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StopTracking("1"); err != nil {
+		t.Fatal(err)
+	}
+	meeting := Meeting{ChatID: 1, Note: "Standup", StartedBy: "1", StartedAt: time.Now()}
+	if err := db.CreateMeeting(&meeting); err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog := func() string {
+		var log string
+		if err := db.conn.QueryRow(`SELECT group_concat(id || COALESCE(before, '') || COALESCE(after, ''), '|') FROM audit_log`).Scan(&log); err != nil {
+			t.Fatal(err)
+		}
+		return log
+	}
+	history := auditLog()
+
+	next, err := NewNoteCipher(NoteKeys{Current: testNoteKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := db.RekeyNotes(ActorCLI, next)
+	if err != nil {
+		t.Fatalf("RekeyNotes() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("RekeyNotes() = %d, want 2", count)
+	}
+
+	// history is left as it was, only the rekey itself is appended
+	if got := auditLog(); !strings.HasPrefix(got, history+"|") {
+		t.Errorf("audit log changed by rekey:\n%s\nwant prefix\n%s", got, history)
+	}
+
+	var stored string
+	if err := db.conn.QueryRow(`SELECT note FROM entries`).Scan(&stored); err != nil || !strings.Contains(stored, next.KeyID()) {
+		t.Errorf("entry note = %q, %v, want encrypted with key %s", stored, err, next.KeyID())
+	}
+
+	// the old key is retired, so history stays readable
+	records, err := db.GetAuditLog(AuditFilter{Entity: AuditEntry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.decryptAuditNotes(records)
+	for _, record := range records {
+		for _, state := range []json.RawMessage{record.Before, record.After} {
+			if bytes.Contains(state, []byte(encryptedNotePrefix)) {
+				t.Errorf("audit record %d still has encrypted note: %s", record.ID, state)
+			}
+		}
+	}
+
+	// states recorded with the old key still match the rekeyed entry
+	if _, err := db.UndoLastAction("1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("UndoLastAction() after rekey error = %v", err)
+	}
+
+	if _, err := db.RekeyNotes(ActorCLI, nil); err != nil {
+		t.Fatalf("RekeyNotes() to plain text error = %v", err)
+	}
+	if err := db.conn.QueryRow(`SELECT note FROM meetings`).Scan(&stored); err != nil || stored != "Standup" {
+		t.Errorf("meeting note = %q, %v, want plain text", stored, err)
+	}
+	if _, err := db.UndoLastAction("1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("UndoLastAction() after decrypting error = %v", err)
+	}
+}
+
+func TestRetiredKeysReadHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDatabase(path, NoteKeys{Current: testNoteKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartTracking("1", "Client work", ""); err != nil {
+		t.Fatal(err)
+	}
+	next, _ := NewNoteCipher(NoteKeys{Current: testNoteKey(2)})
+	if _, err := db.RekeyNotes(ActorCLI, next); err != nil {
+		t.Fatal(err)
+	}
+	db.conn.Close()
+
+	tests := []struct {
+		name    string
+		retired [][]byte
+		want    string
+	}{
+		{"old key retired", [][]byte{testNoteKey(1)}, `"note":"Client work"`},
+		{"old key missing", nil, `"note":"` + encryptedNotePrefix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewDatabase(path, NoteKeys{Current: testNoteKey(2), Retired: tt.retired})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.conn.Close()
+
+			records, err := db.GetAuditLog(AuditFilter{Entity: AuditEntry, Limit: 1})
+			if err != nil || len(records) != 1 {
+				t.Fatalf("GetAuditLog() = %v, %v", records, err)
+			}
+			db.decryptAuditNotes(records)
+			if !strings.Contains(string(records[0].After), tt.want) {
+				t.Errorf("start record = %s, want %s", records[0].After, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Project entries can be tracked on. Projects are referenced by name from
+// entries, so a project row exists only when it carries extra information.
+type Project struct {
+	Name   string
+	Client string
+	// Rounding policy overriding the global one, e.g. "up 15m"
+	Rounding string
+}
+
+const (
+	getProjectsSQL        = `SELECT name, client, rounding FROM projects ORDER BY name`
+	upsertProjectClient   = `INSERT INTO projects (name, client) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET client = excluded.client`
+	upsertProjectRounding = `INSERT INTO projects (name, rounding) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET rounding = excluded.rounding`
+	getTrackedProjects    = `SELECT DISTINCT project FROM entries WHERE project != '' AND deleted_at IS NULL ORDER BY project`
+)
+
+// Gets all projects with extra information
+func (db *Database) GetProjects() ([]Project, error) {
+	rows, err := db.conn.Query(getProjectsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []Project
+	for rows.Next() {
+		var project Project
+		if err := rows.Scan(&project.Name, &project.Client, &project.Rounding); err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, rows.Err()
+}
+
+// Gets client of each project that has one, keyed by project name
+func (db *Database) GetProjectClients() (map[string]string, error) {
+	projects, err := db.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make(map[string]string)
+	for _, project := range projects {
+		if project.Client != "" {
+			clients[project.Name] = project.Client
+		}
+	}
+	return clients, nil
+}
+
+// Assigns client to project, empty client removes the assignment
+func (db *Database) SetProjectClient(project string, client string) error {
+	if _, err := db.conn.Exec(upsertProjectClient, project, client); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	return nil
+}
+
+// Sets rounding policy of project, empty policy uses the global one
+func (db *Database) SetProjectRounding(project string, policy string) error {
+	if _, err := db.conn.Exec(upsertProjectRounding, project, policy); err != nil {
+		return fmt.Errorf("failed to update project %s: %w", project, err)
+	}
+	return nil
+}
+
+// Gets names of all projects that have entries
+func (db *Database) GetTrackedProjects() ([]string, error) {
+	rows, err := db.conn.Query(getTrackedProjects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// Manages projects.
+//
+// Usage:
+//
+//	/project
+//	/project client <project> <client>
+//	/project rounding <project> <policy|default>
+//	/project budget <project> <40h|5000|off>
+//	/project owner <project> <me|user-id>
+//	/project default <project|off>
+func (b *Bot) handleProjectCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+
+	if len(fields) > 0 {
+		action := strings.ToLower(fields[0])
+		role, _ := b.userRole(message.From.ID)
+		if required, ok := projectActionRoles[action]; ok && !roleAllows(role, required) {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("🚫 /project %s requires the %s role.", action, required), message.MessageID)
+			return
+		}
+	}
+
+	switch {
+	case len(fields) == 0:
+		b.sendMessage(message.Chat.ID, b.describeProjects(), message.MessageID)
+	case len(fields) >= 2 && strings.ToLower(fields[0]) == "client":
+		project := fields[1]
+		client := strings.Join(fields[2:], " ")
+		if err := b.db.SetProjectClient(project, client); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if client == "" {
+			b.sendMessage(message.Chat.ID, "📁 Client removed from "+project+".", message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, "📁 "+project+" belongs to "+client+".", message.MessageID)
+	case len(fields) >= 3 && strings.ToLower(fields[0]) == "rounding":
+		project := fields[1]
+		value := strings.Join(fields[2:], " ")
+
+		if strings.EqualFold(value, "default") {
+			if err := b.db.SetProjectRounding(project, ""); err != nil {
+				b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+				return
+			}
+			b.sendMessage(message.Chat.ID, "📁 "+project+" uses default rounding: "+b.cfg.Rounding.String()+".", message.MessageID)
+			return
+		}
+
+		policy, err := parseRoundingPolicy(value)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if err := b.db.SetProjectRounding(project, policy.String()); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, "📁 "+project+" is rounded: "+policy.String()+".", message.MessageID)
+	case len(fields) == 3 && strings.ToLower(fields[0]) == "budget":
+		project := fields[1]
+
+		if strings.EqualFold(fields[2], "off") {
+			if err := b.db.SetProjectBudget(project, "", 0, userID); err != nil {
+				b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+				return
+			}
+			b.sendMessage(message.Chat.ID, "💼 Budget of "+project+" removed.", message.MessageID)
+			return
+		}
+
+		kind, amount, err := parseBudget(fields[2])
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if err := b.db.SetProjectBudget(project, kind, amount, userID); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+
+		text := "💼 Budget of " + project + " set."
+		if usages, err := b.getBudgetUsages(project); err == nil && len(usages) > 0 {
+			text += "\n" + usages[0].Describe(b.cfg.Currency)
+		}
+		b.sendMessage(message.Chat.ID, text, message.MessageID)
+	case len(fields) == 3 && strings.ToLower(fields[0]) == "owner":
+		project := fields[1]
+		owner := fields[2]
+		if strings.EqualFold(owner, "me") {
+			owner = userID
+		} else if _, err := strconv.ParseInt(owner, 10, 64); err != nil {
+			b.sendMessage(message.Chat.ID, "Owner must be 'me' or Telegram user ID.", message.MessageID)
+			return
+		}
+
+		if err := b.db.SetProjectOwner(project, owner); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, "💼 Budget alerts of "+project+" go to "+owner+".", message.MessageID)
+	case len(fields) == 2 && strings.ToLower(fields[0]) == "default":
+		if !isGroupChat(message.Chat) {
+			b.sendMessage(message.Chat.ID, "Default project can be set only in group chats.", message.MessageID)
+			return
+		}
+
+		project := fields[1]
+		if strings.EqualFold(project, "off") {
+			project = ""
+		}
+		if err := b.db.SetChatDefaultProject(message.Chat.ID, project); err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if project == "" {
+			b.sendMessage(message.Chat.ID, "📁 Timers started in this group have no project.", message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, "📁 Timers started in this group are tracked on "+project+".", message.MessageID)
+	default:
+		b.sendMessage(message.Chat.ID, projectUsage, message.MessageID)
+	}
+}
+
+const projectUsage = "Usage:\n" +
+	"/project - List projects\n" +
+	"/project client <project> <client> - Assign client to project (managers only)\n" +
+	"/project rounding <project> <none|nearest|up|down> [increment] [min <duration>] - Round project time, e.g. up 15m (managers only)\n" +
+	"/project rounding <project> default - Use default rounding (managers only)\n" +
+	"/project budget <project> <40h|5000|off> - Set hour or money budget (managers only)\n" +
+	"/project owner <project> <me|user-id> - Set who receives budget alerts (managers only)\n" +
+	"/project default <project|off> - Set project of timers started in this group"
+
+// Lists tracked and configured projects with their clients
+func (b *Bot) describeProjects() string {
+	tracked, err := b.db.GetTrackedProjects()
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	projects, err := b.db.GetProjects()
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+
+	configured := make(map[string]Project)
+	names := append([]string{}, tracked...)
+	for _, project := range projects {
+		if _, ok := configured[project.Name]; !ok && !containsString(tracked, project.Name) {
+			names = append(names, project.Name)
+		}
+		configured[project.Name] = project
+	}
+
+	if len(names) == 0 {
+		return "There are no projects yet.\n\n" + projectUsage
+	}
+
+	lines := []string{"📁 Projects:"}
+	for _, name := range names {
+		line := "• " + name
+		if client := configured[name].Client; client != "" {
+			line += " (" + client + ")"
+		}
+		if rounding := configured[name].Rounding; rounding != "" {
+			line += ", rounded " + rounding
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Default rounding: "+b.cfg.Rounding.String())
+
+	return strings.Join(lines, "\n") + "\n\n" + projectUsage
+}
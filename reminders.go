@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// What happens to a running timer when timers are checked
+type timerAction int
+
+const (
+	timerKeep timerAction = iota
+	timerRemind
+	timerAutoStop
+)
+
+// Checks running timers, stopping ones that exceeded user's auto-stop cap
+// and reminding users about timers running longer than their reminder duration.
+func (b *Bot) checkLongRunningTimers(now time.Time) {
+	entries, err := b.db.GetActiveEntries()
+	if err != nil {
+		slog.Error("failed to check running timers", "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		settings, err := b.db.GetUserSettings(entry.UserID)
+		if err != nil {
+			slog.Error("failed to get user settings", "user_id", entry.UserID, "error", err)
+			continue
+		}
+
+		switch timerActionFor(entry, settings, b.cfg.ReminderAfter, now) {
+		case timerAutoStop:
+			b.autoStopEntry(entry, settings.AutoStopDuration())
+		case timerRemind:
+			if err := b.db.MarkEntryReminded(entry.ID, now); err != nil {
+				slog.Error("failed to record reminder", "entry_id", entry.ID, "error", err)
+				continue
+			}
+			b.sendReminder(entry, now)
+		}
+	}
+}
+
+// Decides what to do with running entry. Auto-stop cap wins over reminders,
+// which repeat only after another full reminder period.
+func timerActionFor(entry Entry, settings UserSettings, remindAfter time.Duration, now time.Time) timerAction {
+	running := now.Sub(entry.StartTime)
+
+	if limit := settings.AutoStopDuration(); limit > 0 && running >= limit {
+		return timerAutoStop
+	}
+
+	after := settings.ReminderDuration(remindAfter)
+	if after <= 0 {
+		return timerKeep
+	}
+
+	since := entry.StartTime
+	if entry.RemindedAt.Valid {
+		since = entry.RemindedAt.Time
+	}
+	if now.Sub(since) < after {
+		return timerKeep
+	}
+	return timerRemind
+}
+
+// Stops entry at the moment it reached auto-stop cap and notifies user
+func (b *Bot) autoStopEntry(entry Entry, limit time.Duration) {
+	endTime := entry.StartTime.Add(limit)
+	if _, err := b.db.StopEntryAt(ActorSystem, entry.UserID, entry.ID, endTime); err != nil {
+		slog.Error("failed to auto-stop entry", "entry_id", entry.ID, "error", err)
+		return
+	}
+
+	chatID, err := strconv.ParseInt(entry.UserID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	text := fmt.Sprintf("⏹️ Timer was stopped automatically after %s at %s.", formatDuration(limit), endTime.Format("15:04"))
+	b.sendMessage(chatID, text, 0)
+}
+
+// Sends reminder about long running entry with actions for the user
+func (b *Bot) sendReminder(entry Entry, now time.Time) {
+	chatID, err := strconv.ParseInt(entry.UserID, 10, 64)
+	if err != nil {
+		slog.Error("can not send reminder", "user_id", entry.UserID, "error", err)
+		return
+	}
+
+	text := fmt.Sprintf("⏰ Your timer has been running for %s.", formatDuration(now.Sub(entry.StartTime)))
+	if entry.Note != "" {
+		text += "\nNote: " + entry.Note
+	}
+	text += "\nAre you still working?"
+
+	id := strconv.FormatInt(entry.ID, 10)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Still working", "remind:keep:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("Stop now", "remind:stop:"+id),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				"Stop at "+now.Format("15:04"),
+				fmt.Sprintf("remind:stopat:%s:%d", id, now.Unix()),
+			),
+		),
+	)
+
+	b.sendMessageWithKeyboard(chatID, text, keyboard)
+}
+
+// Handles buttons of reminder message.
+//
+// Callback data format:
+//
+//	remind:keep:<entry id>
+//	remind:stop:<entry id>
+//	remind:stopat:<entry id>:<unix time>
+func (b *Bot) handleReminderCallback(query *tgbotapi.CallbackQuery, args []string, logger *slog.Logger) {
+	if len(args) < 2 {
+		b.answerCallback(query, "Invalid action.")
+		return
+	}
+
+	entryID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		b.answerCallback(query, "Invalid action.")
+		return
+	}
+	userID := strconv.FormatInt(query.From.ID, 10)
+
+	var result string
+	switch args[0] {
+	case "keep":
+		entry, found, activeErr := b.db.getActiveEntry(userID)
+		switch {
+		case activeErr != nil:
+			err = activeErr
+		case !found || entry.ID != entryID:
+			err = fmt.Errorf("This timer is not running anymore.")
+		default:
+			err = b.db.MarkEntryReminded(entryID, time.Now())
+		}
+		result = "👍 Timer keeps running."
+	case "stop":
+		_, err = b.db.StopEntryAt(userActor(userID), userID, entryID, time.Now())
+		result = "❌ Timer is stopped."
+	case "stopat":
+		if len(args) < 3 {
+			b.answerCallback(query, "Invalid action.")
+			return
+		}
+		unix, parseErr := strconv.ParseInt(args[2], 10, 64)
+		if parseErr != nil {
+			b.answerCallback(query, "Invalid action.")
+			return
+		}
+		// buttons of old reminders or crafted data must not end timer in the future
+		endTime := time.Unix(unix, 0)
+		if now := time.Now(); endTime.After(now) {
+			endTime = now
+		}
+		_, err = b.db.StopEntryAt(userActor(userID), userID, entryID, endTime)
+		result = "❌ Timer is stopped at " + endTime.Format("15:04") + "."
+	default:
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+
+	if err != nil {
+		b.answerCallback(query, fmt.Sprintf("%s", err))
+		b.removeKeyboard(query.Message)
+		return
+	}
+
+	b.answerCallback(query, "")
+	b.editMessage(query.Message, query.Message.Text+"\n\n"+result)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTimerActionFor(t *testing.T) {
+	now := time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC)
+	seconds := func(d time.Duration) sql.NullInt64 {
+		return sql.NullInt64{Int64: int64(d / time.Second), Valid: true}
+	}
+
+	tests := []struct {
+		name       string
+		running    time.Duration
+		remindedAt time.Duration
+		settings   UserSettings
+		want       timerAction
+	}{
+		{"short timer", time.Hour, 0, UserSettings{}, timerKeep},
+		{"default reminder", 4 * time.Hour, 0, UserSettings{}, timerRemind},
+		{"just below default reminder", 4*time.Hour - time.Second, 0, UserSettings{}, timerKeep},
+		{"reminded recently", 6 * time.Hour, time.Hour, UserSettings{}, timerKeep},
+		{"reminded a period ago", 9 * time.Hour, 4 * time.Hour, UserSettings{}, timerRemind},
+		{"own reminder", 2 * time.Hour, 0, UserSettings{ReminderAfter: seconds(time.Hour)}, timerRemind},
+		{"reminders disabled", 20 * time.Hour, 0, UserSettings{ReminderAfter: seconds(0)}, timerKeep},
+		{"below auto-stop", 7 * time.Hour, 0, UserSettings{AutoStopAfter: seconds(8 * time.Hour)}, timerRemind},
+		{"auto-stop reached", 8 * time.Hour, 0, UserSettings{AutoStopAfter: seconds(8 * time.Hour)}, timerAutoStop},
+		{"auto-stop wins over reminder", 10 * time.Hour, 0, UserSettings{ReminderAfter: seconds(0), AutoStopAfter: seconds(8 * time.Hour)}, timerAutoStop},
+		{"auto-stop disabled", 30 * time.Hour, time.Hour, UserSettings{AutoStopAfter: seconds(0)}, timerKeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := Entry{StartTime: now.Add(-tt.running)}
+			if tt.remindedAt > 0 {
+				entry.RemindedAt = sql.NullTime{Time: now.Add(-tt.remindedAt), Valid: true}
+			}
+			if got := timerActionFor(entry, tt.settings, 4*time.Hour, now); got != tt.want {
+				t.Errorf("timerActionFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopEntryAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		end     time.Duration
+		wantErr bool
+	}{
+		{"now", 0, false},
+		{"in the past", -time.Minute, false},
+		{"before start", -time.Hour, true},
+		{"in the future", time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			now := time.Now()
+			if _, err := db.conn.Exec(createEntrySQL, "1", now.Add(-10*time.Minute), "", ""); err != nil {
+				t.Fatal(err)
+			}
+			entry, _, err := db.getActiveEntry("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stopped, err := db.StopEntryAt(userActor("1"), "1", entry.ID, now.Add(tt.end))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("StopEntryAt() = %+v, want error", stopped)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StopEntryAt() error = %v", err)
+			}
+			if !stopped.EndTime.Valid || !stopped.EndTime.Time.Equal(now.Add(tt.end)) {
+				t.Errorf("StopEntryAt() end = %v, want %v", stopped.EndTime, now.Add(tt.end))
+			}
+		})
+	}
+}
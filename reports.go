@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Tracked time of a user in a period, grouped in several ways.
+type Report struct {
+	From    time.Time
+	To      time.Time
+	Entries []Entry
+	// Entries without end time, their duration is counted until now
+	Open []Entry
+
+	Total     time.Duration
+	ByProject map[string]time.Duration
+	ByNote    map[string]time.Duration
+	// Keyed by local date in YYYY-MM-DD format
+	ByDay map[string]time.Duration
+
+	// Totals after rounding finished entries, equal to raw totals without rounding
+	Rounded          time.Duration
+	RoundedByProject map[string]time.Duration
+
+	// Working time planned by user's schedule, counted until now
+	Planned     time.Duration
+	HasSchedule bool
+
+	FocusCompleted   int
+	FocusInterrupted int
+}
+
+// Single labeled total, used for sorted output
+type ReportTotal struct {
+	Label    string
+	Duration time.Duration
+}
+
+// Gets tracked duration of entry, running entries are counted until now
+func (e Entry) Duration(now time.Time) time.Duration {
+	if e.EndTime.Valid {
+		return e.EndTime.Time.Sub(e.StartTime)
+	}
+	return now.Sub(e.StartTime)
+}
+
+// Builds report from entries started in [from, to). Days are grouped
+// in location of from.
+func BuildReport(entries []Entry, from time.Time, to time.Time, now time.Time) Report {
+	report := Report{
+		From:      from,
+		To:        to,
+		Entries:   entries,
+		ByProject: make(map[string]time.Duration),
+		ByNote:    make(map[string]time.Duration),
+		ByDay:     make(map[string]time.Duration),
+	}
+
+	for _, entry := range entries {
+		if !entry.EndTime.Valid {
+			report.Open = append(report.Open, entry)
+		}
+
+		d := entry.Duration(now)
+		report.Total += d
+		report.ByProject[entry.Project] += d
+		report.ByNote[entry.Note] += d
+		report.ByDay[entry.StartTime.In(from.Location()).Format(time.DateOnly)] += d
+	}
+
+	return report
+}
+
+// Computes rounded totals of report entries
+func (r *Report) applyRounding(rules RoundingRules, now time.Time) {
+	r.Rounded = 0
+	r.RoundedByProject = make(map[string]time.Duration)
+	for _, entry := range r.Entries {
+		d := rules.Duration(entry, now)
+		r.Rounded += d
+		r.RoundedByProject[entry.Project] += d
+	}
+}
+
+// Loads entries and working schedule of user for the period and builds
+// report. Projects without own rounding policy are rounded by fallback.
+func (db *Database) GetReport(userID string, from time.Time, to time.Time, rounding RoundingPolicy) (Report, error) {
+	entries, err := db.GetEntriesBetween(userID, from, to)
+	if err != nil {
+		return Report{}, err
+	}
+
+	now := time.Now()
+	report := BuildReport(entries, from, to, now)
+
+	rules, err := db.GetRoundingRules(rounding)
+	if err != nil {
+		return Report{}, err
+	}
+	report.applyRounding(rules, now)
+
+	schedule, err := db.GetWorkSchedule(userID)
+	if err != nil {
+		return Report{}, err
+	}
+	if len(schedule) > 0 {
+		// future working hours are not part of the balance yet
+		until := to
+		if now.Before(until) {
+			until = now
+		}
+		report.HasSchedule = true
+		report.Planned = schedule.Planned(from, until)
+	}
+
+	report.FocusCompleted, report.FocusInterrupted, err = db.CountFocusSessions(userID, from, to)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// Gets difference between tracked and planned time, positive is overtime
+func (r Report) Balance() time.Duration {
+	return r.Total - r.Planned
+}
+
+// Formats planned versus tracked time with overtime or undertime
+func formatBalance(r Report) string {
+	balance := r.Balance()
+
+	switch {
+	case balance > 0:
+		return fmt.Sprintf("Planned: %s, overtime: +%s", formatDuration(r.Planned), formatDuration(balance))
+	case balance < 0:
+		return fmt.Sprintf("Planned: %s, undertime: -%s", formatDuration(r.Planned), formatDuration(-balance))
+	default:
+		return fmt.Sprintf("Planned: %s, on schedule", formatDuration(r.Planned))
+	}
+}
+
+// Sorts totals by duration, longest first
+func sortedTotals(totals map[string]time.Duration, emptyLabel string) []ReportTotal {
+	result := make([]ReportTotal, 0, len(totals))
+	for label, d := range totals {
+		if label == "" {
+			label = emptyLabel
+		}
+		result = append(result, ReportTotal{Label: label, Duration: d})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Duration == result[j].Duration {
+			return result[i].Label < result[j].Label
+		}
+		return result[i].Duration > result[j].Duration
+	})
+	return result
+}
+
+// Resolves period name to [from, to) range in given location.
+//
+// Supported periods: today, yesterday, week, lastweek, month, lastmonth
+func parsePeriod(name string, now time.Time, loc *time.Location) (from time.Time, to time.Time, err error) {
+	now = now.In(loc)
+	today := startOfDay(now)
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "today", "day":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "week":
+		week := startOfWeek(now)
+		return week, week.AddDate(0, 0, 7), nil
+	case "lastweek":
+		week := startOfWeek(now)
+		return week.AddDate(0, 0, -7), week, nil
+	case "month":
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return month, month.AddDate(0, 1, 0), nil
+	case "lastmonth":
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return month.AddDate(0, -1, 0), month, nil
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q, use today, yesterday, week, lastweek, month or lastmonth", name)
+}
+
+// Formats report as Telegram message text
+func formatReport(title string, report Report, now time.Time) string {
+	loc := report.From.Location()
+	var sb strings.Builder
+
+	sb.WriteString(title + "\n")
+	sb.WriteString(fmt.Sprintf("Total: %s%s\n", formatDuration(report.Total), formatRounded(report.Total, report.Rounded)))
+	if report.HasSchedule {
+		sb.WriteString(formatBalance(report) + "\n")
+	}
+	if report.FocusCompleted+report.FocusInterrupted > 0 {
+		sb.WriteString(fmt.Sprintf("🍅 Focus sessions: %d completed, %d interrupted\n", report.FocusCompleted, report.FocusInterrupted))
+	}
+
+	if len(report.Entries) == 0 {
+		sb.WriteString("\nNo tracked time.")
+		return sb.String()
+	}
+
+	// list single entries only for short periods, days otherwise
+	if report.To.Sub(report.From) <= 24*time.Hour {
+		sb.WriteString("\nEntries:\n")
+		for _, entry := range report.Entries {
+			end := "now"
+			if entry.EndTime.Valid {
+				end = entry.EndTime.Time.In(loc).Format("15:04")
+			}
+			line := fmt.Sprintf("• %s–%s (%s)", entry.StartTime.In(loc).Format("15:04"), end, formatDuration(entry.Duration(now)))
+			if entry.Note != "" {
+				line += " " + entry.Note
+			}
+			if entry.Project != "" {
+				line += " [" + entry.Project + "]"
+			}
+			sb.WriteString(line + "\n")
+		}
+	} else {
+		sb.WriteString("\nBy day:\n")
+		for day := report.From; day.Before(report.To); day = day.AddDate(0, 0, 1) {
+			d, ok := report.ByDay[day.Format(time.DateOnly)]
+			if !ok {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("• %s: %s\n", day.Format("Mon 02 Jan"), formatDuration(d)))
+		}
+	}
+
+	sb.WriteString("\nBy project:\n")
+	for _, total := range sortedTotals(report.ByProject, "No project") {
+		project := total.Label
+		if project == "No project" {
+			project = ""
+		}
+		rounded := formatRounded(total.Duration, report.RoundedByProject[project])
+		sb.WriteString(fmt.Sprintf("• %s: %s%s\n", total.Label, formatDuration(total.Duration), rounded))
+	}
+
+	sb.WriteString("\nBy note:\n")
+	for _, total := range sortedTotals(report.ByNote, "No note") {
+		sb.WriteString(fmt.Sprintf("• %s: %s\n", total.Label, formatDuration(total.Duration)))
+	}
+
+	if len(report.Open) > 0 {
+		sb.WriteString("\n⚠️ Still running:\n")
+		for _, entry := range report.Open {
+			sb.WriteString(fmt.Sprintf("• since %s (%s)\n", entry.StartTime.In(loc).Format("Mon 15:04"), formatDuration(entry.Duration(now))))
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Formats rounded duration next to raw one, empty when rounding changed nothing
+func formatRounded(raw time.Duration, rounded time.Duration) string {
+	if rounded == raw {
+		return ""
+	}
+	return " (rounded " + formatDuration(rounded) + ")"
+}
+
+// Shows tracked time for period.
+//
+// Usage:
+//
+//	/report [today|yesterday|week|lastweek|month|lastmonth]
+func (b *Bot) handleReportCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	now := time.Now()
+	from, to, err := parsePeriod(args, now, settings.Location(b.cfg.Timezone))
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	report, err := b.db.GetReport(userID, from, to, b.cfg.Rounding)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	text := formatReport("📊 "+periodTitle(from, to), report, now)
+
+	// budgets of reported projects show how much is left in total
+	var projects []string
+	for project := range report.ByProject {
+		if project != "" {
+			projects = append(projects, project)
+		}
+	}
+	if len(projects) > 0 {
+		usages, err := b.getBudgetUsages(projects...)
+		if err != nil {
+			logger.Error("failed to get budgets", "error", err)
+		} else if len(usages) > 0 {
+			text += "\n\n" + b.describeBudgets(usages)
+		}
+	}
+
+	b.sendMessage(message.Chat.ID, text, message.MessageID)
+}
+
+// Builds human readable title for [from, to) range
+func periodTitle(from time.Time, to time.Time) string {
+	last := to.AddDate(0, 0, -1)
+	if !last.After(from) {
+		return from.Format("Mon, 02 Jan 2006")
+	}
+	return from.Format("Mon, 02 Jan") + " – " + last.Format("Mon, 02 Jan 2006")
+}
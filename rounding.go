@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Rounding modes of durations
+const (
+	RoundNone    = "none"
+	RoundNearest = "nearest"
+	RoundUp      = "up"
+	RoundDown    = "down"
+)
+
+// Rule for rounding tracked durations, applied when time is reported or
+// exported. Stored entries always keep exact times.
+type RoundingPolicy struct {
+	Mode      string
+	Increment time.Duration
+	// Shorter non-empty durations are billed as this minimum
+	Minimum time.Duration
+}
+
+// Global rounding policy and policies overriding it for single projects
+type RoundingRules struct {
+	Default  RoundingPolicy
+	Projects map[string]RoundingPolicy
+}
+
+// Parses policy written as "<mode> [increment] [min <duration>]",
+// e.g. "up 15m", "nearest 6m min 30m" or "none min 15m"
+func parseRoundingPolicy(value string) (RoundingPolicy, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 {
+		return RoundingPolicy{Mode: RoundNone}, nil
+	}
+
+	policy := RoundingPolicy{Mode: fields[0]}
+	fields = fields[1:]
+
+	switch policy.Mode {
+	case RoundNone:
+	case RoundNearest, RoundUp, RoundDown:
+		if len(fields) == 0 {
+			return policy, fmt.Errorf("rounding %s needs an increment, e.g. %s 15m", policy.Mode, policy.Mode)
+		}
+		increment, err := parsePositiveDuration(fields[0])
+		if err != nil {
+			return policy, err
+		}
+		policy.Increment = increment
+		fields = fields[1:]
+	default:
+		return policy, fmt.Errorf("unknown rounding %q, use none, nearest, up or down", policy.Mode)
+	}
+
+	if len(fields) > 0 {
+		if len(fields) != 2 || fields[0] != "min" {
+			return policy, fmt.Errorf("invalid rounding %q, use e.g. up 15m min 30m", value)
+		}
+		minimum, err := parsePositiveDuration(fields[1])
+		if err != nil {
+			return policy, err
+		}
+		policy.Minimum = minimum
+	}
+
+	return policy, nil
+}
+
+// Rounds duration according to the policy
+func (p RoundingPolicy) Apply(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+
+	if p.Increment > 0 {
+		switch p.Mode {
+		case RoundNearest:
+			d = d.Round(p.Increment)
+		case RoundUp:
+			if d%p.Increment != 0 {
+				d = d.Truncate(p.Increment) + p.Increment
+			}
+		case RoundDown:
+			d = d.Truncate(p.Increment)
+		}
+	}
+
+	if d < p.Minimum {
+		d = p.Minimum
+	}
+	return d
+}
+
+// Formats policy in the syntax accepted by parseRoundingPolicy
+func (p RoundingPolicy) String() string {
+	s := p.Mode
+	if s == "" {
+		s = RoundNone
+	}
+	if p.Increment > 0 {
+		s += " " + formatShortDuration(p.Increment)
+	}
+	if p.Minimum > 0 {
+		s += " min " + formatShortDuration(p.Minimum)
+	}
+	return s
+}
+
+// Formats duration without zero units, e.g. "15m" or "1h30m"
+func formatShortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Gets policy used for entries of project
+func (r RoundingRules) For(project string) RoundingPolicy {
+	if policy, ok := r.Projects[project]; ok {
+		return policy
+	}
+	return r.Default
+}
+
+// Gets rounded duration of entry. Running entries are not rounded, their
+// duration is counted until now.
+func (r RoundingRules) Duration(entry Entry, now time.Time) time.Duration {
+	if !entry.EndTime.Valid {
+		return entry.Duration(now)
+	}
+	return r.For(entry.Project).Apply(entry.Duration(now))
+}
+
+// Loads rounding policies of projects, projects without own policy use fallback
+func (db *Database) GetRoundingRules(fallback RoundingPolicy) (RoundingRules, error) {
+	projects, err := db.GetProjects()
+	if err != nil {
+		return RoundingRules{}, err
+	}
+
+	rules := RoundingRules{Default: fallback, Projects: make(map[string]RoundingPolicy)}
+	for _, project := range projects {
+		if project.Rounding == "" {
+			continue
+		}
+		policy, err := parseRoundingPolicy(project.Rounding)
+		if err != nil {
+			slog.Warn("ignoring invalid rounding of project", "project", project.Name, "error", err)
+			continue
+		}
+		rules.Projects[project.Name] = policy
+	}
+	return rules, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestParseRoundingPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RoundingPolicy
+		wantErr bool
+	}{
+		{"", RoundingPolicy{Mode: RoundNone}, false},
+		{"none", RoundingPolicy{Mode: RoundNone}, false},
+		{"up 15m", RoundingPolicy{Mode: RoundUp, Increment: 15 * time.Minute}, false},
+		{"Nearest 6m min 30m", RoundingPolicy{Mode: RoundNearest, Increment: 6 * time.Minute, Minimum: 30 * time.Minute}, false},
+		{"none min 15m", RoundingPolicy{Mode: RoundNone, Minimum: 15 * time.Minute}, false},
+		{"down 1h", RoundingPolicy{Mode: RoundDown, Increment: time.Hour}, false},
+		{"up", RoundingPolicy{}, true},
+		{"up -15m", RoundingPolicy{}, true},
+		{"up fifteen", RoundingPolicy{}, true},
+		{"sideways 15m", RoundingPolicy{}, true},
+		{"up 15m max 1h", RoundingPolicy{}, true},
+		{"up 15m min", RoundingPolicy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRoundingPolicy(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRoundingPolicy(%q) = %+v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRoundingPolicy(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseRoundingPolicy(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+
+			// formatted policy parses back to the same policy
+			if again, err := parseRoundingPolicy(got.String()); err != nil || again != got {
+				t.Fatalf("parseRoundingPolicy(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+			}
+		})
+	}
+}
+
+func TestRoundingPolicyApply(t *testing.T) {
+	const m = time.Minute
+
+	tests := []struct {
+		policy string
+		in     time.Duration
+		want   time.Duration
+	}{
+		{"none", 7 * m, 7 * m},
+		{"up 15m", 1 * m, 15 * m},
+		{"up 15m", 15 * m, 15 * m},
+		{"up 15m", 16 * m, 30 * m},
+		{"down 15m", 29 * m, 15 * m},
+		{"down 15m", 5 * m, 0},
+		{"nearest 15m", 7 * m, 0},
+		{"nearest 15m", 8 * m, 15 * m},
+		{"nearest 6m", 9 * m, 12 * m},
+		{"down 15m min 30m", 5 * m, 30 * m},
+		{"up 15m min 30m", 31 * m, 45 * m},
+		{"none min 15m", 1 * m, 15 * m},
+		{"up 15m min 30m", 0, 0},
+	}
+
+	for _, tt := range tests {
+		policy, err := parseRoundingPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := policy.Apply(tt.in); got != tt.want {
+			t.Errorf("%q.Apply(%s) = %s, want %s", tt.policy, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRoundingRulesDuration(t *testing.T) {
+	rules := RoundingRules{
+		Default:  RoundingPolicy{Mode: RoundUp, Increment: 15 * time.Minute},
+		Projects: map[string]RoundingPolicy{"internal": {Mode: RoundNone}},
+	}
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	now := start.Add(10 * time.Minute)
+	finished := sql.NullTime{Time: start.Add(10 * time.Minute), Valid: true}
+
+	tests := []struct {
+		name  string
+		entry Entry
+		want  time.Duration
+	}{
+		{"default policy", Entry{StartTime: start, EndTime: finished}, 15 * time.Minute},
+		{"project policy", Entry{StartTime: start, EndTime: finished, Project: "internal"}, 10 * time.Minute},
+		{"running entry", Entry{StartTime: start}, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := rules.Duration(tt.entry, now); got != tt.want {
+			t.Errorf("%s: Duration() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
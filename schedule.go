@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Expected working hours for a single day of the week. Start and End are
+// offsets from local midnight.
+type WorkDay struct {
+	Weekday time.Weekday
+	Start   time.Duration
+	End     time.Duration
+}
+
+// Expected working hours of a user, keyed by day of the week.
+type WorkSchedule map[time.Weekday]WorkDay
+
+const (
+	getWorkScheduleSQL    = `SELECT weekday, start_time, end_time FROM work_schedules WHERE user_id = ?`
+	upsertWorkDaySQL      = `INSERT INTO work_schedules (user_id, weekday, start_time, end_time) VALUES (?, ?, ?, ?) ON CONFLICT(user_id, weekday) DO UPDATE SET start_time = excluded.start_time, end_time = excluded.end_time`
+	deleteWorkDaySQL      = `DELETE FROM work_schedules WHERE user_id = ? AND weekday = ?`
+	deleteWorkScheduleSQL = `DELETE FROM work_schedules WHERE user_id = ?`
+)
+
+// Gets working schedule of user, empty schedule means none is defined
+func (db *Database) GetWorkSchedule(userID string) (WorkSchedule, error) {
+	rows, err := db.conn.Query(getWorkScheduleSQL, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get work schedule: %w", err)
+	}
+	defer rows.Close()
+
+	schedule := make(WorkSchedule)
+	for rows.Next() {
+		var weekday int
+		var start, end string
+		if err := rows.Scan(&weekday, &start, &end); err != nil {
+			return nil, fmt.Errorf("failed to scan work schedule: %w", err)
+		}
+
+		startOffset, err := parseClock(start)
+		if err != nil {
+			return nil, err
+		}
+		endOffset, err := parseClock(end)
+		if err != nil {
+			return nil, err
+		}
+
+		day := time.Weekday(weekday)
+		schedule[day] = WorkDay{Weekday: day, Start: startOffset, End: endOffset}
+	}
+
+	return schedule, rows.Err()
+}
+
+// Sets working hours for given days, replacing previous hours on those days
+func (db *Database) SetWorkDays(userID string, days []WorkDay) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update work schedule: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, day := range days {
+		if _, err := tx.Exec(upsertWorkDaySQL, userID, int(day.Weekday), formatClock(day.Start), formatClock(day.End)); err != nil {
+			return fmt.Errorf("failed to update work schedule: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Removes working hours for given days
+func (db *Database) RemoveWorkDays(userID string, days []time.Weekday) error {
+	for _, day := range days {
+		if _, err := db.conn.Exec(deleteWorkDaySQL, userID, int(day)); err != nil {
+			return fmt.Errorf("failed to update work schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// Removes whole working schedule of user
+func (db *Database) ClearWorkSchedule(userID string) error {
+	if _, err := db.conn.Exec(deleteWorkScheduleSQL, userID); err != nil {
+		return fmt.Errorf("failed to clear work schedule: %w", err)
+	}
+	return nil
+}
+
+// Gets planned working time in [from, to). Days are taken in location of from.
+func (s WorkSchedule) Planned(from time.Time, to time.Time) time.Duration {
+	var planned time.Duration
+
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		workDay, ok := s[day.Weekday()]
+		if !ok {
+			continue
+		}
+
+		start := day.Add(workDay.Start)
+		end := day.Add(workDay.End)
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			planned += end.Sub(start)
+		}
+	}
+
+	return planned
+}
+
+// Formats schedule as one line per working day, Monday first
+func (s WorkSchedule) String() string {
+	if len(s) == 0 {
+		return "No working hours defined."
+	}
+
+	days := make([]WorkDay, 0, len(s))
+	for _, day := range s {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return mondayFirst(days[i].Weekday) < mondayFirst(days[j].Weekday)
+	})
+
+	var lines []string
+	for _, day := range days {
+		lines = append(lines, fmt.Sprintf("• %s %s–%s", day.Weekday.String()[:3], formatClock(day.Start), formatClock(day.End)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Gets position of weekday in week starting on Monday
+func mondayFirst(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// Parses list of days like "mon-fri", "mon,wed,fri" or "sat"
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) == 1 {
+			days = append(days, first)
+			continue
+		}
+
+		last, err := parseWeekday(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		// ranges may wrap around the week, e.g. "fri-mon"
+		for i := 0; i < 7; i++ {
+			day := time.Weekday((int(first) + i) % 7)
+			days = append(days, day)
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// Parses hours range like "09:00-17:00"
+func parseHours(value string) (time.Duration, time.Duration, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("%q is not a time range, use HH:MM-HH:MM", value)
+	}
+
+	start, err := parseClock(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(bounds[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("end of working hours must be after start")
+	}
+
+	return start, end, nil
+}
+
+// Manages working schedule.
+//
+// Usage:
+//
+//	/schedule
+//	/schedule mon-fri 09:00-17:00
+//	/schedule off sat,sun
+//	/schedule clear
+func (b *Bot) handleScheduleCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(strings.ToLower(args))
+
+	var err error
+	switch {
+	case len(fields) == 0:
+		// only show current schedule
+	case len(fields) == 1 && fields[0] == "clear":
+		err = b.db.ClearWorkSchedule(userID)
+	case len(fields) == 2 && fields[0] == "off":
+		var days []time.Weekday
+		if days, err = parseWeekdays(fields[1]); err == nil {
+			err = b.db.RemoveWorkDays(userID, days)
+		}
+	case len(fields) == 2:
+		var days []time.Weekday
+		var start, end time.Duration
+		if days, err = parseWeekdays(fields[0]); err != nil {
+			break
+		}
+		if start, end, err = parseHours(fields[1]); err != nil {
+			break
+		}
+
+		workDays := make([]WorkDay, 0, len(days))
+		for _, day := range days {
+			workDays = append(workDays, WorkDay{Weekday: day, Start: start, End: end})
+		}
+		err = b.db.SetWorkDays(userID, workDays)
+	default:
+		b.sendMessage(message.Chat.ID, scheduleUsage, message.MessageID)
+		return
+	}
+
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s\n\n%s", err, scheduleUsage), message.MessageID)
+		return
+	}
+
+	schedule, err := b.db.GetWorkSchedule(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	b.sendMessage(message.Chat.ID, "🗓️ Your working hours:\n"+schedule.String()+"\n\n"+scheduleUsage, message.MessageID)
+}
+
+const scheduleUsage = "Usage:\n" +
+	"/schedule mon-fri 09:00-17:00 - Set working hours for days\n" +
+	"/schedule off sat,sun - Remove working hours for days\n" +
+	"/schedule clear - Remove all working hours"
+
+// Nudges users who have not started a timer within nudge delay after
+// their scheduled start. Each user is nudged at most once per day.
+func (b *Bot) sendDueNudges(now time.Time) {
+	userIDs, err := b.db.GetKnownUserIDs()
+	if err != nil {
+		slog.Error("failed to get users for nudges", "error", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		chatID, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil || !b.isAuthorized(chatID) {
+			continue
+		}
+
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			slog.Error("failed to get user settings", "user_id", userID, "error", err)
+			continue
+		}
+
+		schedule, err := b.db.GetWorkSchedule(userID)
+		if err != nil {
+			slog.Error("failed to get work schedule", "user_id", userID, "error", err)
+			continue
+		}
+
+		local, workDay, due := b.nudgeDue(settings, schedule, now)
+		if !due {
+			continue
+		}
+		today := local.Format(time.DateOnly)
+		midnight := startOfDay(local)
+
+		started, err := b.hasTrackedSince(userID, midnight, now)
+		if err != nil {
+			slog.Error("failed to check tracked time", "user_id", userID, "error", err)
+			continue
+		}
+		if started {
+			continue
+		}
+
+		if err := b.db.SetUserSetting(userID, "nudge_sent_on", today); err != nil {
+			slog.Error("failed to record nudge", "user_id", userID, "error", err)
+			continue
+		}
+
+		text := fmt.Sprintf("👋 Your working day started at %s, but no timer is running yet.\nUse /start to start tracking.", formatClock(workDay.Start))
+		b.sendMessage(chatID, text, 0)
+	}
+}
+
+// Decides if user should be nudged at now, provided no timer was started
+// today. Returns now in user's timezone and today's working hours.
+func (b *Bot) nudgeDue(settings UserSettings, schedule WorkSchedule, now time.Time) (time.Time, WorkDay, bool) {
+	local := now.In(settings.Location(b.cfg.Timezone))
+
+	delay := settings.NudgeDuration(b.cfg.NudgeAfter)
+	if delay <= 0 || settings.NudgeSentOn.String == local.Format(time.DateOnly) {
+		return local, WorkDay{}, false
+	}
+
+	workDay, ok := schedule[local.Weekday()]
+	if !ok {
+		return local, WorkDay{}, false
+	}
+
+	// nudge only during working hours
+	midnight := startOfDay(local)
+	if local.Before(midnight.Add(workDay.Start+delay)) || !local.Before(midnight.Add(workDay.End)) {
+		return local, WorkDay{}, false
+	}
+	return local, workDay, true
+}
+
+// Checks if user has running timer or started any entry since given time
+func (b *Bot) hasTrackedSince(userID string, since time.Time, now time.Time) (bool, error) {
+	active, err := b.db.hasActiveEntry(userID)
+	if err != nil || active {
+		return active, err
+	}
+
+	entries, err := b.db.GetEntriesBetween(userID, since, now.Add(time.Second))
+	if err != nil {
+		return false, err
+	}
+	return len(entries) > 0, nil
+}
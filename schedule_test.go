@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Monday to Friday from 09:00 to 17:00
+func officeHours() WorkSchedule {
+	schedule := make(WorkSchedule)
+	for day := time.Monday; day <= time.Friday; day++ {
+		schedule[day] = WorkDay{Weekday: day, Start: 9 * time.Hour, End: 17 * time.Hour}
+	}
+	return schedule
+}
+
+func TestNudgeDue(t *testing.T) {
+	// Monday morning in UTC, still Sunday in Honolulu
+	now := time.Date(2024, 3, 4, 8, 20, 0, 0, time.UTC)
+	b := &Bot{cfg: &Config{Timezone: time.UTC, NudgeAfter: 15 * time.Minute}}
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	seconds := func(d time.Duration) sql.NullInt64 {
+		return sql.NullInt64{Int64: int64(d / time.Second), Valid: true}
+	}
+
+	tests := []struct {
+		name     string
+		settings UserSettings
+		schedule WorkSchedule
+		want     bool
+	}{
+		{"before start", UserSettings{}, officeHours(), false},
+		{"after start and delay", UserSettings{Timezone: str("Europe/Belgrade")}, officeHours(), true},
+		{"within own delay", UserSettings{Timezone: str("Europe/Belgrade"), NudgeAfter: seconds(30 * time.Minute)}, officeHours(), false},
+		{"nudges disabled", UserSettings{Timezone: str("Europe/Belgrade"), NudgeAfter: seconds(0)}, officeHours(), false},
+		{"already nudged today", UserSettings{Timezone: str("Europe/Belgrade"), NudgeSentOn: str("2024-03-04")}, officeHours(), false},
+		{"nudged yesterday", UserSettings{Timezone: str("Europe/Belgrade"), NudgeSentOn: str("2024-03-03")}, officeHours(), true},
+		{"half hour offset", UserSettings{Timezone: str("Asia/Kolkata")}, officeHours(), true},
+		{"after working hours", UserSettings{Timezone: str("Asia/Tokyo")}, officeHours(), false},
+		{"night west of UTC", UserSettings{Timezone: str("America/New_York")}, officeHours(), false},
+		{"day off west of UTC", UserSettings{Timezone: str("Pacific/Honolulu")}, officeHours(), false},
+		{"no schedule", UserSettings{Timezone: str("Europe/Belgrade")}, WorkSchedule{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, workDay, due := b.nudgeDue(tt.settings, tt.schedule, now)
+			if due != tt.want {
+				t.Fatalf("nudgeDue() = %v, want %v", due, tt.want)
+			}
+			if due && workDay.Weekday != time.Monday {
+				t.Errorf("nudgeDue() work day = %v, want Monday", workDay.Weekday)
+			}
+		})
+	}
+}
+
+func TestWorkSchedulePlanned(t *testing.T) {
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2024, 3, 4, 0, 0, 0, 0, belgrade)
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want time.Duration
+	}{
+		{"whole week", monday, monday.AddDate(0, 0, 7), 40 * time.Hour},
+		{"single day", monday, monday.AddDate(0, 0, 1), 8 * time.Hour},
+		{"weekend", monday.AddDate(0, 0, 5), monday.AddDate(0, 0, 7), 0},
+		{"partial day", monday.Add(13 * time.Hour), monday.Add(15 * time.Hour), 2 * time.Hour},
+		{"from middle of day", monday.Add(12 * time.Hour), monday.AddDate(0, 0, 1), 5 * time.Hour},
+		// clocks move forward on March 31st, the working day is still 8 hours
+		{"week with DST change", time.Date(2024, 3, 25, 0, 0, 0, 0, belgrade), time.Date(2024, 4, 1, 0, 0, 0, 0, belgrade), 40 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := officeHours().Planned(tt.from, tt.to); got != tt.want {
+				t.Errorf("Planned() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []time.Weekday
+		wantErr bool
+	}{
+		{"mon", []time.Weekday{time.Monday}, false},
+		{"mon-wed", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday}, false},
+		{"mon,wed,friday", []time.Weekday{time.Monday, time.Wednesday, time.Friday}, false},
+		{"fri-mon", []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}, false},
+		{"sat-sat", []time.Weekday{time.Saturday}, false},
+		{"mon-xyz", nil, true},
+		{"someday", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseWeekdays(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWeekdays(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseWeekdays(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHours(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStart time.Duration
+		wantEnd   time.Duration
+		wantErr   bool
+	}{
+		{"09:00-17:00", 9 * time.Hour, 17 * time.Hour, false},
+		{"8:30-12:15", 8*time.Hour + 30*time.Minute, 12*time.Hour + 15*time.Minute, false},
+		{"17:00-09:00", 0, 0, true},
+		{"09:00-09:00", 0, 0, true},
+		{"09:00", 0, 0, true},
+		{"9am-5pm", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, end, err := parseHours(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHours(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("parseHours(%q) = %v, %v, want %v, %v", tt.value, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
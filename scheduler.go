@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Background task executed periodically by the scheduler.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time)
+	// Runs job also when the scheduler starts, not only after first interval
+	RunAtStart bool
+}
+
+// Runs registered jobs in the background, each one on its own ticker.
+type Scheduler struct {
+	jobs []Job
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		stop: make(chan struct{}),
+	}
+}
+
+// Registers job, must be called before Start
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Starts all registered jobs
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+}
+
+// Stops all jobs and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	if job.RunAtStart {
+		s.run(job, time.Now())
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.run(job, now)
+		}
+	}
+}
+
+// Runs job once, recovering from panics so the job keeps being scheduled
+func (s *Scheduler) run(job Job, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in scheduled job", "job", job.Name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		}
+	}()
+
+	job.Run(now)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunAtStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		runAtStart bool
+		want       bool
+	}{
+		{"run at start", true, true},
+		{"wait for interval", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := make(chan struct{}, 1)
+			scheduler := NewScheduler()
+			scheduler.Add(Job{
+				Name:       "test",
+				Interval:   time.Hour,
+				RunAtStart: tt.runAtStart,
+				Run:        func(now time.Time) { ran <- struct{}{} },
+			})
+			scheduler.Start()
+
+			var got bool
+			select {
+			case <-ran:
+				got = true
+			case <-time.After(100 * time.Millisecond):
+			}
+			scheduler.Stop()
+
+			if got != tt.want {
+				t.Errorf("job ran = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Per-user preferences. Unset values fall back to application defaults.
+type UserSettings struct {
+	UserID string
+	// Seconds after which user is reminded about running timer,
+	// NULL uses default and 0 disables reminders
+	ReminderAfter sql.NullInt64
+	// Seconds after which running timer is stopped automatically,
+	// NULL or 0 disables auto-stop
+	AutoStopAfter sql.NullInt64
+	// IANA timezone name, e.g. Europe/Belgrade
+	Timezone sql.NullString
+
+	DigestEnabled       sql.NullBool
+	DigestTime          sql.NullString
+	WeeklyDigestEnabled sql.NullBool
+	// Local dates (YYYY-MM-DD) when digests were last sent
+	DigestSentOn       sql.NullString
+	WeeklyDigestSentOn sql.NullString
+
+	// Seconds after scheduled start when user is nudged to start timer,
+	// NULL uses default and 0 disables nudges
+	NudgeAfter  sql.NullInt64
+	NudgeSentOn sql.NullString
+
+	// Email written to export files of tools which require one, e.g. Toggl
+	Email sql.NullString
+}
+
+const (
+	getUserSettingsSQL = `
+  SELECT user_id, reminder_after, auto_stop_after, timezone, digest_enabled, digest_time,
+  weekly_digest_enabled, digest_sent_on, weekly_digest_sent_on, nudge_after, nudge_sent_on, email
+  FROM user_settings WHERE user_id = ?`
+
+	// %s is replaced with column name from settingColumns
+	upsertUserSettingSQL = `
+  INSERT INTO user_settings (user_id, %[1]s, updated_at) VALUES (?, ?, ?)
+  ON CONFLICT(user_id) DO UPDATE SET %[1]s = excluded.%[1]s, updated_at = excluded.updated_at`
+)
+
+// Columns of user_settings that can be updated through SetUserSetting
+var settingColumns = map[string]bool{
+	"reminder_after":        true,
+	"auto_stop_after":       true,
+	"timezone":              true,
+	"digest_enabled":        true,
+	"digest_time":           true,
+	"weekly_digest_enabled": true,
+	"digest_sent_on":        true,
+	"weekly_digest_sent_on": true,
+	"nudge_after":           true,
+	"nudge_sent_on":         true,
+	"email":                 true,
+}
+
+// Gets settings for user, returns empty settings if user never changed any
+func (db *Database) GetUserSettings(userID string) (UserSettings, error) {
+	settings := UserSettings{UserID: userID}
+
+	err := db.stmts.userSettings.QueryRow(userID).Scan(
+		&settings.UserID,
+		&settings.ReminderAfter,
+		&settings.AutoStopAfter,
+		&settings.Timezone,
+		&settings.DigestEnabled,
+		&settings.DigestTime,
+		&settings.WeeklyDigestEnabled,
+		&settings.DigestSentOn,
+		&settings.WeeklyDigestSentOn,
+		&settings.NudgeAfter,
+		&settings.NudgeSentOn,
+		&settings.Email,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// Updates single settings column for user, nil value resets it to default
+func (db *Database) SetUserSetting(userID string, column string, value any) error {
+	if !settingColumns[column] {
+		return fmt.Errorf("unknown setting %q", column)
+	}
+
+	_, err := db.conn.Exec(fmt.Sprintf(upsertUserSettingSQL, column), userID, value, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update setting %s: %w", column, err)
+	}
+	return nil
+}
+
+// Gets reminder duration for user, zero means reminders are disabled
+func (s UserSettings) ReminderDuration(fallback time.Duration) time.Duration {
+	if !s.ReminderAfter.Valid {
+		return fallback
+	}
+	return time.Duration(s.ReminderAfter.Int64) * time.Second
+}
+
+// Gets auto-stop cap for user, zero means auto-stop is disabled
+func (s UserSettings) AutoStopDuration() time.Duration {
+	if !s.AutoStopAfter.Valid {
+		return 0
+	}
+	return time.Duration(s.AutoStopAfter.Int64) * time.Second
+}
+
+// Gets delay after scheduled start for nudges, zero means nudges are disabled
+func (s UserSettings) NudgeDuration(fallback time.Duration) time.Duration {
+	if !s.NudgeAfter.Valid {
+		return fallback
+	}
+	return time.Duration(s.NudgeAfter.Int64) * time.Second
+}
+
+// Gets user's timezone, falling back to given location when unset or invalid
+func (s UserSettings) Location(fallback *time.Location) *time.Location {
+	if !s.Timezone.Valid {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(s.Timezone.String)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Single option changeable with /settings command
+type settingOption struct {
+	usage string
+	apply func(b *Bot, userID string, value string) (string, error)
+}
+
+var settingOptions = map[string]settingOption{
+	"reminder": {
+		usage: "reminder <duration|off|default> - Remind me when timer runs longer than this",
+		apply: func(b *Bot, userID string, value string) (string, error) {
+			switch value {
+			case "default":
+				return "Reminder reset to default.", b.db.SetUserSetting(userID, "reminder_after", nil)
+			case "off":
+				return "Reminders are turned off.", b.db.SetUserSetting(userID, "reminder_after", 0)
+			}
+
+			d, err := parsePositiveDuration(value)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("You will be reminded after %s.", formatDuration(d)), b.db.SetUserSetting(userID, "reminder_after", int64(d.Seconds()))
+		},
+	},
+	"autostop": {
+		usage: "autostop <duration|off> - Stop timer automatically after this long",
+		apply: func(b *Bot, userID string, value string) (string, error) {
+			if value == "off" {
+				return "Auto-stop is turned off.", b.db.SetUserSetting(userID, "auto_stop_after", nil)
+			}
+
+			d, err := parsePositiveDuration(value)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Timer will be stopped automatically after %s.", formatDuration(d)), b.db.SetUserSetting(userID, "auto_stop_after", int64(d.Seconds()))
+		},
+	},
+	"nudge": {
+		usage: "nudge <duration|off|default> - Nudge me when timer is not started this long after my scheduled start",
+		apply: func(b *Bot, userID string, value string) (string, error) {
+			switch value {
+			case "default":
+				return "Nudge reset to default.", b.db.SetUserSetting(userID, "nudge_after", nil)
+			case "off":
+				return "Nudges are turned off.", b.db.SetUserSetting(userID, "nudge_after", 0)
+			}
+
+			d, err := parsePositiveDuration(value)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("You will be nudged %s after your scheduled start.", formatDuration(d)), b.db.SetUserSetting(userID, "nudge_after", int64(d.Seconds()))
+		},
+	},
+	"email": {
+		usage: "email <address|off> - Email written to Toggl and Clockify exports",
+		apply: func(b *Bot, userID string, value string) (string, error) {
+			if value == "off" {
+				return "Email is removed.", b.db.SetUserSetting(userID, "email", nil)
+			}
+
+			address, err := mail.ParseAddress(value)
+			if err != nil || address.Name != "" {
+				return "", fmt.Errorf("%q is not an email address", value)
+			}
+			return "Email set to " + address.Address + ".", b.db.SetUserSetting(userID, "email", address.Address)
+		},
+	},
+	"timezone": {
+		usage: "timezone <Area/City|default> - Timezone used for digests and reports",
+		apply: func(b *Bot, userID string, value string) (string, error) {
+			if value == "default" {
+				return "Timezone reset to default.", b.db.SetUserSetting(userID, "timezone", nil)
+			}
+
+			loc, err := loadLocation(value)
+			if err != nil {
+				return "", err
+			}
+			return "Timezone set to " + loc.String() + ".", b.db.SetUserSetting(userID, "timezone", loc.String())
+		},
+	},
+}
+
+// Shows or changes user settings.
+//
+// Usage:
+//
+//	/settings
+//	/settings <option> <value>
+func (b *Bot) handleSettingsCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		settings, err := b.db.GetUserSettings(userID)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		b.sendMessage(message.Chat.ID, b.describeSettings(settings), message.MessageID)
+		return
+	}
+
+	option, ok := settingOptions[strings.ToLower(fields[0])]
+	if !ok || len(fields) < 2 {
+		b.sendMessage(message.Chat.ID, settingsUsage(), message.MessageID)
+		return
+	}
+
+	reply, err := option.apply(b, userID, strings.ToLower(strings.Join(fields[1:], " ")))
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("Invalid value: %s\n\n%s", err, settingsUsage()), message.MessageID)
+		return
+	}
+
+	b.sendMessage(message.Chat.ID, "⚙️ "+reply, message.MessageID)
+}
+
+// Builds human readable overview of user settings
+func (b *Bot) describeSettings(settings UserSettings) string {
+	reminder := "off"
+	if d := settings.ReminderDuration(b.cfg.ReminderAfter); d > 0 {
+		reminder = formatDuration(d)
+	}
+
+	autoStop := "off"
+	if d := settings.AutoStopDuration(); d > 0 {
+		autoStop = formatDuration(d)
+	}
+
+	nudge := "off"
+	if d := settings.NudgeDuration(b.cfg.NudgeAfter); d > 0 {
+		nudge = formatDuration(d)
+	}
+
+	email := "not set"
+	if settings.Email.Valid {
+		email = settings.Email.String
+	}
+
+	return "⚙️ Your settings:\n" +
+		"Reminder after: " + reminder + "\n" +
+		"Auto-stop after: " + autoStop + "\n" +
+		"Nudge after: " + nudge + "\n" +
+		"Timezone: " + settings.Location(b.cfg.Timezone).String() + "\n" +
+		"Email: " + email + "\n\n" +
+		settingsUsage()
+}
+
+func settingsUsage() string {
+	names := make([]string, 0, len(settingOptions))
+	for name := range settingOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	usage := "Usage: /settings <option> <value>\n"
+	for _, name := range names {
+		usage += "• " + settingOptions[name].usage + "\n"
+	}
+	return strings.TrimSuffix(usage, "\n")
+}
+
+// Parses duration like "90m" or "8h" and makes sure it is positive
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration, use values like 90m or 8h", value)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return d, nil
+}
+
+// Loads timezone by IANA name. Lookup is case-insensitive for convenience,
+// since values passed to /settings are lowercased.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc, nil
+	}
+
+	// "europe/belgrade" -> "Europe/Belgrade"
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		words := strings.Split(part, "_")
+		for j, word := range words {
+			if word != "" {
+				words[j] = strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+		parts[i] = strings.Join(words, "_")
+	}
+
+	loc, err := time.LoadLocation(strings.Join(parts, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
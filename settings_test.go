@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEmailSetting(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantSet bool
+		wantErr bool
+	}{
+		{"ana@example.com", "ana@example.com", true, false},
+		{"off", "", false, false},
+		{"ana", "", false, true},
+		{"ana petrović <ana@example.com>", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			b := &Bot{db: newTestDatabase(t)}
+			if err := b.db.SetUserSetting("1", "email", "old@example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := settingOptions["email"].apply(b, "1", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			settings, err := b.db.GetUserSettings("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settings.Email.Valid != tt.wantSet || settings.Email.String != tt.want {
+				t.Errorf("email = %+v, want %q", settings.Email, tt.want)
+			}
+		})
+	}
+}
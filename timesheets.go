@@ -0,0 +1,435 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// States of weekly timesheets. Weeks without a stored timesheet are open.
+const (
+	TimesheetOpen      = "open"
+	TimesheetSubmitted = "submitted"
+	TimesheetApproved  = "approved"
+	TimesheetRejected  = "rejected"
+)
+
+// Week of entries of one user, submitted for review by a manager.
+// Entries of approved timesheets can not be changed.
+type Timesheet struct {
+	UserID string `json:"user_id"`
+	// Date of Monday in user's timezone, YYYY-MM-DD
+	Week        string       `json:"week"`
+	PeriodStart time.Time    `json:"period_start"`
+	PeriodEnd   time.Time    `json:"period_end"`
+	State       string       `json:"state"`
+	SubmittedAt sql.NullTime `json:"-"`
+	ReviewedBy  string       `json:"reviewed_by,omitempty"`
+	ReviewedAt  sql.NullTime `json:"-"`
+	Comment     string       `json:"comment,omitempty"`
+}
+
+const (
+	timesheetColumns = `user_id, week, period_start, period_end, state, submitted_at, reviewed_by, reviewed_at, comment`
+	getTimesheetSQL  = `SELECT ` + timesheetColumns + ` FROM timesheets WHERE user_id = ? AND week = ?`
+	getTimesheetsSQL = `SELECT ` + timesheetColumns + ` FROM timesheets
+  WHERE (? = '' OR state = ?) AND (? = '' OR user_id = ?) AND (? = '' OR week >= ?) AND (? = '' OR week <= ?)
+  ORDER BY week, user_id`
+	submitTimesheetSQL = `
+  INSERT INTO timesheets (user_id, week, period_start, period_end, state, submitted_at) VALUES (?, ?, ?, ?, 'submitted', ?)
+  ON CONFLICT(user_id, week) DO UPDATE SET state = 'submitted', submitted_at = excluded.submitted_at,
+  reviewed_by = '', reviewed_at = NULL, comment = ''`
+	reviewTimesheetSQL   = `UPDATE timesheets SET state = ?, reviewed_by = ?, reviewed_at = ?, comment = ? WHERE user_id = ? AND week = ?`
+	countRunningInWeek   = `SELECT COUNT(*) FROM entries WHERE user_id = ? AND active = 1 AND deleted_at IS NULL AND unixepoch(start_time) < unixepoch(?)`
+	lockedAtSQL          = `SELECT COUNT(*) FROM timesheets WHERE user_id = ? AND state = 'approved' AND unixepoch(?) >= unixepoch(period_start) AND unixepoch(?) < unixepoch(period_end)`
+	lockedEntrySQL       = `SELECT COUNT(*) FROM entries e JOIN timesheets t ON t.user_id = e.user_id AND t.state = 'approved' AND unixepoch(e.start_time) >= unixepoch(t.period_start) AND unixepoch(e.start_time) < unixepoch(t.period_end) WHERE e.id = ?`
+	lockedImportBatchSQL = `SELECT COUNT(*) FROM entries e JOIN timesheets t ON t.user_id = e.user_id AND t.state = 'approved' AND unixepoch(e.start_time) >= unixepoch(t.period_start) AND unixepoch(e.start_time) < unixepoch(t.period_end) WHERE e.import_batch = ?`
+)
+
+// Error returned when change touches entries of an approved timesheet
+var errTimesheetLocked = fmt.Errorf("Entries of approved timesheets can not be changed.")
+
+// Runs single-row queries, implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Returns errTimesheetLocked if the count query finds any locked entry
+func checkUnlocked(q rowQuerier, query string, args ...any) error {
+	var locked int
+	if err := q.QueryRow(query, args...).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to check timesheets: %w", err)
+	}
+	if locked > 0 {
+		return errTimesheetLocked
+	}
+	return nil
+}
+
+// Gets week of timesheet containing t, in user's location
+func timesheetWeek(t time.Time, loc *time.Location) (week string, from time.Time, to time.Time) {
+	from = startOfWeek(t.In(loc))
+	return from.Format(time.DateOnly), from, from.AddDate(0, 0, 7)
+}
+
+// Parses week given as Monday's date, returns week of any other date too
+func parseTimesheetWeek(value string, loc *time.Location) (string, time.Time, time.Time, error) {
+	day, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("invalid week %q, use date like 2024-03-04", value)
+	}
+	week, from, to := timesheetWeek(day, loc)
+	return week, from, to, nil
+}
+
+func scanTimesheet(row rowScanner) (Timesheet, error) {
+	var ts Timesheet
+	err := row.Scan(&ts.UserID, &ts.Week, &ts.PeriodStart, &ts.PeriodEnd, &ts.State, &ts.SubmittedAt, &ts.ReviewedBy, &ts.ReviewedAt, &ts.Comment)
+	return ts, err
+}
+
+// Gets timesheet of user for week. Weeks which were never submitted are returned as open.
+func (db *Database) GetTimesheet(userID string, week string) (Timesheet, error) {
+	ts, err := scanTimesheet(db.conn.QueryRow(getTimesheetSQL, userID, week))
+	if err == sql.ErrNoRows {
+		return Timesheet{UserID: userID, Week: week, State: TimesheetOpen}, nil
+	}
+	if err != nil {
+		return Timesheet{}, fmt.Errorf("failed to get timesheet: %w", err)
+	}
+	return ts, nil
+}
+
+// Gets stored timesheets. Empty filters match everything, weeks are inclusive.
+func (db *Database) GetTimesheets(state string, userID string, fromWeek string, toWeek string) ([]Timesheet, error) {
+	rows, err := db.conn.Query(getTimesheetsSQL, state, state, userID, userID, fromWeek, fromWeek, toWeek, toWeek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timesheets: %w", err)
+	}
+	defer rows.Close()
+
+	var timesheets []Timesheet
+	for rows.Next() {
+		ts, err := scanTimesheet(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan timesheet: %w", err)
+		}
+		timesheets = append(timesheets, ts)
+	}
+	return timesheets, rows.Err()
+}
+
+// Submits week of user for review. Open and rejected weeks without
+// running entries can be submitted.
+func (db *Database) SubmitTimesheet(userID string, week string, from time.Time, to time.Time, now time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to submit timesheet: %w", err)
+	}
+	defer tx.Rollback()
+
+	ts, err := scanTimesheet(tx.QueryRow(getTimesheetSQL, userID, week))
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get timesheet: %w", err)
+	}
+	if err == nil && (ts.State == TimesheetSubmitted || ts.State == TimesheetApproved) {
+		return fmt.Errorf("Timesheet for week %s is already %s.", week, ts.State)
+	}
+
+	var running int
+	if err := tx.QueryRow(countRunningInWeek, userID, to).Scan(&running); err != nil {
+		return fmt.Errorf("failed to submit timesheet: %w", err)
+	}
+	if running > 0 {
+		return fmt.Errorf("Stop your timer before submitting the week.")
+	}
+
+	if _, err := tx.Exec(submitTimesheetSQL, userID, week, from, to, now); err != nil {
+		return fmt.Errorf("failed to submit timesheet: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Moves timesheet to new state. Only submitted timesheets can be approved
+// or rejected and only approved ones can be reopened.
+func (db *Database) ReviewTimesheet(userID string, week string, state string, reviewer string, comment string, now time.Time) error {
+	required := TimesheetSubmitted
+	if state == TimesheetOpen {
+		required = TimesheetApproved
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to review timesheet: %w", err)
+	}
+	defer tx.Rollback()
+
+	ts, err := scanTimesheet(tx.QueryRow(getTimesheetSQL, userID, week))
+	if err == sql.ErrNoRows || (err == nil && ts.State != required) {
+		return fmt.Errorf("Timesheet of %s for week %s is not %s.", userID, week, required)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get timesheet: %w", err)
+	}
+
+	if _, err := tx.Exec(reviewTimesheetSQL, state, reviewer, now, comment, userID, week); err != nil {
+		return fmt.Errorf("failed to review timesheet: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Builds summary of user's week shown to the user and reviewers
+func (b *Bot) describeTimesheet(ts Timesheet, from time.Time, to time.Time) string {
+	report, err := b.db.GetReport(ts.UserID, from, to, b.cfg.Rounding)
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+
+	lines := []string{
+		fmt.Sprintf("🗓️ Timesheet of %s for week %s: %s", b.userName(ts.UserID), ts.Week, ts.State),
+		"Total: " + formatDuration(report.Total) + formatRounded(report.Total, report.Rounded),
+	}
+	for _, total := range sortedTotals(report.ByProject, "No project") {
+		lines = append(lines, fmt.Sprintf("• %s: %s", total.Label, formatDuration(total.Duration)))
+	}
+	if ts.Comment != "" {
+		lines = append(lines, "Comment: "+ts.Comment)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Gets latest known name of user, or the ID if the name is unknown
+func (b *Bot) userName(userID string) string {
+	users, err := b.db.GetUsers()
+	if err == nil {
+		for _, user := range users {
+			if strconv.FormatInt(user.ID, 10) == userID && user.Name != "" {
+				return user.Name
+			}
+		}
+	}
+	return userID
+}
+
+func timesheetKeyboard(ts Timesheet) tgbotapi.InlineKeyboardMarkup {
+	key := ts.UserID + ":" + ts.Week
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Approve", "timesheet:approve:"+key),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Reject", "timesheet:reject:"+key),
+	))
+}
+
+// Sends submitted timesheet with review buttons to chat
+func (b *Bot) sendTimesheetForReview(chatID int64, ts Timesheet) {
+	b.sendMessageWithKeyboard(chatID, b.describeTimesheet(ts, ts.PeriodStart, ts.PeriodEnd), timesheetKeyboard(ts))
+}
+
+// Gets IDs of users who review timesheets
+func (b *Bot) reviewerIDs() []int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var ids []int64
+	for id, role := range b.users {
+		if roleAllows(role, RoleManager) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Submits user's week for review and sends it to managers.
+//
+// Usage:
+//
+//	/submit [week|lastweek]
+func (b *Bot) handleSubmitCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	period := strings.TrimSpace(args)
+	if period != "" && period != "week" && period != "lastweek" {
+		b.sendMessage(message.Chat.ID, "Usage: /submit [week|lastweek]", message.MessageID)
+		return
+	}
+
+	settings, err := b.db.GetUserSettings(userID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	now := time.Now()
+	loc := settings.Location(b.cfg.Timezone)
+	day := now
+	if period == "lastweek" {
+		day = now.AddDate(0, 0, -7)
+	}
+	week, from, to := timesheetWeek(day, loc)
+
+	if err := b.db.SubmitTimesheet(userID, week, from, to, now); err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	ts, err := b.db.GetTimesheet(userID, week)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	reviewers := b.reviewerIDs()
+	for _, reviewer := range reviewers {
+		b.sendTimesheetForReview(reviewer, ts)
+	}
+	if len(reviewers) == 0 {
+		logger.Warn("timesheet submitted but there are no managers", "week", week)
+	}
+
+	b.sendMessage(message.Chat.ID, "📨 Submitted for review.\n"+b.describeTimesheet(ts, from, to), message.MessageID)
+}
+
+// Lists submitted timesheets with review buttons, or reviews one directly.
+//
+// Usage:
+//
+//	/review
+//	/review approve <user-id> <week> [comment]
+//	/review reject <user-id> <week> [comment]
+//	/review reopen <user-id> <week>
+func (b *Bot) handleReviewCommand(message *tgbotapi.Message, userID string, args string) {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		timesheets, err := b.db.GetTimesheets(TimesheetSubmitted, "", "", "")
+		if err != nil {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+			return
+		}
+		if len(timesheets) == 0 {
+			b.sendMessage(message.Chat.ID, "There are no timesheets waiting for review.", message.MessageID)
+			return
+		}
+		for _, ts := range timesheets {
+			b.sendTimesheetForReview(message.Chat.ID, ts)
+		}
+		return
+	}
+
+	states := map[string]string{
+		"approve": TimesheetApproved,
+		"reject":  TimesheetRejected,
+		"reopen":  TimesheetOpen,
+	}
+	state, ok := states[strings.ToLower(fields[0])]
+	if !ok || len(fields) < 3 {
+		b.sendMessage(message.Chat.ID, reviewUsage, message.MessageID)
+		return
+	}
+
+	week, _, _, err := parseTimesheetWeek(fields[2], b.cfg.Timezone)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	text, err := b.reviewTimesheet(fields[1], week, state, userID, strings.Join(fields[3:], " "))
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	b.sendMessage(message.Chat.ID, text, message.MessageID)
+}
+
+const reviewUsage = "Usage:\n" +
+	"/review - List timesheets waiting for review\n" +
+	"/review approve <user-id> <week> [comment] - Approve timesheet, week is date of its Monday\n" +
+	"/review reject <user-id> <week> [comment] - Reject timesheet so it can be corrected\n" +
+	"/review reopen <user-id> <week> - Unlock approved timesheet"
+
+// Changes state of timesheet and notifies its owner. Returns text for the reviewer.
+func (b *Bot) reviewTimesheet(userID string, week string, state string, reviewer string, comment string) (string, error) {
+	if err := b.db.ReviewTimesheet(userID, week, state, reviewer, comment, time.Now()); err != nil {
+		return "", err
+	}
+
+	ts, err := b.db.GetTimesheet(userID, week)
+	if err != nil {
+		return "", err
+	}
+	summary := b.describeTimesheet(ts, ts.PeriodStart, ts.PeriodEnd)
+
+	icons := map[string]string{
+		TimesheetApproved: "✅",
+		TimesheetRejected: "❌",
+		TimesheetOpen:     "🔓",
+	}
+	if chatID, err := strconv.ParseInt(userID, 10, 64); err == nil && userID != reviewer {
+		b.sendMessage(chatID, fmt.Sprintf("%s Your timesheet was reviewed by %s.\n%s", icons[state], b.userName(reviewer), summary), 0)
+	}
+	return icons[state] + " " + summary, nil
+}
+
+// Handles Approve and Reject buttons of submitted timesheets. Rejecting
+// asks the reviewer for a comment first.
+//
+// Callback data:
+//
+//	timesheet:approve:<user-id>:<week>
+//	timesheet:reject:<user-id>:<week>
+func (b *Bot) handleTimesheetCallback(query *tgbotapi.CallbackQuery, args []string, logger *slog.Logger) {
+	if len(args) != 3 {
+		b.answerCallback(query, "Unknown action.")
+		return
+	}
+	if role, _ := b.userRole(query.From.ID); !roleAllows(role, RoleManager) {
+		b.answerCallback(query, "Only managers can review timesheets.")
+		return
+	}
+
+	action, userID, week := args[0], args[1], args[2]
+	reviewer := strconv.FormatInt(query.From.ID, 10)
+
+	switch action {
+	case "approve":
+		text, err := b.reviewTimesheet(userID, week, TimesheetApproved, reviewer, "")
+		if err != nil {
+			b.answerCallback(query, fmt.Sprintf("%s", err))
+			return
+		}
+		b.answerCallback(query, "Approved.")
+		b.editMessage(query.Message, text)
+	case "reject":
+		if query.Message == nil {
+			b.answerCallback(query, "Unknown action.")
+			return
+		}
+
+		conv := &Conversation{
+			UserID:    reviewer,
+			ChatID:    query.Message.Chat.ID,
+			State:     StateAwaitingReviewComment,
+			Data:      ConversationData{TimesheetUser: userID, TimesheetWeek: week},
+			ExpiresAt: time.Now().Add(conversationTimeout),
+		}
+		if err := b.db.SaveConversation(conv); err != nil {
+			b.answerCallback(query, fmt.Sprintf("%s", err))
+			return
+		}
+		b.answerCallback(query, "")
+		b.removeKeyboard(query.Message)
+		b.sendMessage(query.Message.Chat.ID, "Please enter reason for rejecting or type 'x' to reject without comment.", 0)
+	default:
+		b.answerCallback(query, "Unknown action.")
+	}
+}
+
+func stepAwaitingReviewComment(b *Bot, message *tgbotapi.Message, conv *Conversation) (ConversationState, string) {
+	text, err := b.reviewTimesheet(conv.Data.TimesheetUser, conv.Data.TimesheetWeek, TimesheetRejected, conv.UserID, optionalAnswer(message.Text))
+	if err != nil {
+		return "", fmt.Sprintf("%s", err)
+	}
+	return "", text
+}
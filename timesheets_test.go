@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTimesheetWeek(t *testing.T) {
+	tests := []struct {
+		value    string
+		wantWeek string
+		wantErr  bool
+	}{
+		{"2024-03-04", "2024-03-04", false},
+		{"2024-03-06", "2024-03-04", false},
+		{"2024-03-10", "2024-03-04", false},
+		{"2024-03-11", "2024-03-11", false},
+		{"2024-01-01", "2024-01-01", false},
+		{"2024-12-31", "2024-12-30", false},
+		{"2024-3-4", "", true},
+		{"last week", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			week, from, to, err := parseTimesheetWeek(tt.value, time.UTC)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTimesheetWeek(%q) = %q, want error", tt.value, week)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimesheetWeek(%q) error = %v", tt.value, err)
+			}
+			if week != tt.wantWeek || from.Format(time.DateOnly) != tt.wantWeek || to.Sub(from) != 7*24*time.Hour {
+				t.Errorf("parseTimesheetWeek(%q) = %q, %v, %v, want week %q", tt.value, week, from, to, tt.wantWeek)
+			}
+		})
+	}
+}
+
+func TestApprovedTimesheetLocksEntries(t *testing.T) {
+	states := []struct {
+		name   string
+		review []string
+		locked bool
+	}{
+		{"submitted", nil, false},
+		{"approved", []string{TimesheetApproved}, true},
+		{"rejected", []string{TimesheetRejected}, false},
+		{"reopened", []string{TimesheetApproved, TimesheetOpen}, false},
+	}
+
+	changes := []struct {
+		name   string
+		change func(db *Database, entryID int64) error
+	}{
+		{"billable", func(db *Database, entryID int64) error {
+			_, err := db.SetEntryBillable("1", entryID, false)
+			return err
+		}},
+		{"delete", func(db *Database, entryID int64) error {
+			_, err := db.DeleteEntry("1", entryID)
+			return err
+		}},
+		{"undo", func(db *Database, entryID int64) error {
+			_, err := db.UndoLastAction("1", time.Now().Add(-time.Minute))
+			return err
+		}},
+		{"start", func(db *Database, entryID int64) error {
+			_, err := db.StartTracking("1", "", "")
+			return err
+		}},
+	}
+
+	for _, state := range states {
+		for _, change := range changes {
+			t.Run(state.name+"/"+change.name, func(t *testing.T) {
+				db := newTestDatabase(t)
+				now := time.Now()
+
+				entry, err := db.StartTracking("1", "note", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.StopTracking("1"); err != nil {
+					t.Fatal(err)
+				}
+
+				week, from, to := timesheetWeek(now, time.UTC)
+				if err := db.SubmitTimesheet("1", week, from, to, now); err != nil {
+					t.Fatal(err)
+				}
+				for _, review := range state.review {
+					if err := db.ReviewTimesheet("1", week, review, "2", "", now); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				err = change.change(db, entry.ID)
+				if state.locked && !errors.Is(err, errTimesheetLocked) {
+					t.Errorf("%s of entry in %s week error = %v, want %v", change.name, state.name, err, errTimesheetLocked)
+				}
+				if !state.locked && err != nil {
+					t.Errorf("%s of entry in %s week error = %v", change.name, state.name, err)
+				}
+			})
+		}
+	}
+}
+
+func TestApprovedTimesheetKeepsOtherUsersUnlocked(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now()
+
+	for _, userID := range []string{"1", "2"} {
+		if _, err := db.StartTracking(userID, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.StopTracking(userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	week, from, to := timesheetWeek(now, time.UTC)
+	if err := db.SubmitTimesheet("1", week, from, to, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ReviewTimesheet("1", week, TimesheetApproved, "3", "", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.SetEntryBillable("1", 0, false); !errors.Is(err, errTimesheetLocked) {
+		t.Errorf("SetEntryBillable() of approved week error = %v, want %v", err, errTimesheetLocked)
+	}
+	if _, err := db.SetEntryBillable("2", 0, false); err != nil {
+		t.Errorf("SetEntryBillable() of other user error = %v", err)
+	}
+}
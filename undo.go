@@ -0,0 +1,316 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	softDeleteEntrySQL   = `UPDATE entries SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+	restoreEntrySQL      = `UPDATE entries SET deleted_at = NULL WHERE id = ?`
+	reopenEntrySQL       = `UPDATE entries SET end_time = NULL, active = 1 WHERE id = ?`
+	getExpiredDeletedSQL = `SELECT id FROM entries WHERE deleted_at IS NOT NULL AND unixepoch(deleted_at) < unixepoch(?)`
+	purgeEntrySQL        = `DELETE FROM entries WHERE id = ?`
+	getLastUndoableSQL   = `SELECT id, created_at, actor, action, entity, entity_id, before, after FROM audit_log a
+  WHERE actor = ? AND entity = 'entry' AND action IN ('start', 'stop', 'billable', 'delete') AND unixepoch(created_at) >= unixepoch(?)
+  AND NOT EXISTS (SELECT 1 FROM audit_log u WHERE u.undone_id = a.id)
+  ORDER BY id DESC LIMIT 1`
+)
+
+// Soft deletes entry of user. Zero entry ID selects the running or most
+// recently started entry. Deleted entries are purged after retention period.
+func (db *Database) DeleteEntry(userID string, entryID int64) (Entry, error) {
+	if entryID == 0 {
+		err := db.conn.QueryRow(getLastEntrySQL, userID).Scan(&entryID)
+		if err == sql.ErrNoRows {
+			return Entry{}, fmt.Errorf("You have no entries yet.")
+		}
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to get last entry: %w", err)
+		}
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to delete entry %d: %w", entryID, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkUnlocked(tx, lockedEntrySQL, entryID); err != nil {
+		return Entry{}, err
+	}
+
+	entry, err := getEntryByID(tx, entryID)
+	if err != nil || entry.UserID != userID || entry.DeletedAt.Valid {
+		return Entry{}, fmt.Errorf("Entry %d was not found.", entryID)
+	}
+
+	if _, err := tx.Exec(softDeleteEntrySQL, time.Now(), entryID); err != nil {
+		return Entry{}, fmt.Errorf("failed to delete entry %d: %w", entryID, err)
+	}
+	if _, err := tx.Exec(interruptFocusSessionSQL, entryID); err != nil {
+		return Entry{}, fmt.Errorf("Failed to end focus session: %w", err)
+	}
+	if err := writeAudit(tx, userActor(userID), "delete", AuditEntry, entryID, entry, nil); err != nil {
+		return Entry{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Entry{}, fmt.Errorf("failed to delete entry %d: %w", entryID, err)
+	}
+	if err := db.decryptNote(&entry); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// Reverts the latest start, stop, billable change or deletion the user made
+// after since, which was not undone yet. Entries changed since then by
+// someone else are left alone. Returns the reverted audit record.
+func (db *Database) UndoLastAction(userID string, since time.Time) (AuditRecord, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("failed to undo: %w", err)
+	}
+	defer tx.Rollback()
+
+	actor := userActor(userID)
+	var record AuditRecord
+	var before, after sql.NullString
+	err = tx.QueryRow(getLastUndoableSQL, actor, since).Scan(&record.ID, &record.CreatedAt, &record.Actor, &record.Action,
+		&record.Entity, &record.EntityID, &before, &after)
+	if err == sql.ErrNoRows {
+		return AuditRecord{}, fmt.Errorf("There is nothing to undo.")
+	}
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("failed to get last action: %w", err)
+	}
+	record.Before = json.RawMessage(before.String)
+	record.After = json.RawMessage(after.String)
+
+	entryID, err := strconv.ParseInt(record.EntityID, 10, 64)
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("invalid entry ID %q in audit record %d", record.EntityID, record.ID)
+	}
+	if err := checkUnlocked(tx, lockedEntrySQL, entryID); err != nil {
+		return AuditRecord{}, err
+	}
+
+	current, err := getEntryByID(tx, entryID)
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("Entry %d does not exist anymore.", entryID)
+	}
+
+	// deletion keeps the entry as it was before, other actions must be
+	// the last change of the entry
+	expected := record.After
+	if record.Action == "delete" {
+		expected = record.Before
+	}
+	same, err := db.matchesState(current, expected)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	if !same || current.DeletedAt.Valid != (record.Action == "delete") {
+		return AuditRecord{}, fmt.Errorf("Entry %d was changed since, it can not be undone.", entryID)
+	}
+
+	// running entries can be restored only when no other timer runs
+	if record.Action == "stop" || record.Action == "delete" && current.Active {
+		var active int
+		if err := tx.QueryRow(hasActiveEntrySQL, current.UserID).Scan(&active); err != nil {
+			return AuditRecord{}, fmt.Errorf("failed to check active entry: %w", err)
+		}
+		if active > 0 {
+			return AuditRecord{}, fmt.Errorf("Stop your timer before undoing.")
+		}
+	}
+
+	var beforeUndo, afterUndo any = current, nil
+	switch record.Action {
+	case "start":
+		_, err = tx.Exec(softDeleteEntrySQL, time.Now(), entryID)
+		if err == nil {
+			_, err = tx.Exec(interruptFocusSessionSQL, entryID)
+		}
+	case "stop":
+		_, err = tx.Exec(reopenEntrySQL, entryID)
+	case "billable":
+		var previous Entry
+		if err := json.Unmarshal(record.Before, &previous); err != nil {
+			return AuditRecord{}, fmt.Errorf("failed to decode audit record %d: %w", record.ID, err)
+		}
+		_, err = tx.Exec(updateEntryBillableSQL, previous.Billable, entryID, current.UserID)
+	case "delete":
+		beforeUndo = nil
+		_, err = tx.Exec(restoreEntrySQL, entryID)
+	}
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("failed to undo %s of entry %d: %w", record.Action, entryID, err)
+	}
+
+	if record.Action != "start" {
+		if afterUndo, err = getEntryByID(tx, entryID); err != nil {
+			return AuditRecord{}, err
+		}
+	}
+	if err := writeUndoAudit(tx, actor, record.ID, AuditEntry, entryID, beforeUndo, afterUndo); err != nil {
+		return AuditRecord{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return AuditRecord{}, fmt.Errorf("failed to undo: %w", err)
+	}
+	return record, nil
+}
+
+// Checks if entry is in the state recorded in audit log. Notes are compared
+// decrypted, since rekey changes stored notes but not the audit log.
+func (db *Database) matchesState(entry Entry, state json.RawMessage) (bool, error) {
+	var recorded Entry
+	if err := json.Unmarshal(state, &recorded); err != nil {
+		return false, fmt.Errorf("failed to decode audit state: %w", err)
+	}
+	if err := db.decryptNote(&recorded); err != nil {
+		return false, err
+	}
+	if err := db.decryptNote(&entry); err != nil {
+		return false, err
+	}
+
+	a, err := json.Marshal(recorded)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode entry: %w", err)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode entry: %w", err)
+	}
+	return string(a) == string(b), nil
+}
+
+// Hard deletes entries which were soft deleted before given time.
+// Returns number of purged entries.
+func (db *Database) PurgeDeletedEntries(before time.Time) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted entries: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(getExpiredDeletedSQL, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deleted entries: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan deleted entry: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get deleted entries: %w", err)
+	}
+
+	for _, id := range ids {
+		entry, err := getEntryByID(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(purgeEntrySQL, id); err != nil {
+			return 0, fmt.Errorf("failed to purge entry %d: %w", id, err)
+		}
+		if err := writeAudit(tx, ActorSystem, "purge", AuditEntry, id, entry, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to purge deleted entries: %w", err)
+	}
+	return len(ids), nil
+}
+
+// Purges soft deleted entries older than retention period
+func (b *Bot) purgeDeletedEntries(now time.Time) {
+	purged, err := b.db.PurgeDeletedEntries(now.Add(-b.cfg.DeletedRetention))
+	if err != nil {
+		slog.Error("failed to purge deleted entries", "error", err)
+		return
+	}
+	if purged > 0 {
+		slog.Info("purged deleted entries", "count", purged)
+	}
+}
+
+// Deletes entry, the latest one by default. It can be restored with /undo.
+//
+// Usage:
+//
+//	/delete [entry-id]
+func (b *Bot) handleDeleteCommand(message *tgbotapi.Message, userID string, args string) {
+	var entryID int64
+	if args = strings.TrimSpace(args); args != "" {
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			b.sendMessage(message.Chat.ID, "Usage: /delete [entry-id]", message.MessageID)
+			return
+		}
+		entryID = id
+	}
+
+	entry, err := b.db.DeleteEntry(userID, entryID)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	loc := b.cfg.Timezone
+	if settings, err := b.db.GetUserSettings(userID); err == nil {
+		loc = settings.Location(b.cfg.Timezone)
+	}
+
+	text := fmt.Sprintf("🗑️ Entry %d from %s is deleted.", entry.ID, entry.StartTime.In(loc).Format("2006-01-02 15:04"))
+	if entry.Note != "" {
+		text = fmt.Sprintf("🗑️ Entry %d (%s) from %s is deleted.", entry.ID, entry.Note, entry.StartTime.In(loc).Format("2006-01-02 15:04"))
+	}
+	b.sendMessage(message.Chat.ID, text+" Type /undo to restore it.", message.MessageID)
+}
+
+// Reverts the latest start, stop, billable change or deletion of the
+// user made within the undo window.
+//
+// Usage:
+//
+//	/undo
+func (b *Bot) handleUndoCommand(message *tgbotapi.Message, userID string) {
+	record, err := b.db.UndoLastAction(userID, time.Now().Add(-b.cfg.UndoWindow))
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+
+	var text string
+	switch record.Action {
+	case "start":
+		text = fmt.Sprintf("↩️ Start of entry %s is undone, the entry is deleted.", record.EntityID)
+	case "stop":
+		text = fmt.Sprintf("↩️ Stop of entry %s is undone, the timer is running again.", record.EntityID)
+	case "billable":
+		text = fmt.Sprintf("↩️ Billable change of entry %s is undone.", record.EntityID)
+	case "delete":
+		text = fmt.Sprintf("↩️ Entry %s is restored.", record.EntityID)
+	}
+	b.sendMessage(message.Chat.ID, text, message.MessageID)
+}
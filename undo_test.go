@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndoLastAction(t *testing.T) {
+	start := func(t *testing.T, db *Database) int64 {
+		entry, err := db.StartTracking("1", "note", "project")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry.ID
+	}
+	stop := func(t *testing.T, db *Database) int64 {
+		id := start(t, db)
+		if _, err := db.StopTracking("1"); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T, db *Database) int64
+		userID      string
+		since       time.Duration
+		wantErr     string
+		wantAction  string
+		wantDeleted bool
+		wantActive  bool
+		wantBill    bool
+	}{
+		{
+			name:        "start",
+			setup:       start,
+			wantAction:  "start",
+			wantDeleted: true,
+			wantActive:  true,
+			wantBill:    true,
+		},
+		{
+			name:       "stop",
+			setup:      stop,
+			wantAction: "stop",
+			wantActive: true,
+			wantBill:   true,
+		},
+		{
+			name: "billable",
+			setup: func(t *testing.T, db *Database) int64 {
+				id := stop(t, db)
+				if _, err := db.SetEntryBillable("1", id, false); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			wantAction: "billable",
+			wantBill:   true,
+		},
+		{
+			name: "delete",
+			setup: func(t *testing.T, db *Database) int64 {
+				id := stop(t, db)
+				if _, err := db.DeleteEntry("1", id); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			wantAction: "delete",
+			wantBill:   true,
+		},
+		{
+			name: "already undone action is skipped",
+			setup: func(t *testing.T, db *Database) int64 {
+				id := stop(t, db)
+				if _, err := db.UndoLastAction("1", time.Now().Add(-time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			wantAction:  "start",
+			wantDeleted: true,
+			wantActive:  true,
+			wantBill:    true,
+		},
+		{
+			name: "changed by someone else",
+			setup: func(t *testing.T, db *Database) int64 {
+				id := start(t, db)
+				if _, err := db.StopEntryAt(userActor("2"), "1", id, time.Now()); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			wantErr: "was changed since",
+		},
+		{
+			name: "timer runs",
+			setup: func(t *testing.T, db *Database) int64 {
+				id := stop(t, db)
+				if _, err := db.conn.Exec(createEntrySQL, "1", time.Now(), "", ""); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			wantErr: "Stop your timer",
+		},
+		{
+			name:    "nothing done",
+			setup:   func(t *testing.T, db *Database) int64 { return 0 },
+			wantErr: "nothing to undo",
+		},
+		{
+			name:    "action of other user",
+			setup:   stop,
+			userID:  "2",
+			wantErr: "nothing to undo",
+		},
+		{
+			name:    "action outside of window",
+			setup:   stop,
+			since:   time.Hour,
+			wantErr: "nothing to undo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			id := tt.setup(t, db)
+
+			userID := tt.userID
+			if userID == "" {
+				userID = "1"
+			}
+			// window starts a minute ago unless the test moves it
+			since := time.Now().Add(tt.since - time.Minute)
+
+			record, err := db.UndoLastAction(userID, since)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("UndoLastAction() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UndoLastAction() error = %v", err)
+			}
+			if record.Action != tt.wantAction {
+				t.Errorf("UndoLastAction() undid %q, want %q", record.Action, tt.wantAction)
+			}
+
+			entry, err := getEntryByID(db.conn, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.DeletedAt.Valid != tt.wantDeleted || entry.Active != tt.wantActive || entry.Billable != tt.wantBill {
+				t.Errorf("entry after undo deleted = %v, active = %v, billable = %v, want %v, %v, %v",
+					entry.DeletedAt.Valid, entry.Active, entry.Billable, tt.wantDeleted, tt.wantActive, tt.wantBill)
+			}
+		})
+	}
+}
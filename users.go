@@ -0,0 +1,322 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Roles of users, each role can do everything the lower ones can
+const (
+	RoleViewer  = "viewer"
+	RoleMember  = "member"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:  1,
+	RoleMember:  2,
+	RoleManager: 3,
+	RoleAdmin:   4,
+}
+
+// Commands which do not require the member role. Commands missing here
+// change data and require at least member.
+var commandRoles = map[string]string{
+	"help":    RoleViewer,
+	"cancel":  RoleViewer,
+	"status":  RoleViewer,
+	"report":  RoleViewer,
+	"chart":   RoleViewer,
+	"export":  RoleViewer,
+	"who":     RoleViewer,
+	"history": RoleViewer,
+	"review":  RoleManager,
+	"rate":    RoleManager,
+	"admin":   RoleAdmin,
+	"invite":  RoleAdmin,
+}
+
+// User allowed to use the bot
+type User struct {
+	ID        int64
+	Role      string
+	Name      string
+	AddedBy   string
+	CreatedAt time.Time
+}
+
+const (
+	getUsersSQL = `
+  SELECT u.id, u.role, COALESCE((SELECT name FROM chat_members m WHERE m.user_id = CAST(u.id AS TEXT) ORDER BY last_seen DESC LIMIT 1), ''),
+  u.added_by, u.created_at FROM users u ORDER BY u.id`
+	insertUserIfMissingSQL = `INSERT INTO users (id, role, added_by, created_at) VALUES (?, ?, ?, ?) ON CONFLICT(id) DO NOTHING`
+	getUserRoleSQL         = `SELECT role FROM users WHERE id = ?`
+	updateUserRoleSQL      = `UPDATE users SET role = ? WHERE id = ?`
+	deleteUserSQL          = `DELETE FROM users WHERE id = ?`
+	countAdminsSQL         = `SELECT COUNT(*) FROM users WHERE role = 'admin'`
+)
+
+// Roles required by /project subcommands which change billing of all
+// entries of a project. Other subcommands are allowed to members.
+var projectActionRoles = map[string]string{
+	"client":   RoleManager,
+	"rounding": RoleManager,
+	"budget":   RoleManager,
+	"owner":    RoleManager,
+}
+
+// Checks if role is at least the required one
+func roleAllows(role string, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// Gets lowest role allowed to run command
+func commandRole(command string) string {
+	if role, ok := commandRoles[command]; ok {
+		return role
+	}
+	return RoleMember
+}
+
+// Validates role name given by user
+func parseRole(value string) (string, error) {
+	role := strings.ToLower(strings.TrimSpace(value))
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, use admin, manager, member or viewer", value)
+	}
+	return role, nil
+}
+
+// Gets all users with their latest known names
+func (db *Database) GetUsers() ([]User, error) {
+	rows, err := db.conn.Query(getUsersSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Role, &user.Name, &user.AddedBy, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Adds users with role, users which already exist keep their role
+func (db *Database) EnsureUsers(ids []int64, role string) error {
+	for _, id := range ids {
+		if _, err := db.conn.Exec(insertUserIfMissingSQL, id, role, "", time.Now()); err != nil {
+			return fmt.Errorf("failed to add user %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Adds user. Existing users are not changed, their role is changed with
+// SetUserRole, which keeps the last admin.
+func (db *Database) SaveUser(id int64, role string, addedBy string) error {
+	result, err := db.conn.Exec(insertUserIfMissingSQL, id, role, addedBy, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save user %d: %w", id, err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save user %d: %w", id, err)
+	}
+	if added == 0 {
+		return fmt.Errorf("user %d already exists, use /admin promote to change the role", id)
+	}
+	return nil
+}
+
+// Changes role of user. The last admin can not be demoted.
+func (db *Database) SetUserRole(id int64, role string) error {
+	return db.changeUser(id, func(tx *sql.Tx) error {
+		_, err := tx.Exec(updateUserRoleSQL, role, id)
+		return err
+	}, role == RoleAdmin)
+}
+
+// Removes user. The last admin can not be removed.
+func (db *Database) RemoveUser(id int64) error {
+	return db.changeUser(id, func(tx *sql.Tx) error {
+		_, err := tx.Exec(deleteUserSQL, id)
+		return err
+	}, false)
+}
+
+// Applies change to existing user and checks that an admin remains,
+// unless the change keeps user an admin.
+func (db *Database) changeUser(id int64, change func(tx *sql.Tx) error, staysAdmin bool) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update user %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRow(getUserRoleSQL, id).Scan(&role)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user %d does not exist", id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", id, err)
+	}
+
+	if err := change(tx); err != nil {
+		return fmt.Errorf("failed to update user %d: %w", id, err)
+	}
+
+	if role == RoleAdmin && !staysAdmin {
+		var admins int
+		if err := tx.QueryRow(countAdminsSQL).Scan(&admins); err != nil {
+			return fmt.Errorf("failed to count admins: %w", err)
+		}
+		if admins == 0 {
+			return fmt.Errorf("user %d is the last admin", id)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Reloads roles of users from database
+func (b *Bot) loadUsers() error {
+	users, err := b.db.GetUsers()
+	if err != nil {
+		return err
+	}
+
+	roles := make(map[int64]string, len(users))
+	for _, user := range users {
+		roles[user.ID] = user.Role
+	}
+
+	b.mu.Lock()
+	b.users = roles
+	b.mu.Unlock()
+	return nil
+}
+
+// Gets role of user. Unknown users are members in open access mode
+// and are not allowed otherwise.
+func (b *Bot) userRole(userID int64) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if role, ok := b.users[userID]; ok {
+		return role, true
+	}
+	if b.cfg.OpenAccess {
+		return RoleMember, true
+	}
+	return "", false
+}
+
+// Manages users and their roles.
+//
+// Usage:
+//
+//	/admin list
+//	/admin adduser <user-id> [role]
+//	/admin removeuser <user-id>
+//	/admin promote <user-id> <role>
+func (b *Bot) handleAdminCommand(message *tgbotapi.Message, userID string, args string, logger *slog.Logger) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		b.sendMessage(message.Chat.ID, adminUsage, message.MessageID)
+		return
+	}
+
+	action := strings.ToLower(fields[0])
+	if action == "list" {
+		b.sendMessage(message.Chat.ID, b.describeUsers(), message.MessageID)
+		return
+	}
+
+	if len(fields) < 2 {
+		b.sendMessage(message.Chat.ID, adminUsage, message.MessageID)
+		return
+	}
+	id, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		b.sendMessage(message.Chat.ID, "User must be given by Telegram ID.", message.MessageID)
+		return
+	}
+
+	var text string
+	switch {
+	case action == "adduser" && len(fields) <= 3:
+		role := RoleMember
+		if len(fields) == 3 {
+			if role, err = parseRole(fields[2]); err != nil {
+				break
+			}
+		}
+		err = b.db.SaveUser(id, role, userID)
+		text = fmt.Sprintf("👤 User %d added as %s.", id, role)
+	case action == "removeuser" && len(fields) == 2:
+		err = b.db.RemoveUser(id)
+		text = fmt.Sprintf("👤 User %d removed.", id)
+	case action == "promote" && len(fields) == 3:
+		var role string
+		if role, err = parseRole(fields[2]); err != nil {
+			break
+		}
+		err = b.db.SetUserRole(id, role)
+		text = fmt.Sprintf("👤 User %d is now %s.", id, role)
+	default:
+		b.sendMessage(message.Chat.ID, adminUsage, message.MessageID)
+		return
+	}
+
+	if err != nil {
+		b.sendMessage(message.Chat.ID, fmt.Sprintf("%s", err), message.MessageID)
+		return
+	}
+	if err := b.loadUsers(); err != nil {
+		logger.Error("failed to reload users", "error", err)
+	}
+	b.sendMessage(message.Chat.ID, text, message.MessageID)
+}
+
+const adminUsage = "Usage:\n" +
+	"/admin list - List users and their roles\n" +
+	"/admin adduser <user-id> [admin|manager|member|viewer] - Allow user to use the bot, as member by default\n" +
+	"/admin removeuser <user-id> - Remove user\n" +
+	"/admin promote <user-id> <admin|manager|member|viewer> - Change role of user"
+
+// Lists users with their roles
+func (b *Bot) describeUsers() string {
+	users, err := b.db.GetUsers()
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+
+	lines := []string{"👥 Users:"}
+	for _, user := range users {
+		line := fmt.Sprintf("• %d", user.ID)
+		if user.Name != "" {
+			line += " " + user.Name
+		}
+		lines = append(lines, line+": "+user.Role)
+	}
+	if len(users) == 0 {
+		lines = append(lines, "There are no users yet.")
+	}
+	if b.cfg.OpenAccess {
+		lines = append(lines, "", "Open access is enabled, everyone else can use the bot as member.")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestSaveUserKeepsExistingUser(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if err := db.SaveUser(1, RoleAdmin, ""); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	if err := db.SaveUser(1, RoleViewer, "2"); err == nil {
+		t.Fatal("SaveUser() of existing user succeeded")
+	}
+
+	users, err := db.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Role != RoleAdmin {
+		t.Fatalf("users = %+v, want single admin", users)
+	}
+}
+
+func TestChangeUserKeepsLastAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(db *Database) error
+		wantErr bool
+	}{
+		{"demote last admin", func(db *Database) error { return db.SetUserRole(1, RoleViewer) }, true},
+		{"remove last admin", func(db *Database) error { return db.RemoveUser(1) }, true},
+		{"keep admin role", func(db *Database) error { return db.SetUserRole(1, RoleAdmin) }, false},
+		{"demote member", func(db *Database) error { return db.SetUserRole(2, RoleViewer) }, false},
+		{"remove member", func(db *Database) error { return db.RemoveUser(2) }, false},
+		{"change unknown user", func(db *Database) error { return db.SetUserRole(3, RoleViewer) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(t)
+			if err := db.SaveUser(1, RoleAdmin, ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SaveUser(2, RoleMember, "1"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := tt.change(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBillingCommandsNeedManager(t *testing.T) {
+	tests := []struct {
+		command string
+		role    string
+		allowed bool
+	}{
+		{"rate", RoleMember, false},
+		{"rate", RoleManager, true},
+		{"rate", RoleAdmin, true},
+		{"project", RoleMember, true},
+		{"start", RoleMember, true},
+		{"start", RoleViewer, false},
+		{"report", RoleViewer, true},
+		{"review", RoleMember, false},
+	}
+
+	for _, tt := range tests {
+		if got := roleAllows(tt.role, commandRole(tt.command)); got != tt.allowed {
+			t.Errorf("%s may run /%s = %v, want %v", tt.role, tt.command, got, tt.allowed)
+		}
+	}
+
+	for _, action := range []string{"client", "rounding", "budget", "owner"} {
+		if roleAllows(RoleMember, projectActionRoles[action]) {
+			t.Errorf("member may run /project %s", action)
+		}
+	}
+	if _, ok := projectActionRoles["default"]; ok {
+		t.Error("/project default is limited, but members set it in their groups")
+	}
+}